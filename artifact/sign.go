@@ -0,0 +1,218 @@
+package artifact
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SigningKeyFile = "plugin.key"
+	PublicKeyFile  = "plugin.pub"
+
+	// signaturePayload prefixes the signed digests, so a plugin signature can't be replayed as another signature
+	signaturePayload = "omcp-plugin-v1\n"
+)
+
+var (
+	ErrUnsigned         = errors.New("plugin is not signed")
+	ErrUntrustedKey     = errors.New("plugin is signed by an untrusted key")
+	ErrInvalidSignature = errors.New("invalid plugin signature")
+)
+
+// Signature is the detached signature of a plugin artifact, it signs the digest of the artifact
+type Signature struct {
+	Digest string `json:"digest"`
+	KeyID  string `json:"key_id"`
+	// Sig is the ed25519 signature, hex encoded
+	Sig string `json:"signature"`
+}
+
+func ParseSignature(data []byte) (*Signature, error) {
+	var sig Signature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	digest, err := ParseDigest(sig.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	sig.Digest = digest
+	return &sig, nil
+}
+
+func (s *Signature) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// KeyID identifies a public key, the hex of the first 8 bytes of its SHA-256
+func KeyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateSigningKey writes the ed25519 signing key and its public key into the dir,
+// the public key is copied into the trust dir of the OMCP servers which accept the signed plugins
+func GenerateSigningKey(dir string) (string, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, SigningKeyFile), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0o600); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, PublicKeyFile), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o644); err != nil {
+		return "", err
+	}
+	return KeyID(public), nil
+}
+
+// Sign signs the plugin file with the key written by GenerateSigningKey
+func Sign(keyFile, pluginFile string) (*Signature, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid signing key, a PEM encoded key is required")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid signing key, an Ed25519 key is required")
+	}
+	digest, err := FileDigest(pluginFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		Digest: digest,
+		KeyID:  KeyID(private.Public().(ed25519.PublicKey)),
+		Sig:    hex.EncodeToString(ed25519.Sign(private, []byte(signaturePayload+digest))),
+	}, nil
+}
+
+// ReadPublicKey reads a PEM encoded ed25519 public key
+func ReadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key %s, a PEM encoded key is required", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid public key %s, an Ed25519 key is required", path)
+	}
+	return public, nil
+}
+
+// TrustStore is a dir of the trusted public keys, the *.pub files, it's read on every verification
+// so a key is trusted or revoked without a restart
+type TrustStore struct {
+	dir string
+}
+
+func NewTrustStore(dir string) *TrustStore {
+	return &TrustStore{dir: dir}
+}
+
+// Keys reads the trusted keys by their ids, a missing dir trusts no key
+func (t *TrustStore) Keys() (map[string]ed25519.PublicKey, error) {
+	keys := make(map[string]ed25519.PublicKey)
+	if t == nil || t.dir == "" {
+		return keys, nil
+	}
+	entries, err := os.ReadDir(t.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pub") {
+			continue
+		}
+		public, err := ReadPublicKey(filepath.Join(t.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		keys[KeyID(public)] = public
+	}
+	return keys, nil
+}
+
+// Verify checks the signature of the digest against the trusted keys, and returns the id of the signing key
+func (t *TrustStore) Verify(digest string, sig *Signature) (string, error) {
+	if sig == nil {
+		return "", ErrUnsigned
+	}
+	if sig.Digest != digest {
+		return "", fmt.Errorf("%w: it signs %s, not %s", ErrInvalidSignature, sig.Digest, digest)
+	}
+	keys, err := t.Keys()
+	if err != nil {
+		return "", err
+	}
+	public, ok := keys[sig.KeyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUntrustedKey, sig.KeyID)
+	}
+	raw, err := hex.DecodeString(sig.Sig)
+	if err != nil || !ed25519.Verify(public, []byte(signaturePayload+digest), raw) {
+		return "", ErrInvalidSignature
+	}
+	return sig.KeyID, nil
+}
+
+// Policy decides which plugin artifacts are loaded
+type Policy struct {
+	Trust *TrustStore
+	// AllowUnsigned loads the unsigned artifacts, the signed ones are still verified
+	AllowUnsigned bool
+}
+
+// Check verifies the signature of the digest, an unsigned artifact passes only if the policy allows it,
+// the id of the signing key is returned, empty for an unsigned artifact
+func (p Policy) Check(digest string, sig *Signature) (string, error) {
+	if sig == nil && p.AllowUnsigned {
+		return "", nil
+	}
+	return p.Trust.Verify(digest, sig)
+}
@@ -0,0 +1,166 @@
+package artifact
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newSignedPlugin signs a new plugin file with a new key, the key dir is a trust dir trusting only that key
+func newSignedPlugin(t *testing.T) (keyDir, digest string, sig *Signature) {
+	t.Helper()
+	keyDir = t.TempDir()
+	if _, err := GenerateSigningKey(keyDir); err != nil {
+		t.Fatal(err)
+	}
+	pluginFile := filepath.Join(t.TempDir(), "plugin.so")
+	if err := os.WriteFile(pluginFile, []byte(keyDir), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(filepath.Join(keyDir, SigningKeyFile), pluginFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err = FileDigest(pluginFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyDir, digest, sig
+}
+
+func TestPolicyCheck(t *testing.T) {
+	keyDir, digest, sig := newSignedPlugin(t)
+	otherDir, otherDigest, otherSig := newSignedPlugin(t)
+	trust := NewTrustStore(keyDir)
+	tampered, err := hex.DecodeString(sig.Sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered[0] ^= 1
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		digest  string
+		sig     *Signature
+		wantErr error
+	}{
+		{name: "signed by a trusted key", policy: Policy{Trust: trust}, digest: digest, sig: sig},
+		{name: "unsigned", policy: Policy{Trust: trust}, digest: digest, wantErr: ErrUnsigned},
+		{name: "unsigned allowed", policy: Policy{Trust: trust, AllowUnsigned: true}, digest: digest},
+		{
+			// allowing the unsigned artifacts doesn't let a bad signature through
+			name:    "signed by an untrusted key with unsigned allowed",
+			policy:  Policy{Trust: trust, AllowUnsigned: true},
+			digest:  otherDigest,
+			sig:     otherSig,
+			wantErr: ErrUntrustedKey,
+		},
+		{name: "signed by an untrusted key", policy: Policy{Trust: trust}, digest: otherDigest, sig: otherSig, wantErr: ErrUntrustedKey},
+		{name: "no trust dir", policy: Policy{}, digest: digest, sig: sig, wantErr: ErrUntrustedKey},
+		{name: "missing trust dir", policy: Policy{Trust: NewTrustStore(filepath.Join(keyDir, "missing"))}, digest: digest, sig: sig, wantErr: ErrUntrustedKey},
+		{name: "signature of another artifact", policy: Policy{Trust: trust}, digest: otherDigest, sig: sig, wantErr: ErrInvalidSignature},
+		{
+			name:    "tampered digest",
+			policy:  Policy{Trust: trust},
+			digest:  otherDigest,
+			sig:     &Signature{Digest: otherDigest, KeyID: sig.KeyID, Sig: sig.Sig},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered signature",
+			policy:  Policy{Trust: trust},
+			digest:  digest,
+			sig:     &Signature{Digest: digest, KeyID: sig.KeyID, Sig: hex.EncodeToString(tampered)},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "signature of another key under the trusted key id",
+			policy:  Policy{Trust: trust},
+			digest:  otherDigest,
+			sig:     &Signature{Digest: otherDigest, KeyID: sig.KeyID, Sig: otherSig.Sig},
+			wantErr: ErrInvalidSignature,
+		},
+		{name: "malformed signature", policy: Policy{Trust: trust}, digest: digest, sig: &Signature{Digest: digest, KeyID: sig.KeyID, Sig: "zz"}, wantErr: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyID, err := tt.policy.Check(tt.digest, tt.sig)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Check() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if tt.sig != nil && keyID != tt.sig.KeyID {
+				t.Errorf("Check() key id = %s, want %s", keyID, tt.sig.KeyID)
+			}
+		})
+	}
+
+	// trusting the other key too verifies its artifacts
+	data, err := os.ReadFile(filepath.Join(otherDir, PublicKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(keyDir, "other.pub"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trust.Verify(otherDigest, otherSig); err != nil {
+		t.Fatalf("Verify() by a newly trusted key error = %v", err)
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	_, digest, sig := newSignedPlugin(t)
+	data, err := sig.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSignature(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != *sig || parsed.Digest != digest {
+		t.Fatalf("ParseSignature() = %+v, want %+v", parsed, sig)
+	}
+	for _, data := range []string{`{`, `{"digest":"sha256:abc"}`, `{"digest":"sha256:` + hex.EncodeToString(make([]byte, 31)) + `zz"}`} {
+		if _, err := ParseSignature([]byte(data)); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("ParseSignature(%s) error = %v, want %v", data, err, ErrInvalidSignature)
+		}
+	}
+}
+
+func TestStorePut(t *testing.T) {
+	store := NewStore(t.TempDir())
+	refused := errors.New("refused")
+	if _, err := store.Put(strings.NewReader("plugin"), func(string) error { return refused }); !errors.Is(err, refused) {
+		t.Fatalf("Put() refused error = %v, want %v", err, refused)
+	}
+	digest, err := store.Put(strings.NewReader("plugin"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Verify(digest); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if err := os.Chmod(store.Path(digest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.Path(digest), []byte("replaced"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Verify(digest); err == nil {
+		t.Fatal("Verify() of a replaced artifact succeeded")
+	}
+	missing := DigestPrefix + hex.EncodeToString(make([]byte, 32))
+	if err := store.Verify(missing); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Verify() of a missing artifact error = %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,138 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DigestPrefix prefixes the hex SHA-256 of the digests
+	DigestPrefix = "sha256:"
+
+	pluginExt    = ".so"
+	signatureExt = ".sig"
+)
+
+var ErrNotFound = errors.New("plugin artifact not found")
+
+// ParseDigest validates a digest, sha256:<hex> or the bare hex, and returns it with the prefix
+func ParseDigest(digest string) (string, error) {
+	hexSum := strings.TrimPrefix(digest, DigestPrefix)
+	if len(hexSum) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid digest %q, sha256:<64 hex> is required", digest)
+	}
+	if _, err := hex.DecodeString(hexSum); err != nil {
+		return "", fmt.Errorf("invalid digest %q: %w", digest, err)
+	}
+	return DigestPrefix + strings.ToLower(hexSum), nil
+}
+
+// FileDigest is the digest of the content of the file
+func FileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return DigestPrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Store keeps the plugin artifacts under the digests of their content, the names given by the
+// uploaders are never used, so an artifact can't escape the dir or replace another one
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Path is the file of the artifact of the digest, it's opened by the go plugin loader
+func (s *Store) Path(digest string) string {
+	return filepath.Join(s.dir, strings.TrimPrefix(digest, DigestPrefix)+pluginExt)
+}
+
+func (s *Store) signaturePath(digest string) string {
+	return filepath.Join(s.dir, strings.TrimPrefix(digest, DigestPrefix)+signatureExt)
+}
+
+// Put stores the content if check accepts its digest, the content is staged in the dir and only
+// moved to its path once it's accepted, an existing artifact of the digest is kept as it is
+func (s *Store) Put(r io.Reader, check func(digest string) error) (string, error) {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", err
+	}
+	staged, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(staged.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(staged, hash), r)
+	if closeErr := staged.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	digest := DigestPrefix + hex.EncodeToString(hash.Sum(nil))
+	if check != nil {
+		if err := check(digest); err != nil {
+			return "", err
+		}
+	}
+	if _, err := os.Stat(s.Path(digest)); err == nil {
+		return digest, nil
+	}
+	if err := os.Chmod(staged.Name(), 0o500); err != nil {
+		return "", err
+	}
+	return digest, os.Rename(staged.Name(), s.Path(digest))
+}
+
+// PutSignature keeps the signature next to the artifact, so the artifact can be verified again on restore
+func (s *Store) PutSignature(sig *Signature) error {
+	data, err := sig.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.signaturePath(sig.Digest), data, 0o600)
+}
+
+// Signature reads the signature kept for the artifact, nil if it's unsigned
+func (s *Store) Signature(digest string) (*Signature, error) {
+	data, err := os.ReadFile(s.signaturePath(digest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseSignature(data)
+}
+
+// Verify checks the artifact of the digest exists and its content still has the digest
+func (s *Store) Verify(digest string) error {
+	actual, err := FileDigest(s.Path(digest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, digest)
+	}
+	if err != nil {
+		return err
+	}
+	if actual != digest {
+		return fmt.Errorf("plugin artifact %s is corrupted, its content has digest %s", digest, actual)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package audit
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+	// StatusDenied is an unauthenticated or unauthorized request, or a tool call the policies denied
+	StatusDenied = "denied"
+
+	// Redacted replaces the values of the redacted arguments
+	Redacted = "[REDACTED]"
+)
+
+// DefaultRedactKeys are redacted from the arguments of every entry, a key is redacted
+// if it contains one of them, case insensitively
+var DefaultRedactKeys = []string{"password", "passwd", "secret", "token", "authorization", "api_key", "apikey", "private_key", "credential"}
+
+// redactCollections are redacted if the key is exactly one of them and the value is a map or a list,
+// e.g. the env and the headers of an upstream carry credentials but an env label doesn't
+var redactCollections = []string{"env", "headers"}
+
+// Entry is a record of an admin action or a tool invocation
+type Entry struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Actor is the token or the identity of the admin api, or the subject of the tool caller, anonymous if unknown
+	Actor string `json:"actor"`
+	// Action is e.g. server.create or tool.call
+	Action string `json:"action"`
+	Server string `json:"server,omitempty"`
+	Tool   string `json:"tool,omitempty"`
+	// Target is the name of the other object of the action, e.g. a token or a policy
+	Target    string         `json:"target,omitempty"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+	Status    string         `json:"status"`
+	Error     string         `json:"error,omitempty"`
+	// LatencyMs is the duration of the action in milliseconds
+	LatencyMs  float64 `json:"latency_ms"`
+	RemoteAddr string  `json:"remote_addr,omitempty"`
+}
+
+// Sink receives the entries, e.g. a rotated file or a log collector
+type Sink interface {
+	Write(entry Entry) error
+	Close() error
+}
+
+// Querier is a sink the entries can be queried from
+type Querier interface {
+	Query(filter Filter) ([]Entry, error)
+}
+
+// Filter selects the entries, the empty fields match every entry
+type Filter struct {
+	Actor  string    `json:"actor,omitempty"`
+	Action string    `json:"action,omitempty"`
+	Server string    `json:"server,omitempty"`
+	Tool   string    `json:"tool,omitempty"`
+	Status string    `json:"status,omitempty"`
+	Since  time.Time `json:"since,omitempty"`
+	Until  time.Time `json:"until,omitempty"`
+	// Limit keeps the latest entries, all of them if 0
+	Limit int `json:"limit,omitempty"`
+}
+
+func (f Filter) Matches(entry Entry) bool {
+	switch {
+	case f.Actor != "" && entry.Actor != f.Actor,
+		f.Action != "" && entry.Action != f.Action && !strings.HasPrefix(entry.Action, f.Action+"."),
+		f.Server != "" && entry.Server != f.Server,
+		f.Tool != "" && entry.Tool != f.Tool,
+		f.Status != "" && entry.Status != f.Status,
+		!f.Since.IsZero() && entry.Time.Before(f.Since),
+		!f.Until.IsZero() && entry.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+var ErrNotQueryable = errors.New("no audit sink can be queried")
+
+// Logger redacts the entries and writes them to every sink, a failing sink doesn't stop the others
+type Logger struct {
+	mu         sync.Mutex
+	sinks      []Sink
+	redactKeys []string
+}
+
+// NewLogger creates a logger redacting the default keys and the extra ones
+func NewLogger(redactKeys []string, sinks ...Sink) *Logger {
+	keys := append([]string{}, DefaultRedactKeys...)
+	for _, key := range redactKeys {
+		keys = append(keys, strings.ToLower(key))
+	}
+	return &Logger{sinks: sinks, redactKeys: keys}
+}
+
+// Record fills the id and the time of the entry if they are empty and writes it
+func (l *Logger) Record(entry Entry) {
+	if l == nil {
+		return
+	}
+	if entry.ID == "" {
+		entry.ID = uuid.NewString()
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.Actor == "" {
+		entry.Actor = "anonymous"
+	}
+	entry.Arguments = l.Redact(entry.Arguments)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, sink := range l.sinks {
+		if err := sink.Write(entry); err != nil {
+			logrus.WithError(err).Error("failed to write audit entry")
+		}
+	}
+}
+
+// Query queries the first sink which can be queried
+func (l *Logger) Query(filter Filter) ([]Entry, error) {
+	for _, sink := range l.sinks {
+		if querier, ok := sink.(Querier); ok {
+			return querier.Query(filter)
+		}
+	}
+	return nil, ErrNotQueryable
+}
+
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var errs []error
+	for _, sink := range l.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Redact copies the arguments with the values of the sensitive keys replaced, recursively
+func (l *Logger) Redact(args map[string]any) map[string]any {
+	if args == nil {
+		return nil
+	}
+	redacted := make(map[string]any, len(args))
+	for key, value := range args {
+		if l.sensitive(key, value) {
+			redacted[key] = Redacted
+			continue
+		}
+		redacted[key] = l.redactValue(value)
+	}
+	return redacted
+}
+
+func (l *Logger) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return l.Redact(v)
+	case []any:
+		values := make([]any, len(v))
+		for i, item := range v {
+			values[i] = l.redactValue(item)
+		}
+		return values
+	default:
+		return value
+	}
+}
+
+func (l *Logger) sensitive(key string, value any) bool {
+	key = strings.ToLower(key)
+	switch value.(type) {
+	case map[string]any, []any:
+		if slices.Contains(redactCollections, key) {
+			return true
+		}
+	}
+	for _, redactKey := range l.redactKeys {
+		if strings.Contains(key, redactKey) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRedact(t *testing.T) {
+	logger := NewLogger([]string{"SSN"})
+	tests := []struct {
+		name string
+		args map[string]any
+		want map[string]any
+	}{
+		{name: "nil", args: nil, want: nil},
+		{
+			name: "plain arguments",
+			args: map[string]any{"path": "/tmp/x", "limit": 10.0},
+			want: map[string]any{"path": "/tmp/x", "limit": 10.0},
+		},
+		{
+			name: "default keys",
+			args: map[string]any{"password": "p", "api_key": "k", "token": "t", "private_key": "pk", "credentials": []any{"c"}},
+			want: map[string]any{"password": Redacted, "api_key": Redacted, "token": Redacted, "private_key": Redacted, "credentials": Redacted},
+		},
+		{
+			// a key containing a redacted key is redacted, case insensitively
+			name: "containing keys",
+			args: map[string]any{"DB_PASSWORD": "p", "accessToken": "t", "Authorization": "Bearer x", "client_secret": "s"},
+			want: map[string]any{"DB_PASSWORD": Redacted, "accessToken": Redacted, "Authorization": Redacted, "client_secret": Redacted},
+		},
+		{
+			name: "extra keys",
+			args: map[string]any{"ssn": "123", "user_ssn": "456", "name": "alice"},
+			want: map[string]any{"ssn": Redacted, "user_ssn": Redacted, "name": "alice"},
+		},
+		{
+			name: "nested maps",
+			args: map[string]any{"db": map[string]any{"host": "h", "password": "p"}},
+			want: map[string]any{"db": map[string]any{"host": "h", "password": Redacted}},
+		},
+		{
+			name: "maps in lists",
+			args: map[string]any{"users": []any{map[string]any{"name": "a", "token": "t"}, "b"}},
+			want: map[string]any{"users": []any{map[string]any{"name": "a", "token": Redacted}, "b"}},
+		},
+		{
+			// the env and the headers of an upstream carry credentials under any name
+			name: "collections",
+			args: map[string]any{
+				"upstream": map[string]any{
+					"env":     map[string]any{"DB_URL": "postgres://u:p@h/db"},
+					"headers": map[string]any{"X-Custom": "v"},
+					"args":    []any{"--verbose"},
+				},
+			},
+			want: map[string]any{
+				"upstream": map[string]any{
+					"env":     Redacted,
+					"headers": Redacted,
+					"args":    []any{"--verbose"},
+				},
+			},
+		},
+		{
+			name: "env label",
+			args: map[string]any{"labels": map[string]any{"env": "prod"}},
+			want: map[string]any{"labels": map[string]any{"env": "prod"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logger.Redact(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Redact() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactKeepsArguments(t *testing.T) {
+	args := map[string]any{"password": "p", "db": map[string]any{"token": "t"}}
+	NewLogger(nil).Redact(args)
+	if args["password"] != "p" || args["db"].(map[string]any)["token"] != "t" {
+		t.Fatalf("Redact() changed the arguments: %v", args)
+	}
+}
+
+type memorySink struct {
+	entries []Entry
+}
+
+func (s *memorySink) Write(entry Entry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func TestRecord(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(nil, sink)
+	logger.Record(Entry{Action: "tool.call", Arguments: map[string]any{"password": "p", "path": "/tmp"}})
+	if len(sink.entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(sink.entries))
+	}
+	entry := sink.entries[0]
+	if entry.ID == "" || entry.Time.IsZero() || entry.Actor != "anonymous" {
+		t.Errorf("Record() entry = %+v, want the id, the time and the actor filled", entry)
+	}
+	if want := map[string]any{"password": Redacted, "path": "/tmp"}; !reflect.DeepEqual(entry.Arguments, want) {
+		t.Errorf("Record() arguments = %v, want %v", entry.Arguments, want)
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	now := time.Now()
+	entry := Entry{Actor: "token admin", Action: "server.create", Server: "s", Status: StatusSuccess, Time: now}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "empty", filter: Filter{}, want: true},
+		{name: "action", filter: Filter{Action: "server.create"}, want: true},
+		{name: "action prefix", filter: Filter{Action: "server"}, want: true},
+		{name: "partial action", filter: Filter{Action: "serv"}, want: false},
+		{name: "other server", filter: Filter{Server: "t"}, want: false},
+		{name: "status", filter: Filter{Status: StatusDenied}, want: false},
+		{name: "since", filter: Filter{Since: now.Add(time.Second)}, want: false},
+		{name: "until", filter: Filter{Until: now.Add(-time.Second)}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(entry); got != tt.want {
+				t.Fatalf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
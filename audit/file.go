@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/jyz0309/omcp/rotate"
+)
+
+const (
+	DefaultMaxSize    = 100 << 20
+	DefaultMaxBackups = 10
+)
+
+// FileSink appends the entries as json lines to a file, the file is rotated to file.1, file.2 and so on
+// once it exceeds the max size, the oldest backups beyond the max backups are removed
+type FileSink struct {
+	file *rotate.File
+}
+
+// NewFileSink opens the file for appending, the defaults are used for the max size and backups if they are 0
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = DefaultMaxBackups
+	}
+	file, err := rotate.Open(path, maxSize, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Query reads the backups and the file from the oldest to the latest entry, the writes go on meanwhile
+// so a rotation in the middle of a query may skip or repeat some entries
+func (s *FileSink) Query(filter Filter) ([]Entry, error) {
+	var entries []Entry
+	for _, path := range s.file.Paths() {
+		var err error
+		if entries, err = readEntries(path, filter, entries); err != nil {
+			return nil, err
+		}
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+func readEntries(path string, filter Filter, entries []Entry) ([]Entry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var entry Entry
+		// a torn line of a crash doesn't hide the other entries
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// WriterSink writes the entries as json lines to a writer, e.g. stdout collected by a log shipper
+type WriterSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{encoder: json.NewEncoder(w)}
+}
+
+func (s *WriterSink) Write(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(entry)
+}
+
+func (s *WriterSink) Close() error {
+	return nil
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jyz0309/omcp/mcp"
+)
+
+// ClientKeyPrefix marks the client keys, a key is omcpk_<id>_<secret>
+const ClientKeyPrefix = "omcpk_"
+
+var (
+	ErrClientKeyRequired = errors.New("client key required")
+	ErrInvalidClientKey  = errors.New("invalid client key")
+)
+
+// ClientKey lets a MCP client connect to a managed server, the server requires a key
+// once it has one, even after it's revoked or expired, the scope restricts the tools and resources of the client
+type ClientKey struct {
+	Token
+	Server string          `json:"server"`
+	Scope  mcp.ClientScope `json:"scope"`
+}
+
+// ClientKeyPersister persists the client keys, it's called after every change
+type ClientKeyPersister interface {
+	SaveClientKey(key *ClientKey) error
+	DeleteClientKey(id string) error
+}
+
+// ClientKeys issues and verifies the client keys of the managed servers,
+// it's safe to be used from multiple goroutines
+type ClientKeys struct {
+	mu        sync.RWMutex
+	keys      map[string]*ClientKey
+	persister ClientKeyPersister
+}
+
+// NewClientKeys creates an empty set of keys, the persister can be nil to keep them in memory only
+func NewClientKeys(persister ClientKeyPersister) *ClientKeys {
+	return &ClientKeys{keys: make(map[string]*ClientKey), persister: persister}
+}
+
+// Add adds existing keys without persisting them, e.g. the restored ones
+func (k *ClientKeys) Add(keys ...*ClientKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range keys {
+		k.keys[key.ID] = key
+	}
+}
+
+// Create issues a key of the server which never expires if ttl is 0, the secret is returned only once
+func (k *ClientKeys) Create(server, name string, scope mcp.ClientScope, ttl time.Duration) (string, ClientKey, error) {
+	if server == "" {
+		return "", ClientKey{}, errors.New("server of the client key is required")
+	}
+	if name == "" {
+		return "", ClientKey{}, errors.New("client key name is required")
+	}
+	if ttl < 0 {
+		return "", ClientKey{}, errors.New("client key ttl can't be negative")
+	}
+	if err := scope.Validate(); err != nil {
+		return "", ClientKey{}, err
+	}
+	id, err := randomHex(4)
+	if err != nil {
+		return "", ClientKey{}, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", ClientKey{}, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := time.Now()
+	if k.activeKey(server, name, now) != nil {
+		return "", ClientKey{}, fmt.Errorf("%w: %s", ErrTokenExists, name)
+	}
+	if _, exist := k.keys[id]; exist {
+		return "", ClientKey{}, fmt.Errorf("%w: %s", ErrTokenExists, id)
+	}
+	key := &ClientKey{
+		Token:  Token{ID: id, Name: name, Hash: hash(secret), CreatedAt: now},
+		Server: server,
+		Scope:  scope,
+	}
+	if ttl > 0 {
+		key.ExpiresAt = now.Add(ttl)
+	}
+	if err := k.save(key); err != nil {
+		return "", ClientKey{}, err
+	}
+	k.keys[id] = key
+	return ClientKeyPrefix + id + "_" + secret, key.public(), nil
+}
+
+// List returns the keys of the server without their hashes, sorted by creation, all the keys if server is empty
+func (k *ClientKeys) List(server string) []ClientKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := make([]ClientKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		if server == "" || key.Server == server {
+			keys = append(keys, key.public())
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+// Required reports whether the server has a key, so its clients must present one, the revoked and the expired
+// keys count as well so revoking the last key denies every client instead of opening the server to all of them
+func (k *ClientKeys) Required(server string) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.Server == server {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoke revokes the active key of the name or the key of the id of the server
+func (k *ClientKeys) Revoke(server, nameOrID string) (ClientKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key := k.activeKey(server, nameOrID, time.Now())
+	if key == nil {
+		if byID, exist := k.keys[nameOrID]; exist && byID.Server == server {
+			key = byID
+		}
+	}
+	for _, candidate := range k.keys {
+		if key == nil && candidate.Server == server && candidate.Name == nameOrID {
+			key = candidate
+		}
+	}
+	if key == nil {
+		return ClientKey{}, fmt.Errorf("%w: %s", ErrTokenNotFound, nameOrID)
+	}
+	if !key.RevokedAt.IsZero() {
+		return ClientKey{}, fmt.Errorf("%w: %s", ErrTokenRevoked, nameOrID)
+	}
+	revoked := *key
+	revoked.RevokedAt = time.Now()
+	if err := k.save(&revoked); err != nil {
+		return ClientKey{}, err
+	}
+	*key = revoked
+	return key.public(), nil
+}
+
+// DeleteServer deletes the keys of a deleted server, so they don't apply to a new server of the name
+func (k *ClientKeys) DeleteServer(server string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var errs []error
+	for id, key := range k.keys {
+		if key.Server != server {
+			continue
+		}
+		if k.persister != nil {
+			if err := k.persister.DeleteClientKey(id); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		delete(k.keys, id)
+	}
+	return errors.Join(errs...)
+}
+
+// Verify checks the raw key is an active key of the server and returns it, the last use is recorded
+func (k *ClientKeys) Verify(server, raw string) (ClientKey, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(raw, ClientKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(raw, ClientKeyPrefix) {
+		return ClientKey{}, ErrInvalidClientKey
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, exist := k.keys[id]
+	if !exist || key.Server != server || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash(secret))) != 1 {
+		return ClientKey{}, ErrInvalidClientKey
+	}
+	now := time.Now()
+	if !key.RevokedAt.IsZero() {
+		return ClientKey{}, ErrTokenRevoked
+	}
+	if key.expired(now) {
+		return ClientKey{}, ErrTokenExpired
+	}
+	if now.Sub(key.LastUsedAt) > lastUsedInterval {
+		key.LastUsedAt = now
+		// the last use is informative, a failed write doesn't reject the key
+		_ = k.save(key)
+	}
+	return key.public(), nil
+}
+
+// activeKey returns the active key of the name of the server, the caller must hold k.mu
+func (k *ClientKeys) activeKey(server, name string, now time.Time) *ClientKey {
+	for _, key := range k.keys {
+		if key.Server == server && key.Name == name && key.active(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+func (k *ClientKeys) save(key *ClientKey) error {
+	if k.persister == nil {
+		return nil
+	}
+	return k.persister.SaveClientKey(key)
+}
+
+func (k *ClientKey) public() ClientKey {
+	key := *k
+	key.Hash = ""
+	return key
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jyz0309/omcp/mcp"
+)
+
+func TestClientKeysVerify(t *testing.T) {
+	keys := NewClientKeys(nil)
+	raw, created, err := keys.Create("a", "agent", mcp.ClientScope{Tools: []string{"search_*"}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRaw, _, err := keys.Create("b", "agent", mcp.ClientScope{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, secret, _ := strings.Cut(strings.TrimPrefix(raw, ClientKeyPrefix), "_")
+	keys.Add(
+		&ClientKey{Token: Token{ID: "expired", Name: "expired", Hash: hash(secret), ExpiresAt: time.Now().Add(-time.Minute)}, Server: "a"},
+		&ClientKey{Token: Token{ID: "revoked", Name: "revoked", Hash: hash(secret), RevokedAt: time.Now()}, Server: "a"},
+	)
+
+	tests := []struct {
+		name    string
+		server  string
+		raw     string
+		wantErr error
+	}{
+		{name: "valid", server: "a", raw: raw},
+		// a key only opens the server it's issued for
+		{name: "key of another server", server: "a", raw: otherRaw, wantErr: ErrInvalidClientKey},
+		{name: "key on another server", server: "b", raw: raw, wantErr: ErrInvalidClientKey},
+		{name: "wrong secret", server: "a", raw: ClientKeyPrefix + id + "_" + strings.Repeat("0", len(secret)), wantErr: ErrInvalidClientKey},
+		{name: "admin token prefix", server: "a", raw: TokenPrefix + id + "_" + secret, wantErr: ErrInvalidClientKey},
+		{name: "malformed", server: "a", raw: ClientKeyPrefix + id, wantErr: ErrInvalidClientKey},
+		{name: "expired", server: "a", raw: ClientKeyPrefix + "expired_" + secret, wantErr: ErrTokenExpired},
+		{name: "revoked", server: "a", raw: ClientKeyPrefix + "revoked_" + secret, wantErr: ErrTokenRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := keys.Verify(tt.server, tt.raw)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if key.ID != created.ID || key.Hash != "" {
+				t.Errorf("Verify() = %+v, want key %s without its hash", key, created.ID)
+			}
+			if !key.Scope.AllowsTool("search_docs") || key.Scope.AllowsTool("delete_docs") {
+				t.Errorf("Verify() scope = %+v, want the tools search_*", key.Scope)
+			}
+		})
+	}
+}
+
+func TestClientKeysList(t *testing.T) {
+	persister := newMemoryPersister()
+	keys := NewClientKeys(persister)
+	for i, server := range []string{"a", "a", "b"} {
+		if _, _, err := keys.Create(server, fmt.Sprintf("agent-%d", i), mcp.ClientScope{}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := keys.Create("a", "bad", mcp.ClientScope{Tools: []string{"["}}, 0); err == nil {
+		t.Fatal("Create() with an invalid scope succeeded")
+	}
+	count := func(server string) int {
+		listed := keys.List(server)
+		if slices.ContainsFunc(listed, func(key ClientKey) bool { return key.Hash != "" || (server != "" && key.Server != server) }) {
+			t.Fatalf("List(%q) = %+v, want the keys of the server without their hashes", server, listed)
+		}
+		return len(listed)
+	}
+	if a, b, all := count("a"), count("b"), count(""); a != 2 || b != 1 || all != 3 {
+		t.Fatalf("List() counts a = %d, b = %d, all = %d, want 2, 1, 3", a, b, all)
+	}
+
+	// the keys of a deleted server don't apply to a new server of the name
+	if err := keys.DeleteServer("a"); err != nil {
+		t.Fatal(err)
+	}
+	if count("a") != 0 || keys.Required("a") || len(persister.keys) != 1 {
+		t.Fatalf("DeleteServer() left %d keys, %d persisted", count("a"), len(persister.keys))
+	}
+}
+
+func TestClientKeysRequired(t *testing.T) {
+	keys := NewClientKeys(nil)
+	if keys.Required("a") {
+		t.Fatal("Required() = true without keys")
+	}
+	if _, _, err := keys.Create("a", "agent", mcp.ClientScope{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !keys.Required("a") || keys.Required("b") {
+		t.Fatalf("Required() = %v for the server of the key, %v for another server", keys.Required("a"), keys.Required("b"))
+	}
+	if _, _, err := keys.Create("a", "agent", mcp.ClientScope{}, 0); !errors.Is(err, ErrTokenExists) {
+		t.Fatalf("Create() with the name of an active key error = %v, want %v", err, ErrTokenExists)
+	}
+
+	// revoking the last key denies the clients instead of opening the server
+	if _, err := keys.Revoke("a", "agent"); err != nil {
+		t.Fatal(err)
+	}
+	if !keys.Required("a") {
+		t.Fatal("Required() = false once the last key is revoked")
+	}
+	keys.Add(&ClientKey{Token: Token{ID: "expired", Name: "expired", ExpiresAt: time.Now().Add(-time.Minute)}, Server: "c"})
+	if !keys.Required("c") {
+		t.Fatal("Required() = false with only an expired key")
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	IssuerKeyFile  = "issuer.key"
+	IssuerJWKSFile = "jwks.json"
+)
+
+// GenerateIssuerKey writes the Ed25519 signing key of a local test issuer and its jwks into the dir,
+// the jwks file is referenced by the oauth config to validate the tokens signed by SignToken
+func GenerateIssuerKey(dir string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(public)
+	set := JWKSet{Keys: []JWK{{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		Kid: hex.EncodeToString(sum[:8]),
+		Use: "sig",
+		Alg: "EdDSA",
+		X:   base64.RawURLEncoding.EncodeToString(public),
+	}}}
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, IssuerKeyFile), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, IssuerJWKSFile), data, 0o644)
+}
+
+// TokenClaims are the claims of a token signed by the local test issuer
+type TokenClaims struct {
+	Issuer   string
+	Subject  string
+	Audience []string
+	Scopes   []string
+	Groups   []string
+	TTL      time.Duration
+}
+
+// SignToken signs a token with the key written by GenerateIssuerKey
+func SignToken(keyFile string, claims TokenClaims) (string, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", errors.New("invalid issuer key, a PEM encoded key is required")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", errors.New("invalid issuer key, an Ed25519 key is required")
+	}
+	sum := sha256.Sum256(private.Public().(ed25519.PublicKey))
+
+	now := time.Now()
+	mapClaims := jwt.MapClaims{
+		"iss": claims.Issuer,
+		"sub": claims.Subject,
+		"aud": claims.Audience,
+		"iat": now.Unix(),
+		"exp": now.Add(claims.TTL).Unix(),
+	}
+	if len(claims.Scopes) > 0 {
+		mapClaims[DefaultScopesClaim] = strings.Join(claims.Scopes, " ")
+	}
+	if len(claims.Groups) > 0 {
+		mapClaims[DefaultGroupsClaim] = claims.Groups
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, mapClaims)
+	token.Header["kid"] = hex.EncodeToString(sum[:8])
+	return token.SignedString(private)
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jyz0309/omcp/mcp"
+)
+
+const (
+	DefaultScopesClaim = "scope"
+	DefaultGroupsClaim = "groups"
+
+	// tokenLeeway tolerates the clock skew between omcp and the issuers
+	tokenLeeway = 30 * time.Second
+)
+
+var (
+	ErrUnknownIssuer = errors.New("unknown token issuer")
+
+	// signingMethods are the algorithms accepted from the issuers, the symmetric ones are never accepted
+	signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+)
+
+// OAuthConfig configures the validation of the bearer tokens presented to the MCP endpoints
+type OAuthConfig struct {
+	// Resource identifies omcp as a protected resource, it's the default audience of the tokens
+	Resource string `json:"resource"`
+	// Required rejects the MCP requests without a bearer token, otherwise they are anonymous
+	Required        bool           `json:"required"`
+	ScopesSupported []string       `json:"scopes_supported,omitempty"`
+	Issuers         []IssuerConfig `json:"issuers"`
+	// Roles bind the roles of the admin api to the identities, an identity without a role can't use it
+	Roles []IdentityRole `json:"roles,omitempty"`
+}
+
+// IdentityRole binds a role to the identities of the subject or the group
+type IdentityRole struct {
+	Subject string `json:"subject,omitempty"`
+	Group   string `json:"group,omitempty"`
+	RoleBinding
+}
+
+// IssuerConfig is an authorization server trusted to issue the tokens
+type IssuerConfig struct {
+	Issuer string `json:"issuer"`
+	// JWKSFile or JWKSURL provides the signing keys of the issuer
+	JWKSFile string `json:"jwks_file,omitempty"`
+	JWKSURL  string `json:"jwks_url,omitempty"`
+	// Audiences are the accepted audiences, the resource if empty
+	Audiences []string `json:"audiences,omitempty"`
+	// ScopesClaim holds the space separated scopes or a list of them, scope by default
+	ScopesClaim string `json:"scopes_claim,omitempty"`
+	// GroupsClaim holds the groups of the subject, groups by default
+	GroupsClaim string `json:"groups_claim,omitempty"`
+}
+
+// ProtectedResourceMetadata is the OAuth 2.0 protected resource metadata document of RFC 9728
+type ProtectedResourceMetadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+}
+
+// LoadOAuthConfig reads the json config file
+func LoadOAuthConfig(path string) (*OAuthConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config OAuthConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse oauth config %s: %w", path, err)
+	}
+	return &config, config.Validate()
+}
+
+func (c *OAuthConfig) Validate() error {
+	if c.Resource == "" {
+		return errors.New("resource of the oauth config is required")
+	}
+	if len(c.Issuers) == 0 {
+		return errors.New("at least one issuer of the oauth config is required")
+	}
+	for i, issuer := range c.Issuers {
+		if issuer.Issuer == "" {
+			return errors.New("issuer of the oauth config is required")
+		}
+		if (issuer.JWKSFile == "") == (issuer.JWKSURL == "") {
+			return fmt.Errorf("either jwks_file or jwks_url of issuer %s is required", issuer.Issuer)
+		}
+		for _, other := range c.Issuers[:i] {
+			if other.Issuer == issuer.Issuer {
+				return fmt.Errorf("duplicated issuer: %s", issuer.Issuer)
+			}
+		}
+	}
+	return validateIdentityRoles(c.Roles)
+}
+
+type issuer struct {
+	config IssuerConfig
+	keys   *keySet
+}
+
+// Validator validates the bearer tokens against the configured issuers and maps their claims onto identities
+type Validator struct {
+	config  OAuthConfig
+	issuers map[string]*issuer
+}
+
+func NewValidator(config *OAuthConfig) (*Validator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	v := &Validator{config: *config, issuers: make(map[string]*issuer, len(config.Issuers))}
+	for _, c := range config.Issuers {
+		if len(c.Audiences) == 0 {
+			c.Audiences = []string{config.Resource}
+		}
+		if c.ScopesClaim == "" {
+			c.ScopesClaim = DefaultScopesClaim
+		}
+		if c.GroupsClaim == "" {
+			c.GroupsClaim = DefaultGroupsClaim
+		}
+		v.issuers[c.Issuer] = &issuer{config: c, keys: newKeySet(c.JWKSFile, c.JWKSURL)}
+	}
+	return v, nil
+}
+
+// Required reports whether the MCP requests must present a bearer token
+func (v *Validator) Required() bool {
+	return v.config.Required
+}
+
+func (v *Validator) Metadata() ProtectedResourceMetadata {
+	servers := make([]string, 0, len(v.config.Issuers))
+	for _, issuer := range v.config.Issuers {
+		servers = append(servers, issuer.Issuer)
+	}
+	return ProtectedResourceMetadata{
+		Resource:               v.config.Resource,
+		AuthorizationServers:   servers,
+		BearerMethodsSupported: []string{"header"},
+		ScopesSupported:        v.config.ScopesSupported,
+	}
+}
+
+// Validate verifies the signature, issuer, audience and lifetime of the token and returns its identity
+func (v *Validator) Validate(ctx context.Context, raw string) (*mcp.Identity, error) {
+	unverified := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, unverified); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	iss, _ := unverified.GetIssuer()
+	issuer, ok := v.issuers[iss]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownIssuer, iss)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return issuer.keys.key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(iss),
+		jwt.WithAudience(issuer.config.Audiences...),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(tokenLeeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("%w: sub claim is required", ErrInvalidToken)
+	}
+	return &mcp.Identity{
+		Subject: subject,
+		Issuer:  iss,
+		Scopes:  claimStrings(claims[issuer.config.ScopesClaim]),
+		Groups:  claimStrings(claims[issuer.config.GroupsClaim]),
+		Claims:  claims,
+	}, nil
+}
+
+// Principal is the caller of the admin api authenticated by the identity, with the roles bound to its subject or groups
+func (v *Validator) Principal(identity *mcp.Identity) Principal {
+	return Principal{Name: "identity " + identity.Subject, Roles: identityRoles(identity, v.config.Roles)}
+}
+
+// identityRoles are the roles bound to the subject or the groups of the identity
+func identityRoles(identity *mcp.Identity, roles []IdentityRole) RoleBindings {
+	var bindings RoleBindings
+	for _, role := range roles {
+		if role.Subject != "" && role.Subject == identity.Subject || role.Group != "" && identity.InGroup(role.Group) {
+			bindings = append(bindings, role.RoleBinding)
+		}
+	}
+	return bindings
+}
+
+func validateIdentityRoles(roles []IdentityRole) error {
+	for _, role := range roles {
+		if (role.Subject == "") == (role.Group == "") {
+			return fmt.Errorf("either subject or group of role %s is required", role.Role)
+		}
+		if err := role.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimStrings reads a space separated string or a list of strings
+func claimStrings(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testResource = "https://omcp.example.com"
+)
+
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+// newTestValidator trusts the issuer with a jwks file of a RSA key k1 and an Ed25519 key k2
+func newTestValidator(t *testing.T) (*Validator, testKeys) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := JWKSet{Keys: []JWK{
+		{
+			Kty: "RSA",
+			Kid: "k1",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{
+			Kty: "OKP",
+			Kid: "k2",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(edPub),
+		},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	validator, err := NewValidator(&OAuthConfig{
+		Resource: testResource,
+		Issuers:  []IssuerConfig{{Issuer: testIssuer, JWKSFile: jwksFile}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return validator, testKeys{rsa: rsaKey, ed25519: edKey}
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    testIssuer,
+		"sub":    "alice",
+		"aud":    testResource,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"scope":  "tools:read tools:call",
+		"groups": []string{"team-a"},
+	}
+}
+
+// validClaimsWith are the valid claims with the claim set to the value, or without the claim if the value is nil
+func validClaimsWith(key string, value any) jwt.MapClaims {
+	claims := validClaims()
+	if value == nil {
+		delete(claims, key)
+	} else {
+		claims[key] = value
+	}
+	return claims
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims, key any) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestValidatorValidate(t *testing.T) {
+	validator, keys := newTestValidator(t)
+	pubDER, err := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr error
+	}{
+		{
+			name:  "valid rsa token",
+			token: func() string { return sign(t, jwt.SigningMethodRS256, "k1", validClaims(), keys.rsa) },
+		},
+		{
+			name:  "valid ed25519 token",
+			token: func() string { return sign(t, jwt.SigningMethodEdDSA, "k2", validClaims(), keys.ed25519) },
+		},
+		{
+			// the public key of the jwks used as the hmac secret must not verify
+			name:    "hmac signed with the public key",
+			token:   func() string { return sign(t, jwt.SigningMethodHS256, "k1", validClaims(), pubPEM) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "hmac signed with the modulus",
+			token:   func() string { return sign(t, jwt.SigningMethodHS256, "k1", validClaims(), keys.rsa.N.Bytes()) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "alg none",
+			token: func() string {
+				return sign(t, jwt.SigningMethodNone, "k1", validClaims(), jwt.UnsafeAllowNoneSignatureType)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				return sign(t, jwt.SigningMethodRS256, "k1", validClaimsWith("aud", "https://other.example.com"), keys.rsa)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "missing audience",
+			token:   func() string { return sign(t, jwt.SigningMethodRS256, "k1", validClaimsWith("aud", nil), keys.rsa) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "expired beyond the leeway",
+			token: func() string {
+				return sign(t, jwt.SigningMethodRS256, "k1", validClaimsWith("exp", time.Now().Add(-time.Minute).Unix()), keys.rsa)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "expired within the leeway",
+			token: func() string {
+				return sign(t, jwt.SigningMethodRS256, "k1", validClaimsWith("exp", time.Now().Add(-5*time.Second).Unix()), keys.rsa)
+			},
+		},
+		{
+			name:    "missing expiration",
+			token:   func() string { return sign(t, jwt.SigningMethodRS256, "k1", validClaimsWith("exp", nil), keys.rsa) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "not valid yet",
+			token: func() string {
+				return sign(t, jwt.SigningMethodRS256, "k1", validClaimsWith("nbf", time.Now().Add(time.Hour).Unix()), keys.rsa)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "unknown issuer",
+			token: func() string {
+				return sign(t, jwt.SigningMethodRS256, "k1", validClaimsWith("iss", "https://evil.example.com"), keys.rsa)
+			},
+			wantErr: ErrUnknownIssuer,
+		},
+		{
+			name:    "unknown kid",
+			token:   func() string { return sign(t, jwt.SigningMethodRS256, "k3", validClaims(), keys.rsa) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			// the set has two keys, so a token without a kid can't pick one
+			name:    "missing kid",
+			token:   func() string { return sign(t, jwt.SigningMethodRS256, "", validClaims(), keys.rsa) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "signed by the key of another kid",
+			token:   func() string { return sign(t, jwt.SigningMethodEdDSA, "k1", validClaims(), keys.ed25519) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "signed by an untrusted key",
+			token: func() string {
+				other, err := rsa.GenerateKey(rand.Reader, 2048)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return sign(t, jwt.SigningMethodRS256, "k1", validClaims(), other)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "tampered payload",
+			token: func() string {
+				parts := strings.Split(sign(t, jwt.SigningMethodRS256, "k1", validClaims(), keys.rsa), ".")
+				claims := validClaims()
+				claims["sub"] = "admin"
+				payload, err := json.Marshal(claims)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+				return strings.Join(parts, ".")
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "tampered signature",
+			token: func() string {
+				raw := sign(t, jwt.SigningMethodRS256, "k1", validClaims(), keys.rsa)
+				last := raw[len(raw)-2]
+				flipped := byte('A')
+				if last == 'A' {
+					flipped = 'B'
+				}
+				return raw[:len(raw)-2] + string(flipped) + raw[len(raw)-1:]
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "missing subject",
+			token:   func() string { return sign(t, jwt.SigningMethodRS256, "k1", validClaimsWith("sub", nil), keys.rsa) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "malformed token",
+			token:   func() string { return "not.a.token" },
+			wantErr: ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := validator.Validate(context.Background(), tt.token())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if identity.Subject != "alice" || identity.Issuer != testIssuer {
+				t.Errorf("Validate() identity = %s from %s, want alice from %s", identity.Subject, identity.Issuer, testIssuer)
+			}
+			if !identity.InGroup("team-a") || len(identity.Scopes) != 2 {
+				t.Errorf("Validate() groups = %v, scopes = %v", identity.Groups, identity.Scopes)
+			}
+		})
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	ecX, ecY := encode(ecKey.X.Bytes()), encode(ecKey.Y.Bytes())
+
+	tests := []struct {
+		name    string
+		jwk     JWK
+		wantErr bool
+	}{
+		{name: "ec key", jwk: JWK{Kty: "EC", Crv: "P-256", X: ecX, Y: ecY}},
+		{name: "ec point off the curve", jwk: JWK{Kty: "EC", Crv: "P-256", X: ecX, Y: encode([]byte{1, 2, 3})}, wantErr: true},
+		{name: "ec key of another curve", jwk: JWK{Kty: "EC", Crv: "P-384", X: ecX, Y: ecY}, wantErr: true},
+		{name: "unsupported curve", jwk: JWK{Kty: "EC", Crv: "secp256k1", X: ecX, Y: ecY}, wantErr: true},
+		{name: "encryption key", jwk: JWK{Kty: "EC", Use: "enc", Crv: "P-256", X: ecX, Y: ecY}, wantErr: true},
+		{name: "ed25519 key of a wrong size", jwk: JWK{Kty: "OKP", Crv: "Ed25519", X: encode(make([]byte, 16))}, wantErr: true},
+		{name: "x25519 key", jwk: JWK{Kty: "OKP", Crv: "X25519", X: encode(make([]byte, 32))}, wantErr: true},
+		{name: "rsa key without modulus", jwk: JWK{Kty: "RSA", E: "AQAB"}, wantErr: true},
+		{name: "symmetric key", jwk: JWK{Kty: "oct"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.jwk.PublicKey()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jyz0309/omcp/mcp"
+)
+
+type Role string
+
+const (
+	// RoleAdmin can do everything, including the tokens, the client keys and the plugin loading
+	RoleAdmin Role = "admin"
+	// RoleOperator can start and stop the servers, decide the approvals of their calls, read the history of the calls
+	// and follow the logs of the servers besides viewing them
+	RoleOperator Role = "operator"
+	// RoleViewer can list the servers and their tools, resources and prompts
+	RoleViewer Role = "viewer"
+	// RolePluginPublisher can add, update and delete the tools and resources of the servers besides viewing them,
+	// the resources served from the files of the host need an unscoped binding like the plugin loading
+	RolePluginPublisher Role = "plugin-publisher"
+)
+
+// KnownRoles are the roles which can be granted
+var KnownRoles = []Role{RoleAdmin, RoleOperator, RoleViewer, RolePluginPublisher}
+
+// Permission is an admin operation, the routes of the admin api require one
+type Permission string
+
+const (
+	PermServerList    Permission = "server:list"
+	PermServerCreate  Permission = "server:create"
+	PermServerDelete  Permission = "server:delete"
+	PermServerStart   Permission = "server:start"
+	PermServerStop    Permission = "server:stop"
+	PermToolList      Permission = "tool:list"
+	PermToolWrite     Permission = "tool:write"
+	PermResourceList  Permission = "resource:list"
+	PermResourceWrite Permission = "resource:write"
+	PermPromptList    Permission = "prompt:list"
+	PermPromptWrite   Permission = "prompt:write"
+	PermPolicyList    Permission = "policy:list"
+	PermPolicyWrite   Permission = "policy:write"
+	PermPluginLoad    Permission = "plugin:load"
+	PermTokenManage   Permission = "token:manage"
+	PermKeyManage     Permission = "key:manage"
+	PermAuditRead     Permission = "audit:read"
+	PermSecretManage  Permission = "secret:manage"
+	// PermApprovalList shows the arguments of the calls waiting for approval
+	PermApprovalList   Permission = "approval:list"
+	PermApprovalDecide Permission = "approval:decide"
+	// PermCallList shows the arguments and the results of the tool call history
+	PermCallList Permission = "call:list"
+	// PermServerLogs follows the log lines of a server, which carry the errors of its calls
+	PermServerLogs Permission = "server:logs"
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+var (
+	viewerPermissions = []Permission{PermServerList, PermToolList, PermResourceList, PermPromptList, PermPolicyList}
+
+	rolePermissions = map[Role][]Permission{
+		RoleViewer:          viewerPermissions,
+		RoleOperator:        append(slices.Clone(viewerPermissions), PermServerStart, PermServerStop, PermApprovalList, PermApprovalDecide, PermCallList, PermServerLogs),
+		RolePluginPublisher: append(slices.Clone(viewerPermissions), PermToolWrite, PermResourceWrite),
+	}
+)
+
+// globalPermissions are not about a server, only the unscoped bindings grant them, the plugin loading
+// runs native code in the OMCP process so it reaches beyond the servers as well
+var globalPermissions = []Permission{PermTokenManage, PermAuditRead, PermSecretManage, PermPluginLoad}
+
+// Grants reports whether the role has the permission
+func (r Role) Grants(perm Permission) bool {
+	return r == RoleAdmin || slices.Contains(rolePermissions[r], perm)
+}
+
+// RoleBinding grants a role, on every server unless it's scoped by the server patterns or the label selector,
+// a scoped binding only grants the permissions on the servers it selects
+type RoleBinding struct {
+	Role Role `json:"role"`
+	// Servers are path.Match patterns of the server names
+	Servers []string `json:"servers,omitempty"`
+	// Selector is a label selector of the servers, e.g. env=prod,team!=infra
+	Selector string `json:"selector,omitempty"`
+}
+
+func (b RoleBinding) Validate() error {
+	if !slices.Contains(KnownRoles, b.Role) {
+		return fmt.Errorf("unknown role: %s", b.Role)
+	}
+	for _, pattern := range b.Servers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid server pattern %q: %w", pattern, err)
+		}
+	}
+	_, err := mcp.ParseSelector(b.Selector)
+	return err
+}
+
+// Scoped reports whether the binding is restricted to some servers
+func (b RoleBinding) Scoped() bool {
+	return len(b.Servers) > 0 || strings.TrimSpace(b.Selector) != ""
+}
+
+// selects reports whether the binding applies to the server, the bindings are validated when they are created
+func (b RoleBinding) selects(server string, labels map[string]string) bool {
+	if len(b.Servers) > 0 && !slices.ContainsFunc(b.Servers, func(pattern string) bool {
+		matched, _ := path.Match(pattern, server)
+		return matched
+	}) {
+		return false
+	}
+	selector, err := mcp.ParseSelector(b.Selector)
+	return err == nil && selector.Matches(labels)
+}
+
+func (b RoleBinding) String() string {
+	var scope []string
+	if len(b.Servers) > 0 {
+		scope = append(scope, "servers="+strings.Join(b.Servers, "|"))
+	}
+	if b.Selector != "" {
+		scope = append(scope, "selector="+b.Selector)
+	}
+	if len(scope) == 0 {
+		return string(b.Role)
+	}
+	return string(b.Role) + "(" + strings.Join(scope, " ") + ")"
+}
+
+// RoleBindings are the roles of a token or an identity
+type RoleBindings []RoleBinding
+
+func (r RoleBindings) Validate() error {
+	for _, binding := range r {
+		if err := binding.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Grants reports whether any binding has the permission, on some servers at least
+func (r RoleBindings) Grants(perm Permission) bool {
+	global := slices.Contains(globalPermissions, perm)
+	return slices.ContainsFunc(r, func(b RoleBinding) bool {
+		return b.Role.Grants(perm) && (!global || !b.Scoped())
+	})
+}
+
+// Allows reports whether the permission is granted on the server, the permissions which are not
+// about a server, e.g. the token management, are only granted by the unscoped bindings
+func (r RoleBindings) Allows(perm Permission, server string, labels map[string]string) bool {
+	global := slices.Contains(globalPermissions, perm)
+	return slices.ContainsFunc(r, func(b RoleBinding) bool {
+		if !b.Role.Grants(perm) {
+			return false
+		}
+		if !b.Scoped() {
+			return true
+		}
+		return !global && server != "" && b.selects(server, labels)
+	})
+}
+
+func (r RoleBindings) String() string {
+	if len(r) == 0 {
+		return "none"
+	}
+	roles := make([]string, 0, len(r))
+	for _, binding := range r {
+		roles = append(roles, binding.String())
+	}
+	return strings.Join(roles, ", ")
+}
+
+// Principal is the caller of the admin api, a token or an oauth identity
+type Principal struct {
+	Name  string
+	Roles RoleBindings
+}
+
+// Denied is the error of an operation the principal isn't allowed to, the server is empty
+// for the operations which are not about a server
+func (p Principal) Denied(perm Permission, server string) error {
+	target := ""
+	if server != "" {
+		target = " on server " + server
+	}
+	return fmt.Errorf("%w: %s with roles %s can't %s%s", ErrPermissionDenied, p.Name, p.Roles, perm, target)
+}
@@ -0,0 +1,137 @@
+package auth
+
+import "testing"
+
+func TestRoleBindingsAllows(t *testing.T) {
+	prod := map[string]string{"env": "prod"}
+	tests := []struct {
+		name   string
+		roles  RoleBindings
+		perm   Permission
+		server string
+		labels map[string]string
+		want   bool
+	}{
+		{name: "admin", roles: RoleBindings{{Role: RoleAdmin}}, perm: PermServerDelete, server: "s", want: true},
+		{name: "admin global permission", roles: RoleBindings{{Role: RoleAdmin}}, perm: PermTokenManage, want: true},
+		{name: "viewer lists", roles: RoleBindings{{Role: RoleViewer}}, perm: PermServerList, server: "s", want: true},
+		{name: "viewer can't start", roles: RoleBindings{{Role: RoleViewer}}, perm: PermServerStart, server: "s"},
+		{name: "operator starts", roles: RoleBindings{{Role: RoleOperator}}, perm: PermServerStart, server: "s", want: true},
+		{name: "operator can't write tools", roles: RoleBindings{{Role: RoleOperator}}, perm: PermToolWrite, server: "s"},
+		{name: "publisher writes tools", roles: RoleBindings{{Role: RolePluginPublisher}}, perm: PermToolWrite, server: "s", want: true},
+		{name: "publisher can't delete servers", roles: RoleBindings{{Role: RolePluginPublisher}}, perm: PermServerDelete, server: "s"},
+		{name: "unknown role", roles: RoleBindings{{Role: "root"}}, perm: PermServerList, server: "s"},
+		{name: "no roles", perm: PermServerList, server: "s"},
+		{
+			name:   "scoped by pattern on a selected server",
+			roles:  RoleBindings{{Role: RoleOperator, Servers: []string{"team-a-*"}}},
+			perm:   PermServerStart,
+			server: "team-a-search",
+			want:   true,
+		},
+		{
+			name:   "scoped by pattern on another server",
+			roles:  RoleBindings{{Role: RoleOperator, Servers: []string{"team-a-*"}}},
+			perm:   PermServerStart,
+			server: "team-b-search",
+		},
+		{
+			// a scoped binding grants nothing which isn't about one of its servers
+			name:  "scoped without a server",
+			roles: RoleBindings{{Role: RoleOperator, Servers: []string{"*"}}},
+			perm:  PermServerStart,
+		},
+		{
+			name:   "scoped by selector on a matching server",
+			roles:  RoleBindings{{Role: RoleOperator, Selector: "env=prod"}},
+			perm:   PermServerStop,
+			server: "s",
+			labels: prod,
+			want:   true,
+		},
+		{
+			name:   "scoped by selector on another server",
+			roles:  RoleBindings{{Role: RoleOperator, Selector: "env=prod"}},
+			perm:   PermServerStop,
+			server: "s",
+			labels: map[string]string{"env": "dev"},
+		},
+		{
+			name:   "scoped by pattern and selector",
+			roles:  RoleBindings{{Role: RoleOperator, Servers: []string{"a"}, Selector: "env=prod"}},
+			perm:   PermServerStop,
+			server: "b",
+			labels: prod,
+		},
+		{
+			name:  "scoped admin can't manage tokens",
+			roles: RoleBindings{{Role: RoleAdmin, Servers: []string{"*"}}},
+			perm:  PermTokenManage,
+		},
+		{
+			name:   "scoped admin can't read the audit log of its server",
+			roles:  RoleBindings{{Role: RoleAdmin, Servers: []string{"s"}}},
+			perm:   PermAuditRead,
+			server: "s",
+		},
+		{
+			name:   "any binding allows",
+			roles:  RoleBindings{{Role: RoleViewer}, {Role: RoleOperator, Servers: []string{"s"}}},
+			perm:   PermServerStart,
+			server: "s",
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.roles.Allows(tt.perm, tt.server, tt.labels); got != tt.want {
+				t.Fatalf("Allows(%s, %q) = %v, want %v", tt.perm, tt.server, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleBindingsGrants(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles RoleBindings
+		perm  Permission
+		want  bool
+	}{
+		{name: "unscoped", roles: RoleBindings{{Role: RoleOperator}}, perm: PermServerStart, want: true},
+		// the routes let the scoped bindings through, the handlers check the server
+		{name: "scoped", roles: RoleBindings{{Role: RoleOperator, Servers: []string{"a"}}}, perm: PermServerStart, want: true},
+		{name: "not granted", roles: RoleBindings{{Role: RoleViewer}}, perm: PermServerStart},
+		{name: "global unscoped", roles: RoleBindings{{Role: RoleAdmin}}, perm: PermTokenManage, want: true},
+		{name: "global scoped", roles: RoleBindings{{Role: RoleAdmin, Selector: "env=prod"}}, perm: PermTokenManage},
+		{name: "unknown role", roles: RoleBindings{{Role: "root"}}, perm: PermServerList},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.roles.Grants(tt.perm); got != tt.want {
+				t.Fatalf("Grants(%s) = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleBindingValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		binding RoleBinding
+		wantErr bool
+	}{
+		{name: "role", binding: RoleBinding{Role: RoleViewer}},
+		{name: "scoped", binding: RoleBinding{Role: RoleOperator, Servers: []string{"team-*"}, Selector: "env=prod"}},
+		{name: "unknown role", binding: RoleBinding{Role: "root"}, wantErr: true},
+		{name: "invalid pattern", binding: RoleBinding{Role: RoleViewer, Servers: []string{"["}}, wantErr: true},
+		{name: "invalid selector", binding: RoleBinding{Role: RoleViewer, Selector: "=prod"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.binding.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jyz0309/omcp/mcp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ClientAuthRequire rejects the connections without a client certificate the CAs verify
+	ClientAuthRequire = "require"
+	// ClientAuthVerifyIfGiven verifies a client certificate if one is presented, the others fall back to the tokens
+	ClientAuthVerifyIfGiven = "verify-if-given"
+
+	// certCheckInterval bounds how often the handshakes check the files for a rotation
+	certCheckInterval = 10 * time.Second
+)
+
+// TLSConfig configures the tls listener of the OMCP server
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is the CA bundle verifying the client certificates, the client certificates are ignored if empty
+	ClientCAFile string
+	// ClientAuth is require or verify-if-given, require by default
+	ClientAuth string
+	// Roles bind the roles of the admin api to the certificate identities, the subject is the common name
+	// and the groups are the organizational units of the certificate
+	Roles []IdentityRole
+}
+
+func (c *TLSConfig) Validate() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("both tls cert and key are required")
+	}
+	switch c.ClientAuth {
+	case "", ClientAuthRequire, ClientAuthVerifyIfGiven:
+	default:
+		return fmt.Errorf("unknown tls client auth %q, require or verify-if-given", c.ClientAuth)
+	}
+	if c.ClientCAFile == "" && (c.ClientAuth != "" || len(c.Roles) > 0) {
+		return errors.New("tls client ca is required to verify the client certificates")
+	}
+	return validateIdentityRoles(c.Roles)
+}
+
+// LoadIdentityRoles reads a json file of the roles bound to the identities
+func LoadIdentityRoles(path string) ([]IdentityRole, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var roles []IdentityRole
+	if err := json.Unmarshal(data, &roles); err != nil {
+		return nil, fmt.Errorf("parse roles %s: %w", path, err)
+	}
+	return roles, nil
+}
+
+// ServerTLS builds the tls config of the listener, the certificate and the client CAs are reloaded
+// once their files change so a rotation doesn't need a restart
+func (c *TLSConfig) ServerTLS() (*tls.Config, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	files := &tlsFiles{config: *c}
+	if err := files.load(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return files.current(), nil
+		},
+	}, nil
+}
+
+// tlsFiles keeps the config of the latest certificate and client CAs
+type tlsFiles struct {
+	config TLSConfig
+
+	mu      sync.Mutex
+	tls     *tls.Config
+	modTime time.Time
+	checked time.Time
+}
+
+// current reloads the files if they changed since the last check, a broken rotation keeps
+// the previous certificate so the listener stays up
+func (f *tlsFiles) current() *tls.Config {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if time.Since(f.checked) >= certCheckInterval {
+		f.checked = time.Now()
+		if f.latestModTime().After(f.modTime) {
+			if err := f.reload(); err != nil {
+				logrus.WithError(err).Error("failed to reload tls certificate, keep the previous one")
+			} else {
+				logrus.WithField("cert", f.config.CertFile).Info("reloaded tls certificate")
+			}
+		}
+	}
+	return f.tls
+}
+
+func (f *tlsFiles) load() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checked = time.Now()
+	return f.reload()
+}
+
+// reload reads the files, the caller must hold f.mu
+func (f *tlsFiles) reload() error {
+	modTime := f.latestModTime()
+	cert, err := tls.LoadX509KeyPair(f.config.CertFile, f.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if f.config.ClientCAFile != "" {
+		pool, err := loadCertPool(f.config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		if f.config.ClientAuth == ClientAuthVerifyIfGiven {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	f.tls = config
+	f.modTime = modTime
+	return nil
+}
+
+func (f *tlsFiles) latestModTime() time.Time {
+	var latest time.Time
+	for _, path := range []string{f.config.CertFile, f.config.KeyFile, f.config.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no pem certificate in %s", path)
+	}
+	return pool, nil
+}
+
+// ClientTLS builds the tls config of a client, the server is verified only against the CA bundle
+// if one is given, otherwise against the system roots, the certificate is presented for mTLS
+func ClientTLS(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("both tls client cert and key are required")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// CertIdentity maps the verified client certificate of a connection onto an identity, nil if the
+// connection has none, the subject is the common name, or the first uri of a certificate without one
+func CertIdentity(state *tls.ConnectionState) *mcp.Identity {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := state.VerifiedChains[0][0]
+	subject := cert.Subject.CommonName
+	if subject == "" && len(cert.URIs) > 0 {
+		subject = cert.URIs[0].String()
+	}
+	if subject == "" {
+		return nil
+	}
+	return &mcp.Identity{
+		Subject: subject,
+		Issuer:  cert.Issuer.String(),
+		Groups:  cert.Subject.OrganizationalUnit,
+		Claims: map[string]any{
+			"serial":        cert.SerialNumber.String(),
+			"organizations": cert.Subject.Organization,
+			"dns_names":     cert.DNSNames,
+		},
+	}
+}
+
+// CertPrincipal is the principal of a certificate identity with the roles bound to it
+func CertPrincipal(identity *mcp.Identity, roles []IdentityRole) Principal {
+	return Principal{Name: "certificate " + identity.Subject, Roles: identityRoles(identity, roles)}
+}
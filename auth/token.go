@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TokenPrefix marks the admin api tokens, a token is omcp_<id>_<secret>
+	TokenPrefix = "omcp_"
+	// BootstrapTokenName is the name of the token generated when there is no active token
+	BootstrapTokenName = "bootstrap"
+
+	// lastUsedInterval limits how often the last use of a token is persisted
+	lastUsedInterval = time.Minute
+)
+
+var (
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrTokenExpired  = errors.New("token expired")
+	ErrTokenRevoked  = errors.New("token revoked")
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenExists   = errors.New("token already exists")
+)
+
+// Token is an admin api token, only the hash of its secret is kept
+type Token struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Hash string `json:"hash,omitempty"`
+	// Roles are the roles of an admin api token, the tokens created before the roles are admins
+	Roles      RoleBindings `json:"roles,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  time.Time    `json:"expires_at,omitempty"`
+	RevokedAt  time.Time    `json:"revoked_at,omitempty"`
+	LastUsedAt time.Time    `json:"last_used_at,omitempty"`
+}
+
+// Status is active, expired or revoked
+func (t *Token) Status() string {
+	switch {
+	case !t.RevokedAt.IsZero():
+		return "revoked"
+	case t.expired(time.Now()):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// Principal is the caller of the admin api authenticated by the token
+func (t *Token) Principal() Principal {
+	roles := t.Roles
+	if len(roles) == 0 {
+		roles = RoleBindings{{Role: RoleAdmin}}
+	}
+	return Principal{Name: "token " + t.Name, Roles: roles}
+}
+
+func (t *Token) expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt)
+}
+
+func (t *Token) active(now time.Time) bool {
+	return t.RevokedAt.IsZero() && !t.expired(now)
+}
+
+// TokenPersister persists the tokens, it's called after every change
+type TokenPersister interface {
+	SaveToken(token *Token) error
+}
+
+// Tokens issues and verifies the admin api tokens, it's safe to be used from multiple goroutines
+type Tokens struct {
+	mu        sync.RWMutex
+	tokens    map[string]*Token
+	persister TokenPersister
+}
+
+// NewTokens creates an empty set of tokens, the persister can be nil to keep them in memory only
+func NewTokens(persister TokenPersister) *Tokens {
+	return &Tokens{tokens: make(map[string]*Token), persister: persister}
+}
+
+// Add adds existing tokens without persisting them, e.g. the restored ones
+func (t *Tokens) Add(tokens ...*Token) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, token := range tokens {
+		t.tokens[token.ID] = token
+	}
+}
+
+// Create issues a token of the roles which never expires if ttl is 0, the secret is returned only once
+func (t *Tokens) Create(name string, roles RoleBindings, ttl time.Duration) (string, Token, error) {
+	if name == "" {
+		return "", Token{}, errors.New("token name is required")
+	}
+	if len(roles) == 0 {
+		return "", Token{}, errors.New("at least one role of the token is required")
+	}
+	if err := roles.Validate(); err != nil {
+		return "", Token{}, err
+	}
+	if ttl < 0 {
+		return "", Token{}, errors.New("token ttl can't be negative")
+	}
+	id, err := randomHex(4)
+	if err != nil {
+		return "", Token{}, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", Token{}, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if t.activeToken(name, now) != nil {
+		return "", Token{}, fmt.Errorf("%w: %s", ErrTokenExists, name)
+	}
+	if _, exist := t.tokens[id]; exist {
+		return "", Token{}, fmt.Errorf("%w: %s", ErrTokenExists, id)
+	}
+	token := &Token{ID: id, Name: name, Hash: hash(secret), Roles: roles, CreatedAt: now}
+	if ttl > 0 {
+		token.ExpiresAt = now.Add(ttl)
+	}
+	if err := t.save(token); err != nil {
+		return "", Token{}, err
+	}
+	t.tokens[id] = token
+	return TokenPrefix + id + "_" + secret, token.public(), nil
+}
+
+// List returns the tokens without their hashes, sorted by creation
+func (t *Tokens) List() []Token {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	tokens := make([]Token, 0, len(t.tokens))
+	for _, token := range t.tokens {
+		tokens = append(tokens, token.public())
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens
+}
+
+// HasActive reports whether any token can still be used
+func (t *Tokens) HasActive() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	now := time.Now()
+	for _, token := range t.tokens {
+		if token.active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoke revokes the active token of the name or the token of the id
+func (t *Tokens) Revoke(nameOrID string) (Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token := t.activeToken(nameOrID, time.Now())
+	if token == nil {
+		token = t.tokens[nameOrID]
+	}
+	for _, candidate := range t.tokens {
+		if token == nil && candidate.Name == nameOrID {
+			token = candidate
+		}
+	}
+	if token == nil {
+		return Token{}, fmt.Errorf("%w: %s", ErrTokenNotFound, nameOrID)
+	}
+	if !token.RevokedAt.IsZero() {
+		return Token{}, fmt.Errorf("%w: %s", ErrTokenRevoked, nameOrID)
+	}
+	revoked := *token
+	revoked.RevokedAt = time.Now()
+	if err := t.save(&revoked); err != nil {
+		return Token{}, err
+	}
+	*token = revoked
+	return token.public(), nil
+}
+
+// Verify checks the raw token and returns it, the last use is recorded
+func (t *Tokens) Verify(raw string) (Token, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(raw, TokenPrefix), "_")
+	if !ok || !strings.HasPrefix(raw, TokenPrefix) {
+		return Token{}, ErrInvalidToken
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, exist := t.tokens[id]
+	if !exist || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash(secret))) != 1 {
+		return Token{}, ErrInvalidToken
+	}
+	now := time.Now()
+	if !token.RevokedAt.IsZero() {
+		return Token{}, ErrTokenRevoked
+	}
+	if token.expired(now) {
+		return Token{}, ErrTokenExpired
+	}
+	if now.Sub(token.LastUsedAt) > lastUsedInterval {
+		token.LastUsedAt = now
+		// the last use is informative, a failed write doesn't reject the token
+		_ = t.save(token)
+	}
+	return token.public(), nil
+}
+
+// activeToken returns the active token of the name, the caller must hold t.mu
+func (t *Tokens) activeToken(name string, now time.Time) *Token {
+	for _, token := range t.tokens {
+		if token.Name == name && token.active(now) {
+			return token
+		}
+	}
+	return nil
+}
+
+func (t *Tokens) save(token *Token) error {
+	if t.persister == nil {
+		return nil
+	}
+	return t.persister.SaveToken(token)
+}
+
+func (t *Token) public() Token {
+	token := *t
+	token.Hash = ""
+	return token
+}
+
+// hash is enough to keep the secrets at rest since they are random, not chosen by the users
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryPersister keeps the last persisted version of the tokens and the client keys
+type memoryPersister struct {
+	tokens map[string]Token
+	keys   map[string]ClientKey
+}
+
+func newMemoryPersister() *memoryPersister {
+	return &memoryPersister{tokens: make(map[string]Token), keys: make(map[string]ClientKey)}
+}
+
+func (p *memoryPersister) SaveToken(token *Token) error {
+	p.tokens[token.ID] = *token
+	return nil
+}
+
+func (p *memoryPersister) SaveClientKey(key *ClientKey) error {
+	p.keys[key.ID] = *key
+	return nil
+}
+
+func (p *memoryPersister) DeleteClientKey(id string) error {
+	delete(p.keys, id)
+	return nil
+}
+
+func TestTokensVerify(t *testing.T) {
+	tokens := NewTokens(nil)
+	raw, created, err := tokens.Create("ci", RoleBindings{{Role: RoleOperator}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, secret, _ := strings.Cut(strings.TrimPrefix(raw, TokenPrefix), "_")
+	tokens.Add(
+		&Token{ID: "expired", Name: "expired", Hash: hash(secret), ExpiresAt: time.Now().Add(-time.Minute)},
+		&Token{ID: "revoked", Name: "revoked", Hash: hash(secret), RevokedAt: time.Now()},
+	)
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr error
+	}{
+		{name: "valid", raw: raw},
+		{name: "wrong secret", raw: TokenPrefix + id + "_" + strings.Repeat("0", len(secret)), wantErr: ErrInvalidToken},
+		{name: "unknown id", raw: TokenPrefix + "ffffffff_" + secret, wantErr: ErrInvalidToken},
+		{name: "missing prefix", raw: id + "_" + secret, wantErr: ErrInvalidToken},
+		{name: "missing secret", raw: TokenPrefix + id, wantErr: ErrInvalidToken},
+		{name: "client key prefix", raw: ClientKeyPrefix + id + "_" + secret, wantErr: ErrInvalidToken},
+		{name: "expired", raw: TokenPrefix + "expired_" + secret, wantErr: ErrTokenExpired},
+		{name: "revoked", raw: TokenPrefix + "revoked_" + secret, wantErr: ErrTokenRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tokens.Verify(tt.raw)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if token.ID != created.ID || token.Hash != "" || token.LastUsedAt.IsZero() {
+				t.Errorf("Verify() = %+v, want token %s without its hash and with its last use", token, created.ID)
+			}
+		})
+	}
+}
+
+func TestTokensCreate(t *testing.T) {
+	tokens := NewTokens(nil)
+	tests := []struct {
+		name    string
+		token   string
+		roles   RoleBindings
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{name: "admin", token: "admin", roles: RoleBindings{{Role: RoleAdmin}}},
+		{name: "scoped with ttl", token: "ci", roles: RoleBindings{{Role: RoleOperator, Servers: []string{"team-a-*"}}}, ttl: time.Hour},
+		{name: "active name", token: "admin", roles: RoleBindings{{Role: RoleAdmin}}, wantErr: true},
+		{name: "missing name", roles: RoleBindings{{Role: RoleAdmin}}, wantErr: true},
+		{name: "missing roles", token: "none", wantErr: true},
+		{name: "unknown role", token: "root", roles: RoleBindings{{Role: "root"}}, wantErr: true},
+		{name: "negative ttl", token: "past", roles: RoleBindings{{Role: RoleAdmin}}, ttl: -time.Hour, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, token, err := tokens.Create(tt.token, tt.roles, tt.ttl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(raw, TokenPrefix+token.ID+"_") || token.Hash != "" {
+				t.Errorf("Create() = %s, %+v", raw, token)
+			}
+			if (tt.ttl > 0) != !token.ExpiresAt.IsZero() {
+				t.Errorf("Create() expires at %v with ttl %v", token.ExpiresAt, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestTokensRevoke(t *testing.T) {
+	tokens := NewTokens(nil)
+	raw, _, err := tokens.Create("ci", RoleBindings{{Role: RoleAdmin}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tokens.HasActive() {
+		t.Fatal("HasActive() = false with an active token")
+	}
+	revoked, err := tokens.Revoke("ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.Status() != "revoked" {
+		t.Fatalf("Revoke() status = %s, want revoked", revoked.Status())
+	}
+	if _, err := tokens.Verify(raw); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Verify() of a revoked token error = %v, want %v", err, ErrTokenRevoked)
+	}
+	if _, err := tokens.Revoke("ci"); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Revoke() of a revoked token error = %v, want %v", err, ErrTokenRevoked)
+	}
+	if _, err := tokens.Revoke("missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Revoke() of a missing token error = %v, want %v", err, ErrTokenNotFound)
+	}
+	if tokens.HasActive() {
+		t.Fatal("HasActive() = true with only a revoked token")
+	}
+	// the name of a revoked token can be reused
+	if _, _, err := tokens.Create("ci", RoleBindings{{Role: RoleAdmin}}, 0); err != nil {
+		t.Fatalf("Create() with the name of a revoked token error = %v", err)
+	}
+}
+
+func TestTokensPersistHashOnly(t *testing.T) {
+	persister := newMemoryPersister()
+	tokens := NewTokens(persister)
+	raw, token, err := tokens.Create("ci", RoleBindings{{Role: RoleAdmin}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, secret, _ := strings.Cut(strings.TrimPrefix(raw, TokenPrefix), "_")
+	saved, ok := persister.tokens[token.ID]
+	if !ok {
+		t.Fatal("Create() didn't persist the token")
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Hash != hash(secret) || strings.Contains(string(data), secret) {
+		t.Fatalf("persisted token = %s, want only the hash of the secret", data)
+	}
+	for _, listed := range tokens.List() {
+		if listed.Hash != "" {
+			t.Fatalf("List() returned the hash of token %s", listed.Name)
+		}
+	}
+
+	// the restored tokens verify the secret against the hash
+	restored := NewTokens(nil)
+	restored.Add(&saved)
+	if _, err := restored.Verify(raw); err != nil {
+		t.Fatalf("Verify() of a restored token error = %v", err)
+	}
+	if _, err := tokens.Revoke(token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if persister.tokens[token.ID].RevokedAt.IsZero() {
+		t.Fatal("Revoke() didn't persist the revocation")
+	}
+}
+
+func TestTokenPrincipal(t *testing.T) {
+	// the tokens created before the roles are admins
+	legacy := Token{Name: "old"}
+	if !legacy.Principal().Roles.Allows(PermTokenManage, "", nil) {
+		t.Fatal("a token without roles isn't an admin")
+	}
+	scoped := Token{Name: "ci", Roles: RoleBindings{{Role: RoleViewer}}}
+	if scoped.Principal().Roles.Allows(PermServerCreate, "s", nil) {
+		t.Fatal("a viewer token can create servers")
+	}
+}
@@ -1,12 +1,25 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/jyz0309/omcp/audit"
+	"github.com/jyz0309/omcp/auth"
 	"github.com/jyz0309/omcp/config"
+	"github.com/jyz0309/omcp/secret"
 	web "github.com/jyz0309/omcp/web"
 
 	"github.com/jyz0309/omcp/mcp"
@@ -14,8 +27,12 @@ import (
 
 type OmcpServerCli struct {
 	url string
+	// token is the admin api token sent as the bearer token
+	token string
 
 	cli *http.Client
+	// err is the error of the tls client config, it's returned by every request
+	err error
 }
 
 func NewOmcpServerCli(host string) *OmcpServerCli {
@@ -28,18 +45,62 @@ func NewOmcpServerCli(host string) *OmcpServerCli {
 	//	 config.SetHost(host)s
 	// }
 
+	cli, err := httpClient()
 	return &OmcpServerCli{
-		url: host,
-		cli: &http.Client{},
+		url:   host,
+		token: config.Token(),
+		cli:   cli,
+		err:   err,
 	}
 }
 
-func (c *OmcpServerCli) CreateMcpServer(name, desc, version string) error {
-	body := web.CreateMcpServerReq{
-		Name:    name,
-		Desc:    desc,
-		Version: version,
+// httpClient is the client of the OMCP server, it verifies the server against the CA bundle of
+// OMCP_TLS_CA if set and presents the client certificate of OMCP_TLS_CERT and OMCP_TLS_KEY
+var httpClient = sync.OnceValues(func() (*http.Client, error) {
+	if config.TLSCA() == "" && config.TLSCert() == "" && config.TLSKey() == "" {
+		return &http.Client{}, nil
 	}
+	tlsConfig, err := auth.ClientTLS(config.TLSCA(), config.TLSCert(), config.TLSKey())
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls client config: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+})
+
+// send sends the request with the bearer token, a rejected token is reported with the reason
+func (c *OmcpServerCli) send(req *http.Request) (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		defer resp.Body.Close()
+		var respBody web.ServerResp
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil || respBody.Message == "" {
+			respBody.Message = http.StatusText(resp.StatusCode)
+		}
+		return nil, fmt.Errorf("unauthorized: %s, set OMCP_TOKEN to a valid admin token", respBody.Message)
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		defer resp.Body.Close()
+		var respBody web.ServerResp
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil || respBody.Message == "" {
+			respBody.Message = auth.ErrPermissionDenied.Error()
+		}
+		return nil, errors.New(respBody.Message)
+	}
+	return resp, nil
+}
+
+func (c *OmcpServerCli) CreateMcpServer(body web.CreateMcpServerReq) error {
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return err
@@ -49,7 +110,7 @@ func (c *OmcpServerCli) CreateMcpServer(name, desc, version string) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.cli.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return err
 	}
@@ -75,7 +136,7 @@ func (c *OmcpServerCli) ListMcpServers() ([]*mcp.MCPServer, error) {
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.cli.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
@@ -107,7 +168,7 @@ func (c *OmcpServerCli) DeleteMcpServer(name string) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.cli.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return err
 	}
@@ -141,7 +202,7 @@ func (c *OmcpServerCli) StartMcpServer(name string) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.cli.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return err
 	}
@@ -177,7 +238,7 @@ func (c *OmcpServerCli) StopMcpServer(name string) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.cli.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return err
 	}
@@ -200,23 +261,450 @@ func (c *OmcpServerCli) StopMcpServer(name string) error {
 	return nil
 }
 
-func (c *OmcpServerCli) Load(filepath string, plugins []mcp.Plugin) error {
-	body := web.LoadReq{
-		Plugins: plugins,
+// Load uploads the plugin file with its detached signature if any, and loads the plugins from it into the server
+func (c *OmcpServerCli) Load(server, pluginPath, signaturePath string, plugins []mcp.Plugin) (*web.LoadResp, error) {
+	pluginsJson, err := json.Marshal(plugins)
+	if err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.WriteField("server", server); err != nil {
+		return nil, err
+	}
+	if err := writer.WriteField("plugins", string(pluginsJson)); err != nil {
+		return nil, err
+	}
+	if err := writeFormFile(writer, "plugin_file", pluginPath); err != nil {
+		return nil, err
+	}
+	if signaturePath != "" {
+		if err := writeFormFile(writer, "signature", signaturePath); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/load", c.url), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to load plugin, status code: %d", resp.StatusCode)
+	}
+
+	var respBody web.LoadResp
+	err = json.NewDecoder(resp.Body).Decode(&respBody)
+	if err != nil {
+		return nil, err
+	}
+	if !respBody.Success && len(respBody.Results) == 0 {
+		return nil, fmt.Errorf("failed to load plugin, message: %s", respBody.Message)
+	}
+
+	return &respBody, nil
+}
+
+func writeFormFile(writer *multipart.Writer, field, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	part, err := writer.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
+
+// do sends the body as json and decodes the response into respBody
+func (c *OmcpServerCli) do(method, path string, body any, respBody any) error {
+	var reader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(jsonBody)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", c.url, path), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request %s failed, status code: %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(respBody)
+}
+
+func (c *OmcpServerCli) ListTools(server string, isRepo bool) ([]mcp.MCPTool, error) {
+	var respBody web.ListToolResp
+	err := c.do("GET", "/api/tool/list", web.ListToolReq{Server: server, IsRepo: isRepo}, &respBody)
+	if err != nil {
+		return nil, err
+	}
+	return respBody.Tools, nil
+}
+
+func (c *OmcpServerCli) AddTool(body web.AddToolReq) (*mcp.MCPTool, error) {
+	var respBody web.ToolResp
+	if err := c.do("POST", "/api/tool/add", body, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to add tool, message: %s", respBody.Message)
+	}
+	return respBody.Tool, nil
+}
+
+func (c *OmcpServerCli) UpdateTool(body web.UpdateToolReq) (*mcp.MCPTool, error) {
+	var respBody web.ToolResp
+	if err := c.do("POST", "/api/tool/update", body, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to update tool, message: %s", respBody.Message)
+	}
+	return respBody.Tool, nil
+}
+
+func (c *OmcpServerCli) DeleteTool(server, name string) error {
+	var respBody web.ServerResp
+	if err := c.do("POST", "/api/tool/delete", web.DeleteToolReq{Server: server, ToolName: name}, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to delete tool, message: %s", respBody.Message)
+	}
+	return nil
+}
+
+func (c *OmcpServerCli) ListResources(server string) ([]mcp.MCPResource, error) {
+	var respBody web.ListResourceResp
+	if err := c.do("GET", "/api/resource/list", web.ListResourceReq{Server: server}, &respBody); err != nil {
+		return nil, err
+	}
+	return respBody.Resources, nil
+}
+
+func (c *OmcpServerCli) AddResource(body web.AddResourceReq) (*mcp.MCPResource, error) {
+	var respBody web.ResourceResp
+	if err := c.do("POST", "/api/resource/add", body, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to add resource, message: %s", respBody.Message)
+	}
+	return respBody.Resource, nil
+}
+
+func (c *OmcpServerCli) DeleteResource(server, uri string) error {
+	var respBody web.ServerResp
+	if err := c.do("POST", "/api/resource/delete", web.DeleteResourceReq{Server: server, URI: uri}, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to delete resource, message: %s", respBody.Message)
 	}
+	return nil
+}
+
+func (c *OmcpServerCli) ListPrompts(server string) ([]mcp.MCPPrompt, error) {
+	var respBody web.ListPromptResp
+	if err := c.do("GET", "/api/prompt/list", web.ListPromptReq{Server: server}, &respBody); err != nil {
+		return nil, err
+	}
+	return respBody.Prompts, nil
+}
+
+func (c *OmcpServerCli) CreatePrompt(server string, prompt mcp.MCPPrompt) error {
+	var respBody web.PromptResp
+	if err := c.do("POST", "/api/prompt/create", web.CreatePromptReq{Server: server, Prompt: prompt}, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to create prompt, message: %s", respBody.Message)
+	}
+	return nil
+}
+
+func (c *OmcpServerCli) RenderPrompt(server, name string, args map[string]string) ([]mcp.PromptMessage, error) {
+	var respBody web.RenderPromptResp
+	if err := c.do("POST", "/api/prompt/render", web.RenderPromptReq{Server: server, Name: name, Arguments: args}, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to render prompt, message: %s", respBody.Message)
+	}
+	return respBody.Messages, nil
+}
+
+func (c *OmcpServerCli) DeletePrompt(server, name string) error {
+	var respBody web.ServerResp
+	if err := c.do("POST", "/api/prompt/delete", web.DeletePromptReq{Server: server, Name: name}, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to delete prompt, message: %s", respBody.Message)
+	}
+	return nil
+}
+
+func (c *OmcpServerCli) ListPolicies(server string) ([]mcp.Policy, error) {
+	var respBody web.ListPolicyResp
+	if err := c.do("GET", "/api/policy/list", web.ListPolicyReq{Server: server}, &respBody); err != nil {
+		return nil, err
+	}
+	return respBody.Policies, nil
+}
+
+func (c *OmcpServerCli) AddPolicy(body web.AddPolicyReq) error {
+	var respBody web.PolicyResp
+	if err := c.do("POST", "/api/policy/add", body, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to add policy, message: %s", respBody.Message)
+	}
+	return nil
+}
+
+func (c *OmcpServerCli) DeletePolicy(server, name string) error {
+	var respBody web.ServerResp
+	if err := c.do("POST", "/api/policy/delete", web.DeletePolicyReq{Server: server, Name: name}, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to delete policy, message: %s", respBody.Message)
+	}
+	return nil
+}
+
+func (c *OmcpServerCli) EvalPolicy(body web.EvalPolicyReq) (*mcp.PolicyResult, error) {
+	var respBody web.EvalPolicyResp
+	if err := c.do("POST", "/api/policy/eval", body, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to evaluate policies, message: %s", respBody.Message)
+	}
+	return respBody.Result, nil
+}
+
+func (c *OmcpServerCli) ListAudit(body web.ListAuditReq) ([]audit.Entry, error) {
+	var respBody web.ListAuditResp
+	if err := c.do("GET", "/api/audit", body, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to query audit log, message: %s", respBody.Message)
+	}
+	return respBody.Entries, nil
+}
+
+func (c *OmcpServerCli) ListTokens() ([]auth.Token, error) {
+	var respBody web.ListTokenResp
+	if err := c.do("GET", "/api/token/list", nil, &respBody); err != nil {
+		return nil, err
+	}
+	return respBody.Tokens, nil
+}
+
+// CreateToken returns the secret of the created token
+func (c *OmcpServerCli) CreateToken(name string, roles auth.RoleBindings, ttl string) (string, *auth.Token, error) {
+	var respBody web.TokenResp
+	if err := c.do("POST", "/api/token/create", web.CreateTokenReq{Name: name, Roles: roles, TTL: ttl}, &respBody); err != nil {
+		return "", nil, err
+	} else if !respBody.Success {
+		return "", nil, fmt.Errorf("failed to create token, message: %s", respBody.Message)
+	}
+	return respBody.Secret, respBody.Token, nil
+}
+
+func (c *OmcpServerCli) RevokeToken(name string) error {
+	var respBody web.TokenResp
+	if err := c.do("POST", "/api/token/revoke", web.RevokeTokenReq{Name: name}, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to revoke token, message: %s", respBody.Message)
+	}
+	return nil
+}
+
+func (c *OmcpServerCli) ListSecrets() ([]secret.Secret, error) {
+	var respBody web.ListSecretResp
+	if err := c.do("GET", "/api/secret/list", nil, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to list secrets, message: %s", respBody.Message)
+	}
+	return respBody.Secrets, nil
+}
+
+func (c *OmcpServerCli) SetSecret(body web.SetSecretReq) error {
+	var respBody web.SecretResp
+	if err := c.do("POST", "/api/secret/set", body, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to set secret, message: %s", respBody.Message)
+	}
+	return nil
+}
+
+func (c *OmcpServerCli) DeleteSecret(name string) error {
+	var respBody web.SecretResp
+	if err := c.do("POST", "/api/secret/delete", web.DeleteSecretReq{Name: name}, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to delete secret, message: %s", respBody.Message)
+	}
+	return nil
+}
+
+// ServerLogs reads the sse stream of the log lines of the server and hands every line to fn,
+// it returns once the stream ends or ctx is done
+func (c *OmcpServerCli) ServerLogs(ctx context.Context, body web.ServerLogsReq, fn func(mcp.LogLine) error) error {
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/load", c.url), bytes.NewReader(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/server/logs", c.url), bytes.NewReader(jsonBody))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.cli.Do(req)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.send(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request /api/server/logs failed, status code: %d", resp.StatusCode)
+	}
+	// the failures before the stream starts are answered as json
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var respBody web.ServerResp
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed to get server logs, message: %s", respBody.Message)
+	}
+	reader := bufio.NewReader(resp.Body)
+	var event string
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if event == "log" && len(data) > 0 {
+				var logLine mcp.LogLine
+				if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &logLine); err != nil {
+					return err
+				}
+				if err := fn(logLine); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+func (c *OmcpServerCli) ListCalls(body web.ListCallReq) ([]mcp.CallRecord, error) {
+	var respBody web.ListCallResp
+	if err := c.do("GET", "/api/calls", body, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to list calls, message: %s", respBody.Message)
+	}
+	return respBody.Calls, nil
+}
+
+func (c *OmcpServerCli) GetCall(id string) (*mcp.CallRecord, error) {
+	var respBody web.CallResp
+	if err := c.do("GET", "/api/calls/"+url.PathEscape(id), nil, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to get call, message: %s", respBody.Message)
+	}
+	return respBody.Call, nil
+}
+
+func (c *OmcpServerCli) ListApprovals(body web.ListApprovalReq) ([]mcp.Approval, error) {
+	var respBody web.ListApprovalResp
+	if err := c.do("GET", "/api/approvals", body, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to list approvals, message: %s", respBody.Message)
+	}
+	return respBody.Approvals, nil
+}
+
+func (c *OmcpServerCli) GetApproval(id string) (*mcp.Approval, error) {
+	var respBody web.ApprovalResp
+	if err := c.do("GET", "/api/approvals/"+url.PathEscape(id), nil, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to get approval, message: %s", respBody.Message)
+	}
+	return respBody.Approval, nil
+}
+
+func (c *OmcpServerCli) DecideApproval(id string, body web.DecideApprovalReq) (*mcp.Approval, error) {
+	var respBody web.ApprovalResp
+	if err := c.do("POST", "/api/approvals/"+url.PathEscape(id), body, &respBody); err != nil {
+		return nil, err
+	} else if !respBody.Success {
+		return nil, fmt.Errorf("failed to %s approval, message: %s", body.Decision, respBody.Message)
+	}
+	return respBody.Approval, nil
+}
+
+func (c *OmcpServerCli) ListClientKeys(server string) ([]auth.ClientKey, error) {
+	var respBody web.ListClientKeyResp
+	if err := c.do("GET", "/api/key/list", web.ListClientKeyReq{Server: server}, &respBody); err != nil {
+		return nil, err
+	}
+	return respBody.Keys, nil
+}
+
+// CreateClientKey returns the secret of the created key
+func (c *OmcpServerCli) CreateClientKey(body web.CreateClientKeyReq) (string, error) {
+	var respBody web.ClientKeyResp
+	if err := c.do("POST", "/api/key/create", body, &respBody); err != nil {
+		return "", err
+	} else if !respBody.Success {
+		return "", fmt.Errorf("failed to create client key, message: %s", respBody.Message)
+	}
+	return respBody.Secret, nil
+}
+
+func (c *OmcpServerCli) RevokeClientKey(server, name string) error {
+	var respBody web.ClientKeyResp
+	if err := c.do("POST", "/api/key/revoke", web.RevokeClientKeyReq{Server: server, Name: name}, &respBody); err != nil {
+		return err
+	} else if !respBody.Success {
+		return fmt.Errorf("failed to revoke client key, message: %s", respBody.Message)
+	}
 	return nil
 }
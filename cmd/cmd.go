@@ -1,12 +1,30 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/jyz0309/omcp/artifact"
+	"github.com/jyz0309/omcp/audit"
+	"github.com/jyz0309/omcp/auth"
 	"github.com/jyz0309/omcp/config"
+	"github.com/jyz0309/omcp/logging"
+	"github.com/jyz0309/omcp/mcp"
+	"github.com/jyz0309/omcp/secret"
+	"github.com/jyz0309/omcp/store"
+	"github.com/jyz0309/omcp/tracing"
 	"github.com/jyz0309/omcp/web"
 
 	"github.com/olekukonko/tablewriter"
@@ -38,6 +56,38 @@ func NewCli() *cobra.Command {
 		Short: "Start the OMCP server",
 		RunE:  serveHandler,
 	}
+	serveCmd.Flags().String("store", config.StoreDriver(), "The store driver to persist MCP servers, file or sqlite")
+	serveCmd.Flags().String("data-dir", config.DataDir(), "The directory to persist the OMCP state")
+	serveCmd.Flags().String("oauth-config", config.OAuthConfig(), "The oauth config file to validate the bearer tokens of the MCP endpoints")
+	serveCmd.Flags().String("addr", ":8080", "The address the OMCP server listens on")
+	serveCmd.Flags().String("tls-cert", "", "The certificate file to serve https, it's reloaded when the file changes")
+	serveCmd.Flags().String("tls-key", "", "The key file of the certificate")
+	serveCmd.Flags().String("tls-client-ca", "", "The CA bundle verifying the client certificates, enables mTLS")
+	serveCmd.Flags().String("tls-client-auth", auth.ClientAuthRequire, "Whether a client certificate is required, require or verify-if-given")
+	serveCmd.Flags().String("tls-roles", "", "A json file of the admin roles bound to the subjects or the groups of the client certificates")
+	serveCmd.Flags().String("plugin-dir", "", "The directory storing the plugin files by their digest, plugins in the data directory if empty")
+	serveCmd.Flags().String("plugin-trust-dir", "", "The directory of the public keys trusted to sign the plugins, trusted-keys in the data directory if empty")
+	serveCmd.Flags().Bool("allow-unsigned-plugins", false, "Load the unsigned plugins, the signed ones are still verified")
+	serveCmd.Flags().String("audit-log", config.AuditLog(), "The audit log file, audit.log in the data directory if empty")
+	serveCmd.Flags().Int("audit-max-size", audit.DefaultMaxSize>>20, "The size in megabytes the audit log is rotated at")
+	serveCmd.Flags().Int("audit-max-backups", audit.DefaultMaxBackups, "The number of rotated audit logs to keep")
+	serveCmd.Flags().StringSlice("audit-redact", nil, "The extra argument keys redacted from the audit log, besides the passwords, secrets and tokens")
+	serveCmd.Flags().Bool("audit-stdout", false, "Write the audit entries to stdout as well")
+	serveCmd.Flags().Duration("approval-timeout", mcp.DefaultApprovalTimeout, "How long a tool call requiring approval waits for an operator before it's refused")
+	serveCmd.Flags().Duration("approval-retention", mcp.DefaultApprovalRetention, "How long the decided approvals are kept, forever if 0")
+	serveCmd.Flags().Int("history-size", mcp.DefaultHistorySize, "The number of the latest tool calls kept in the history")
+	serveCmd.Flags().Duration("history-retention", mcp.DefaultHistoryRetention, "How long the tool calls are kept in the history, only the size limits it if 0")
+	serveCmd.Flags().String("master-key-file", config.MasterKeyFile(), "The file of the key encrypting the secrets, OMCP_MASTER_KEY if empty, the secrets are disabled without a key")
+	serveCmd.Flags().String("log-level", config.LogLevel(), "The level of the logs, debug, info, warn or error")
+	serveCmd.Flags().String("log-format", config.LogFormat(), "The format of the logs, text or json")
+	serveCmd.Flags().String("log-file", config.LogFile(), "The file the logs are written to instead of stdout, it's rotated like the audit log")
+	serveCmd.Flags().Int("log-max-size", logging.DefaultMaxSize>>20, "The size in megabytes the log file is rotated at")
+	serveCmd.Flags().Int("log-max-backups", logging.DefaultMaxBackups, "The number of rotated log files to keep")
+	serveCmd.Flags().String("trace-exporter", config.TraceExporter(), "The exporter of the spans, none, otlp, stdout or file")
+	serveCmd.Flags().String("trace-endpoint", "", "The url of the otlp http collector, OTEL_EXPORTER_OTLP_ENDPOINT if empty")
+	serveCmd.Flags().String("trace-file", "", "The file the file exporter appends the spans to, traces.json in the data directory if empty")
+	serveCmd.Flags().Float64("trace-sample-ratio", 1, "The ratio of the new traces which are sampled, the traces of the sampled callers are always sampled")
+	serveCmd.Flags().String("metrics-addr", "", "The address serving the prometheus metrics on /metrics, the OMCP server address if empty")
 	rootCmd.AddCommand(serveCmd)
 
 	serverCmd := &cobra.Command{
@@ -55,6 +105,17 @@ func NewCli() *cobra.Command {
 	createCmd.Flags().StringP("name", "n", "", "The name of the MCP server")
 	createCmd.Flags().StringP("desc", "d", "", "The description of the MCP server")
 	createCmd.Flags().StringP("version", "v", "0.0.1", "The version of the MCP server")
+	createCmd.Flags().StringSlice("transport", mcp.DefaultTransports, "The transports of the MCP server, sse or streamable-http")
+	createCmd.Flags().String("upstream-command", "", "The command of a stdio MCP server to proxy")
+	createCmd.Flags().StringArray("upstream-arg", nil, "An argument of the upstream command")
+	createCmd.Flags().StringArray("upstream-env", nil, "An environment variable of the upstream command as KEY=VALUE")
+	createCmd.Flags().String("upstream-url", "", "The url of a remote MCP server to proxy")
+	createCmd.Flags().String("upstream-transport", mcp.UpstreamStreamableHTTP, "The transport of the remote MCP server, sse or streamable-http")
+	createCmd.Flags().StringArray("upstream-header", nil, "A http header sent to the remote MCP server as KEY=VALUE")
+	createCmd.Flags().StringSlice("member", nil, "A managed server aggregated by the gateway, the earlier members win the conflicts")
+	createCmd.Flags().String("namespace", mcp.NamespaceAlways, "When the gateway prefixes the names with the member, always, on-conflict or never")
+	createCmd.Flags().String("separator", mcp.DefaultNamespaceSeparator, "The separator between the member and the name")
+	createCmd.Flags().StringArrayP("label", "l", nil, "A label of the MCP server as KEY=VALUE, selected by the scoped roles")
 	serverCmd.AddCommand(createCmd)
 
 	var deleteCmd = &cobra.Command{
@@ -92,115 +153,2099 @@ func NewCli() *cobra.Command {
 	stopCmd.Flags().StringP("name", "n", "", "The name of the MCP server")
 	serverCmd.AddCommand(stopCmd)
 
+	var logsCmd = &cobra.Command{
+		Use:   "logs",
+		Short: "Print the logs of a MCP server",
+		Long: "Print the logs of a MCP server, its tool calls, errors, client sessions and plugin messages.\n" +
+			"The OMCP server keeps the latest lines of every server at the level of --log-level.",
+		PreRunE: probeServerReady,
+		RunE:    logsHandler,
+	}
+	logsCmd.Flags().StringP("name", "n", "", "The name of the MCP server")
+	logsCmd.Flags().BoolP("follow", "f", false, "Follow the new lines until interrupted")
+	logsCmd.Flags().Duration("since", 0, "Only the lines of the last duration, e.g. 10m")
+	logsCmd.Flags().Bool("json", false, "Print the lines as json")
+	serverCmd.AddCommand(logsCmd)
+
+	toolCmd := &cobra.Command{
+		Use:   "tool",
+		Short: "Manage the tools of MCP servers",
+	}
+	rootCmd.AddCommand(toolCmd)
+
+	var toolListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the tools of a MCP server or the tool catalog",
+		PreRunE: probeServerReady,
+		RunE:    toolListHandler,
+	}
+	toolListCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	toolListCmd.Flags().Bool("catalog", false, "List the tools of the catalog")
+	toolCmd.AddCommand(toolListCmd)
+
+	var toolAddCmd = &cobra.Command{
+		Use:     "add",
+		Short:   "Add a tool to a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    toolAddHandler,
+	}
+	addToolFlags(toolAddCmd)
+	toolCmd.AddCommand(toolAddCmd)
+
+	var toolUpdateCmd = &cobra.Command{
+		Use:     "update",
+		Short:   "Replace a tool of a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    toolUpdateHandler,
+	}
+	addToolFlags(toolUpdateCmd)
+	toolCmd.AddCommand(toolUpdateCmd)
+
+	var toolDeleteCmd = &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a tool from a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    toolDeleteHandler,
+	}
+	toolDeleteCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	toolDeleteCmd.Flags().StringP("name", "n", "", "The name of the tool")
+	toolCmd.AddCommand(toolDeleteCmd)
+
+	resourceCmd := &cobra.Command{
+		Use:   "resource",
+		Short: "Manage the resources of MCP servers",
+	}
+	rootCmd.AddCommand(resourceCmd)
+
+	var resourceListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the resources of a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    resourceListHandler,
+	}
+	resourceListCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	resourceCmd.AddCommand(resourceListCmd)
+
+	var resourceAddCmd = &cobra.Command{
+		Use:     "add",
+		Short:   "Add a resource to a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    resourceAddHandler,
+	}
+	resourceAddCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	resourceAddCmd.Flags().StringP("name", "n", "", "The name of the resource")
+	resourceAddCmd.Flags().StringP("desc", "d", "", "The description of the resource")
+	resourceAddCmd.Flags().StringP("uri", "u", "", "The uri of the resource, or the uri template with parameters")
+	resourceAddCmd.Flags().String("mime", "", "The mime type of the resource, detected if not set")
+	resourceAddCmd.Flags().String("source", mcp.ResourceSourceText, "The source of the resource, text, file, dir or template")
+	resourceAddCmd.Flags().String("text", "", "The text of the text source, or the go template of the template source")
+	resourceAddCmd.Flags().String("path", "", "The local path of the file and dir sources")
+	resourceCmd.AddCommand(resourceAddCmd)
+
+	var resourceDeleteCmd = &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a resource from a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    resourceDeleteHandler,
+	}
+	resourceDeleteCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	resourceDeleteCmd.Flags().StringP("uri", "u", "", "The uri of the resource")
+	resourceCmd.AddCommand(resourceDeleteCmd)
+
+	promptCmd := &cobra.Command{
+		Use:   "prompt",
+		Short: "Manage the prompts of MCP servers",
+	}
+	rootCmd.AddCommand(promptCmd)
+
+	var promptListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the prompts of a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    promptListHandler,
+	}
+	promptListCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	promptCmd.AddCommand(promptListCmd)
+
+	var promptCreateCmd = &cobra.Command{
+		Use:     "create",
+		Short:   "Create a prompt in a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    promptCreateHandler,
+	}
+	promptCreateCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	promptCreateCmd.Flags().StringP("name", "n", "", "The name of the prompt")
+	promptCreateCmd.Flags().StringP("desc", "d", "", "The description of the prompt")
+	promptCreateCmd.Flags().StringArrayP("message", "m", nil, "A message of the prompt as role:template, the template is a go template of the arguments")
+	promptCreateCmd.Flags().StringArray("arg", nil, "An argument of the prompt as name:description")
+	promptCreateCmd.Flags().StringSlice("required", nil, "The required arguments of the prompt")
+	promptCreateCmd.Flags().StringP("file", "f", "", "The path of a json prompt, instead of the flags")
+	promptCmd.AddCommand(promptCreateCmd)
+
+	var promptRenderCmd = &cobra.Command{
+		Use:     "render",
+		Short:   "Preview the messages of a prompt rendered with the arguments",
+		PreRunE: probeServerReady,
+		RunE:    promptRenderHandler,
+	}
+	promptRenderCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	promptRenderCmd.Flags().StringP("name", "n", "", "The name of the prompt")
+	promptRenderCmd.Flags().StringArray("arg", nil, "An argument of the prompt as key=value")
+	promptCmd.AddCommand(promptRenderCmd)
+
+	var promptDeleteCmd = &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a prompt from a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    promptDeleteHandler,
+	}
+	promptDeleteCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	promptDeleteCmd.Flags().StringP("name", "n", "", "The name of the prompt")
+	promptCmd.AddCommand(promptDeleteCmd)
+
+	policyCmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Manage the policies deciding the tool calls of MCP servers",
+		Long: "Manage the policies deciding the tool calls of MCP servers. The policies of a server are evaluated in\n" +
+			"order before a tool runs, the first matching one allows, denies or requires an approval of the call,\n" +
+			"a call no policy matches is allowed. The conditions are CEL expressions over identity, server, tool,\n" +
+			"args and now, e.g. identity.subject == \"alice\" && args.path.startsWith(\"/tmp/\").",
+	}
+	rootCmd.AddCommand(policyCmd)
+
+	var policyListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the policies of a MCP server in the order they are evaluated",
+		PreRunE: probeServerReady,
+		RunE:    policyListHandler,
+	}
+	policyListCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	policyCmd.AddCommand(policyListCmd)
+
+	var policyAddCmd = &cobra.Command{
+		Use:     "add",
+		Short:   "Add a policy to a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    policyAddHandler,
+	}
+	policyAddCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	policyAddCmd.Flags().StringP("name", "n", "", "The name of the policy")
+	policyAddCmd.Flags().StringP("desc", "d", "", "The description of the policy")
+	policyAddCmd.Flags().StringArray("tool", nil, "A pattern of the tools the policy applies to, all the tools if not set")
+	policyAddCmd.Flags().String("when", "", "The CEL condition of the policy, it matches every call if empty")
+	policyAddCmd.Flags().String("decision", string(mcp.DecisionDeny), "The decision of the matched calls, allow, deny or require-approval")
+	policyAddCmd.Flags().String("reason", "", "The reason told to the caller of a denied call")
+	policyAddCmd.Flags().String("before", "", "Insert the policy before the policy of the name, it's appended if empty")
+	policyCmd.AddCommand(policyAddCmd)
+
+	var policyDeleteCmd = &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a policy from a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    policyDeleteHandler,
+	}
+	policyDeleteCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	policyDeleteCmd.Flags().StringP("name", "n", "", "The name of the policy")
+	policyCmd.AddCommand(policyDeleteCmd)
+
+	var policyEvalCmd = &cobra.Command{
+		Use:     "eval",
+		Short:   "Evaluate the policies of a MCP server against a call without running the tool",
+		PreRunE: probeServerReady,
+		RunE:    policyEvalHandler,
+	}
+	policyEvalCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	policyEvalCmd.Flags().StringP("tool", "t", "", "The name of the tool")
+	policyEvalCmd.Flags().String("args", "", "The arguments of the call as a json object")
+	policyEvalCmd.Flags().String("sub", "", "The subject of the caller, anonymous if empty")
+	policyEvalCmd.Flags().StringSlice("group", nil, "The groups of the caller")
+	policyEvalCmd.Flags().StringSlice("scope", nil, "The scopes of the caller")
+	policyEvalCmd.Flags().String("time", "", "The time of the call in RFC 3339, now if empty")
+	policyCmd.AddCommand(policyEvalCmd)
+
+	var stdioCmd = &cobra.Command{
+		Use:   "stdio",
+		Short: "Serve a MCP server over stdio, for the clients that only launch local servers",
+		Long: "Serve a MCP server over stdio. The messages are bridged to the streamable http endpoint of the\n" +
+			"OMCP server, or the server is run in-process from the persisted state if --data-dir is set.",
+		RunE: stdioHandler,
+	}
+	stdioCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	stdioCmd.Flags().String("host", config.Host(), "The host of the OMCP server to bridge to")
+	stdioCmd.Flags().String("key", "", "The client key or the oauth bearer token of the MCP server if it requires one, OMCP_CLIENT_KEY by default")
+	stdioCmd.Flags().String("data-dir", "", "The directory of the persisted OMCP state, to run the server in-process")
+	stdioCmd.Flags().String("store", config.StoreDriver(), "The store driver of the persisted OMCP state, file or sqlite")
+	stdioCmd.Flags().String("master-key-file", config.MasterKeyFile(), "The file of the key encrypting the persisted secrets, OMCP_MASTER_KEY if empty")
+	stdioCmd.Flags().String("plugin-dir", "", "The directory storing the plugin files by their digest, plugins in the data directory if empty")
+	stdioCmd.Flags().String("plugin-trust-dir", "", "The directory of the public keys trusted to sign the plugins, trusted-keys in the data directory if empty")
+	stdioCmd.Flags().Bool("allow-unsigned-plugins", false, "Load the unsigned plugins, the signed ones are still verified")
+	rootCmd.AddCommand(stdioCmd)
+
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage the admin API tokens",
+	}
+	rootCmd.AddCommand(tokenCmd)
+
+	var tokenListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the admin API tokens",
+		PreRunE: probeServerReady,
+		RunE:    tokenListHandler,
+	}
+	tokenCmd.AddCommand(tokenListCmd)
+
+	var tokenCreateCmd = &cobra.Command{
+		Use:     "create",
+		Short:   "Create an admin API token, the token is shown only once",
+		PreRunE: probeServerReady,
+		RunE:    tokenCreateHandler,
+	}
+	tokenCreateCmd.Flags().StringP("name", "n", "", "The name of the token")
+	tokenCreateCmd.Flags().StringSlice("role", []string{string(auth.RoleAdmin)}, "The roles of the token, admin, operator, viewer or plugin-publisher")
+	tokenCreateCmd.Flags().StringSlice("server", nil, "Scope the roles to the servers matching the patterns, e.g. web-*")
+	tokenCreateCmd.Flags().String("selector", "", "Scope the roles to the servers matching the label selector, e.g. env=prod,team!=infra")
+	tokenCreateCmd.Flags().Duration("ttl", 0, "The lifetime of the token, e.g. 720h, it never expires if 0")
+	tokenCmd.AddCommand(tokenCreateCmd)
+
+	var tokenRevokeCmd = &cobra.Command{
+		Use:     "revoke",
+		Short:   "Revoke an admin API token",
+		PreRunE: probeServerReady,
+		RunE:    tokenRevokeHandler,
+	}
+	tokenRevokeCmd.Flags().StringP("name", "n", "", "The name or the id of the token")
+	tokenCmd.AddCommand(tokenRevokeCmd)
+
+	keyCmd := &cobra.Command{
+		Use:   "key",
+		Short: "Manage the client keys of the MCP servers",
+	}
+	rootCmd.AddCommand(keyCmd)
+
+	var keyListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the client keys",
+		PreRunE: probeServerReady,
+		RunE:    keyListHandler,
+	}
+	keyListCmd.Flags().StringP("server", "s", "", "The name of the MCP server, all the servers if empty")
+	keyCmd.AddCommand(keyListCmd)
+
+	var keyCreateCmd = &cobra.Command{
+		Use:     "create",
+		Short:   "Create a client key of a MCP server, the key is shown only once",
+		Long:    "Create a client key of a MCP server, the key is shown only once. Once a server has a key, its clients must present one.",
+		PreRunE: probeServerReady,
+		RunE:    keyCreateHandler,
+	}
+	keyCreateCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	keyCreateCmd.Flags().StringP("name", "n", "", "The name of the key")
+	keyCreateCmd.Flags().StringArray("tool", nil, "A pattern of the tools the key can use, e.g. github__*, all the tools if not set")
+	keyCreateCmd.Flags().StringArray("resource", nil, "A pattern of the resource uris the key can read, all the resources if not set")
+	keyCreateCmd.Flags().Duration("ttl", 0, "The lifetime of the key, e.g. 720h, it never expires if 0")
+	keyCmd.AddCommand(keyCreateCmd)
+
+	var keyRevokeCmd = &cobra.Command{
+		Use:     "revoke",
+		Short:   "Revoke a client key",
+		Long:    "Revoke a client key. The server still requires a key once its last key is revoked, until the server is deleted.",
+		PreRunE: probeServerReady,
+		RunE:    keyRevokeHandler,
+	}
+	keyRevokeCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	keyRevokeCmd.Flags().StringP("name", "n", "", "The name or the id of the key")
+	keyCmd.AddCommand(keyRevokeCmd)
+
+	oauthCmd := &cobra.Command{
+		Use:   "oauth",
+		Short: "Run a local oauth issuer to test the bearer tokens of the MCP endpoints",
+	}
+	rootCmd.AddCommand(oauthCmd)
+
+	var oauthKeygenCmd = &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate the signing key and the jwks of a local issuer",
+		Long: "Generate the signing key and the jwks of a local issuer. Reference the jwks file as the jwks_file\n" +
+			"of an issuer in the oauth config of omcp serve, then sign the tokens with omcp oauth token.",
+		RunE: oauthKeygenHandler,
+	}
+	oauthKeygenCmd.Flags().String("dir", "./issuer", "The directory to write the key and the jwks")
+	oauthCmd.AddCommand(oauthKeygenCmd)
+
+	var oauthTokenCmd = &cobra.Command{
+		Use:   "token",
+		Short: "Sign a bearer token with the key of a local issuer",
+		RunE:  oauthTokenHandler,
+	}
+	oauthTokenCmd.Flags().String("key", "./issuer/"+auth.IssuerKeyFile, "The signing key generated by omcp oauth keygen")
+	oauthTokenCmd.Flags().String("issuer", "", "The issuer of the token")
+	oauthTokenCmd.Flags().String("sub", "", "The subject of the token")
+	oauthTokenCmd.Flags().StringSlice("aud", nil, "The audiences of the token, the resource of the oauth config")
+	oauthTokenCmd.Flags().StringSlice("scope", nil, "The scopes of the token")
+	oauthTokenCmd.Flags().StringSlice("group", nil, "The groups of the subject")
+	oauthTokenCmd.Flags().Duration("ttl", time.Hour, "The lifetime of the token")
+	oauthCmd.AddCommand(oauthTokenCmd)
+
+	var loadCmd = &cobra.Command{
+		Use:     "load",
+		Short:   "Load plugins into a MCP server",
+		PreRunE: probeServerReady,
+		RunE:    loadHandler,
+	}
+	loadCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	loadCmd.Flags().StringP("file", "f", "", "The path of the plugin file")
+	loadCmd.Flags().StringP("type", "t", mcp.PluginTypeTool, "The type of the plugins, tool or resource")
+	loadCmd.Flags().StringSlice("var", nil, "The exported variables of the plugin file to load")
+	loadCmd.Flags().String("signature", "", "The detached signature of the plugin file, the file with the .sig suffix if it exists")
+	rootCmd.AddCommand(loadCmd)
+
+	pluginCmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "Sign and verify the plugin files",
+		Long: "Sign and verify the plugin files. The OMCP server stores the plugin files by their SHA-256 and only\n" +
+			"loads the ones signed by a key of its trust dir, unless it allows the unsigned plugins. Copy the\n" +
+			"public key generated by omcp plugin keygen into the trust dir of the server.",
+	}
+	rootCmd.AddCommand(pluginCmd)
+
+	var pluginKeygenCmd = &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate an ed25519 key to sign the plugin files",
+		RunE:  pluginKeygenHandler,
+	}
+	pluginKeygenCmd.Flags().String("dir", "./signing", "The directory to write the signing key and the public key")
+	pluginCmd.AddCommand(pluginKeygenCmd)
+
+	var pluginSignCmd = &cobra.Command{
+		Use:   "sign",
+		Short: "Write the detached signature of a plugin file",
+		RunE:  pluginSignHandler,
+	}
+	pluginSignCmd.Flags().String("key", "./signing/"+artifact.SigningKeyFile, "The signing key generated by omcp plugin keygen")
+	pluginSignCmd.Flags().StringP("file", "f", "", "The path of the plugin file")
+	pluginSignCmd.Flags().StringP("out", "o", "", "The path of the signature, the plugin file with the .sig suffix if empty")
+	pluginCmd.AddCommand(pluginSignCmd)
+
+	var pluginVerifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the detached signature of a plugin file against the trusted keys",
+		RunE:  pluginVerifyHandler,
+	}
+	pluginVerifyCmd.Flags().StringP("file", "f", "", "The path of the plugin file")
+	pluginVerifyCmd.Flags().String("signature", "", "The path of the signature, the plugin file with the .sig suffix if empty")
+	pluginVerifyCmd.Flags().String("trust-dir", "", "The directory of the trusted public keys")
+	pluginCmd.AddCommand(pluginVerifyCmd)
+
+	var auditCmd = &cobra.Command{
+		Use:     "audit",
+		Short:   "Query the audit log of the admin actions and the tool calls",
+		PreRunE: probeServerReady,
+		RunE:    auditHandler,
+	}
+	auditCmd.Flags().String("actor", "", "The token or the subject of the entries")
+	auditCmd.Flags().String("action", "", "The action of the entries, e.g. server.create, or a prefix as server")
+	auditCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	auditCmd.Flags().StringP("tool", "t", "", "The name of the tool")
+	auditCmd.Flags().String("status", "", "The status of the entries, success, failure or denied")
+	auditCmd.Flags().Duration("since", 0, "Only the entries of the last duration, e.g. 10m")
+	auditCmd.Flags().Int("limit", 50, "The number of the latest entries, all of them if 0")
+	auditCmd.Flags().Bool("json", false, "Print the entries as json lines with the arguments")
+	rootCmd.AddCommand(auditCmd)
+
+	secretCmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Manage the secrets referenced by the tools and the upstreams",
+		Long: "Manage the secrets referenced by the tools and the upstreams. The OMCP server encrypts them with its\n" +
+			"master key. A tool added with --secret receives them in the context of its handler, and the env and\n" +
+			"the headers of an upstream reference them as ${secret:name}. Their values are never shown again.",
+	}
+	rootCmd.AddCommand(secretCmd)
+
+	var secretListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the secrets, without their values",
+		PreRunE: probeServerReady,
+		RunE:    secretListHandler,
+	}
+	secretCmd.AddCommand(secretListCmd)
+
+	var secretSetCmd = &cobra.Command{
+		Use:     "set",
+		Short:   "Create a secret or replace its value, the value is read from stdin if not given",
+		PreRunE: probeServerReady,
+		RunE:    secretSetHandler,
+	}
+	secretSetCmd.Flags().StringP("name", "n", "", "The name of the secret")
+	secretSetCmd.Flags().StringP("desc", "d", "", "The description of the secret, kept if empty")
+	secretSetCmd.Flags().String("value", "", "The value of the secret, prefer stdin or --from-file to keep it out of the shell history")
+	secretSetCmd.Flags().String("from-file", "", "The file of the value of the secret")
+	secretCmd.AddCommand(secretSetCmd)
+
+	var secretDeleteCmd = &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a secret",
+		PreRunE: probeServerReady,
+		RunE:    secretDeleteHandler,
+	}
+	secretDeleteCmd.Flags().StringP("name", "n", "", "The name of the secret")
+	secretCmd.AddCommand(secretDeleteCmd)
+
+	var secretKeygenCmd = &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a master key file for omcp serve --master-key-file",
+		RunE:  secretKeygenHandler,
+	}
+	secretKeygenCmd.Flags().StringP("out", "o", "./master.key", "The path of the master key, an existing file is never overwritten")
+	secretCmd.AddCommand(secretKeygenCmd)
+
+	approvalCmd := &cobra.Command{
+		Use:   "approval",
+		Short: "Decide the tool calls waiting for approval",
+		Long: "Decide the tool calls waiting for approval. A call of a tool added with --require-approval, or a call\n" +
+			"a policy decides as require-approval, waits until an operator approves or rejects it, or it times out.",
+	}
+	rootCmd.AddCommand(approvalCmd)
+
+	var approvalListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the approvals, the pending ones by default",
+		PreRunE: probeServerReady,
+		RunE:    approvalListHandler,
+	}
+	approvalListCmd.Flags().String("status", string(mcp.ApprovalPending), "The status of the approvals, pending, approved, rejected, expired or canceled, all of them if empty")
+	approvalListCmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	approvalCmd.AddCommand(approvalListCmd)
+
+	var approvalShowCmd = &cobra.Command{
+		Use:     "show <id>",
+		Short:   "Show an approval with the arguments of its call",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: probeServerReady,
+		RunE:    approvalShowHandler,
+	}
+	approvalCmd.AddCommand(approvalShowCmd)
+
+	var approvalApproveCmd = &cobra.Command{
+		Use:     "approve <id>",
+		Short:   "Approve a pending tool call, the call runs",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: probeServerReady,
+		RunE:    approvalDecideHandler(web.ApprovalDecisionApprove),
+	}
+	approvalApproveCmd.Flags().StringP("comment", "m", "", "The comment recorded with the decision")
+	approvalCmd.AddCommand(approvalApproveCmd)
+
+	var approvalRejectCmd = &cobra.Command{
+		Use:     "reject <id>",
+		Short:   "Reject a pending tool call, the caller is told the comment",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: probeServerReady,
+		RunE:    approvalDecideHandler(web.ApprovalDecisionReject),
+	}
+	approvalRejectCmd.Flags().StringP("comment", "m", "", "The comment recorded with the decision and told to the caller")
+	approvalCmd.AddCommand(approvalRejectCmd)
+
+	callsCmd := &cobra.Command{
+		Use:   "calls",
+		Short: "Query the history of the tool calls",
+		Long: "Query the history of the tool calls. The OMCP server records every tool call with its client session,\n" +
+			"the arguments, a summary of the result or the error, and its duration, up to --history-size calls.",
+	}
+	rootCmd.AddCommand(callsCmd)
+
+	var callsListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the latest tool calls",
+		PreRunE: probeServerReady,
+		RunE:    callsListHandler,
+	}
+	addCallFilterFlags(callsListCmd)
+	callsListCmd.Flags().Duration("since", 0, "Only the calls of the last duration, e.g. 10m")
+	callsListCmd.Flags().Int("limit", 50, "The number of the latest calls, all of them if 0")
+	callsCmd.AddCommand(callsListCmd)
+
+	var callsShowCmd = &cobra.Command{
+		Use:     "show <id>",
+		Short:   "Show a tool call with its arguments and result",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: probeServerReady,
+		RunE:    callsShowHandler,
+	}
+	callsCmd.AddCommand(callsShowCmd)
+
+	var callsTailCmd = &cobra.Command{
+		Use:     "tail",
+		Short:   "Print the latest tool calls and follow the new ones",
+		PreRunE: probeServerReady,
+		RunE:    callsTailHandler,
+	}
+	addCallFilterFlags(callsTailCmd)
+	callsTailCmd.Flags().IntP("lines", "n", 10, "The number of the latest calls printed first")
+	callsTailCmd.Flags().Duration("interval", time.Second, "How often the new calls are fetched")
+	callsCmd.AddCommand(callsTailCmd)
+
 	return rootCmd
 }
 
-func serveHandler(cmd *cobra.Command, args []string) error {
-	server := web.NewHttpServer()
-	err := server.Run(":8080")
+func addCallFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	cmd.Flags().StringP("tool", "t", "", "The name of the tool")
+	cmd.Flags().String("session", "", "The id of the client session")
+	cmd.Flags().String("status", "", "The status of the calls, success, error or denied")
+}
+
+func serveHandler(cmd *cobra.Command, args []string) error {
+	driver, _ := cmd.Flags().GetString("store")
+	dataDir, _ := cmd.Flags().GetString("data-dir")
+	logFile, err := setupLogging(cmd)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	st, err := store.Open(driver, dataDir)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	shutdownTracing, err := setupTracing(cmd, dataDir)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	server := web.NewHttpServer(st)
+	auditLogger, err := openAudit(cmd, dataDir)
+	if err != nil {
+		return err
+	}
+	defer auditLogger.Close()
+	server.SetAudit(auditLogger)
+	setPlugins(cmd, server, dataDir)
+	secrets, err := openSecrets(cmd, st)
+	if err != nil {
+		return err
+	}
+	if secrets != nil {
+		server.SetSecrets(secrets)
+	}
+	approvalTimeout, _ := cmd.Flags().GetDuration("approval-timeout")
+	approvalRetention, _ := cmd.Flags().GetDuration("approval-retention")
+	server.SetApprovals(mcp.NewApprovals(approvalTimeout, approvalRetention, store.ApprovalPersister{Store: st}))
+	historySize, _ := cmd.Flags().GetInt("history-size")
+	historyRetention, _ := cmd.Flags().GetDuration("history-retention")
+	server.SetHistory(mcp.NewHistory(historySize, historyRetention, store.CallPersister{Store: st}))
+	if path, _ := cmd.Flags().GetString("oauth-config"); path != "" {
+		oauthConfig, err := auth.LoadOAuthConfig(path)
+		if err != nil {
+			return err
+		}
+		if err := server.SetOAuth(oauthConfig); err != nil {
+			return err
+		}
+	}
+	if err := setTLS(cmd, server); err != nil {
+		return err
+	}
+	metricsAddr, _ := cmd.Flags().GetString("metrics-addr")
+	if err := server.ExposeMetrics(metricsAddr); err != nil {
+		return err
+	}
+	if err := server.Restore(); err != nil {
+		return err
+	}
+	token, err := server.Bootstrap()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		cmd.Printf("no active admin API token, created the %s token, it's shown only once:\n\n    %s\n\n", auth.BootstrapTokenName, token)
+		cmd.Println("export it as OMCP_TOKEN to use the CLI")
+	}
+	addr, _ := cmd.Flags().GetString("addr")
+	err = server.Run(addr)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// setTLS serves over tls if the serve flags have a certificate
+func setTLS(cmd *cobra.Command, server *web.OmcpServer) error {
+	tlsConfig := &auth.TLSConfig{}
+	tlsConfig.CertFile, _ = cmd.Flags().GetString("tls-cert")
+	tlsConfig.KeyFile, _ = cmd.Flags().GetString("tls-key")
+	tlsConfig.ClientCAFile, _ = cmd.Flags().GetString("tls-client-ca")
+	rolesPath, _ := cmd.Flags().GetString("tls-roles")
+	if tlsConfig.CertFile == "" && tlsConfig.KeyFile == "" && tlsConfig.ClientCAFile == "" && rolesPath == "" {
+		return nil
+	}
+	if tlsConfig.ClientCAFile != "" {
+		tlsConfig.ClientAuth, _ = cmd.Flags().GetString("tls-client-auth")
+	}
+	if rolesPath != "" {
+		roles, err := auth.LoadIdentityRoles(rolesPath)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Roles = roles
+	}
+	return server.SetTLS(tlsConfig)
+}
+
+// setPlugins configures the plugin artifact store and the trusted keys of the serve flags
+func setPlugins(cmd *cobra.Command, server *web.OmcpServer, dataDir string) {
+	server.SetPlugins(pluginPolicy(cmd, dataDir))
+}
+
+// pluginPolicy is the plugin artifact store and the policy of the plugin flags
+func pluginPolicy(cmd *cobra.Command, dataDir string) (*artifact.Store, artifact.Policy) {
+	pluginDir, _ := cmd.Flags().GetString("plugin-dir")
+	if pluginDir == "" {
+		pluginDir = filepath.Join(dataDir, "plugins")
+	}
+	trustDir, _ := cmd.Flags().GetString("plugin-trust-dir")
+	if trustDir == "" {
+		trustDir = filepath.Join(dataDir, "trusted-keys")
+	}
+	allowUnsigned, _ := cmd.Flags().GetBool("allow-unsigned-plugins")
+	return artifact.NewStore(pluginDir), artifact.Policy{
+		Trust:         artifact.NewTrustStore(trustDir),
+		AllowUnsigned: allowUnsigned,
+	}
+}
+
+// openSecrets decrypts the secrets with the master key of the flags or the env, nil without a key
+func openSecrets(cmd *cobra.Command, st store.Store) (*secret.Secrets, error) {
+	keyFile, _ := cmd.Flags().GetString("master-key-file")
+	if keyFile == "" && config.MasterKey() == "" {
+		return nil, nil
+	}
+	key, err := secret.LoadMasterKey(keyFile, config.MasterKey())
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := secret.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return secret.NewSecrets(cipher, store.SecretPersister{Store: st}), nil
+}
+
+// setupLogging configures the logger of the log flags, the returned closer closes the log file
+func setupLogging(cmd *cobra.Command) (io.Closer, error) {
+	logConfig := logging.Config{}
+	logConfig.Level, _ = cmd.Flags().GetString("log-level")
+	logConfig.Format, _ = cmd.Flags().GetString("log-format")
+	logConfig.File, _ = cmd.Flags().GetString("log-file")
+	maxSize, _ := cmd.Flags().GetInt("log-max-size")
+	logConfig.MaxSize = int64(maxSize) << 20
+	logConfig.MaxBackups, _ = cmd.Flags().GetInt("log-max-backups")
+	closer, err := logging.Setup(logConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up logging: %w", err)
+	}
+	return closer, nil
+}
+
+// setupTracing installs the exporter of the trace flags
+func setupTracing(cmd *cobra.Command, dataDir string) (func(context.Context) error, error) {
+	traceConfig := tracing.Config{}
+	traceConfig.Exporter, _ = cmd.Flags().GetString("trace-exporter")
+	traceConfig.Endpoint, _ = cmd.Flags().GetString("trace-endpoint")
+	traceConfig.File, _ = cmd.Flags().GetString("trace-file")
+	traceConfig.SampleRatio, _ = cmd.Flags().GetFloat64("trace-sample-ratio")
+	if traceConfig.Exporter == tracing.ExporterFile && traceConfig.File == "" {
+		traceConfig.File = filepath.Join(dataDir, "traces.json")
+	}
+	shutdown, err := tracing.Setup(cmd.Context(), traceConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	return shutdown, nil
+}
+
+// openAudit opens the audit log file and the other sinks of the serve flags
+func openAudit(cmd *cobra.Command, dataDir string) (*audit.Logger, error) {
+	path, _ := cmd.Flags().GetString("audit-log")
+	if path == "" {
+		path = filepath.Join(dataDir, "audit.log")
+	}
+	maxSize, _ := cmd.Flags().GetInt("audit-max-size")
+	maxBackups, _ := cmd.Flags().GetInt("audit-max-backups")
+	fileSink, err := audit.NewFileSink(path, int64(maxSize)<<20, maxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	sinks := []audit.Sink{fileSink}
+	if stdout, _ := cmd.Flags().GetBool("audit-stdout"); stdout {
+		sinks = append(sinks, audit.NewWriterSink(cmd.OutOrStdout()))
+	}
+	redactKeys, _ := cmd.Flags().GetStringSlice("audit-redact")
+	return audit.NewLogger(redactKeys, sinks...), nil
+}
+
+// stdioHandler serves a MCP server over stdio, stdout carries the messages so everything else goes to stderr
+func stdioHandler(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("server")
+	if name == "" {
+		return fmt.Errorf("server is required")
+	}
+	if err := serveStdio(cmd, name); err != nil {
+		return err
+	}
+	return nil
+}
+
+func serveStdio(cmd *cobra.Command, name string) error {
+	logger := log.New(os.Stderr, "omcp: ", log.LstdFlags)
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if dataDir, _ := cmd.Flags().GetString("data-dir"); dataDir != "" {
+		driver, _ := cmd.Flags().GetString("store")
+		st, err := store.Open(driver, dataDir)
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+		servers, err := store.LoadServers(st)
+		if err != nil {
+			return err
+		}
+		idx := slices.IndexFunc(servers, func(s *mcp.MCPServer) bool { return s.Name == name })
+		if idx < 0 {
+			return fmt.Errorf("%w: %s", mcp.ErrServerNotFound, name)
+		}
+		// a gateway is served along with its members, the registry isn't persisted
+		restore := []*mcp.MCPServer{servers[idx]}
+		if gateway := servers[idx].Gateway; gateway != nil {
+			for _, saved := range servers {
+				if slices.Contains(gateway.Members, saved.Name) {
+					restore = append(restore, saved)
+				}
+			}
+		}
+		registry := mcp.NewRegistry(nil)
+		secrets, err := openSecrets(cmd, st)
+		if err != nil {
+			return err
+		}
+		if secrets != nil {
+			saved, err := store.LoadSecrets(st)
+			if err != nil {
+				return err
+			}
+			if err := secrets.Add(saved...); err != nil {
+				return fmt.Errorf("failed to decrypt the secrets, check the master key: %w", err)
+			}
+			registry.SetSecrets(secrets)
+		}
+		// the plugins are checked like serve does, so the stdio mode doesn't load the ones it rejects
+		plugins, policy := pluginPolicy(cmd, dataDir)
+		check := func(plugin *mcp.Plugin) error { return mcp.CheckPlugin(plugin, plugins, policy) }
+		for _, saved := range restore {
+			saved.DropPlugins(check, func(item string, err error) {
+				logger.Printf("drop %s of server %s: %v", item, saved.Name, err)
+			})
+			mcpServer, err := mcp.RestoreMcpServer(saved, mcp.ResolveTool)
+			if err != nil {
+				// the server is still usable without the unresolved tools
+				logger.Println(err)
+			}
+			if err := registry.Add(mcpServer); err != nil {
+				return err
+			}
+		}
+		mcpServer, err := registry.Get(name)
+		if err != nil {
+			return err
+		}
+		return mcpServer.ServeStdio(ctx, os.Stdin, os.Stdout)
+	}
+
+	host, _ := cmd.Flags().GetString("host")
+	key, _ := cmd.Flags().GetString("key")
+	if key == "" {
+		key = config.ClientKey()
+	}
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	bridge := newStdioBridge(fmt.Sprintf("%s/mcp/%s/mcp", strings.TrimSuffix(host, "/"), name), key, client, os.Stdout, logger)
+	return bridge.Run(ctx, os.Stdin)
+}
+
+// createHandler creates a new MCP server
+func createHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	req := web.CreateMcpServerReq{Name: name}
+	req.Desc, _ = cmd.Flags().GetString("desc")
+	req.Version, _ = cmd.Flags().GetString("version")
+	req.Transports, _ = cmd.Flags().GetStringSlice("transport")
+	upstream, err := upstreamFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	req.Upstream = upstream
+	if members, _ := cmd.Flags().GetStringSlice("member"); len(members) > 0 {
+		req.Gateway = &mcp.Gateway{Members: members}
+		req.Gateway.Namespace, _ = cmd.Flags().GetString("namespace")
+		req.Gateway.Separator, _ = cmd.Flags().GetString("separator")
+	}
+	labels, _ := cmd.Flags().GetStringArray("label")
+	if req.Labels, err = keyValues(labels); err != nil {
+		return err
+	}
+	err = cli.CreateMcpServer(req)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// upstreamFromFlags builds the upstream of a proxied server, nil if no upstream is set
+func upstreamFromFlags(cmd *cobra.Command) (*mcp.Upstream, error) {
+	command, _ := cmd.Flags().GetString("upstream-command")
+	url, _ := cmd.Flags().GetString("upstream-url")
+	switch {
+	case command != "" && url != "":
+		return nil, fmt.Errorf("upstream-command and upstream-url are exclusive")
+	case command != "":
+		upstream := &mcp.Upstream{Type: mcp.UpstreamStdio, Command: command}
+		upstream.Args, _ = cmd.Flags().GetStringArray("upstream-arg")
+		env, _ := cmd.Flags().GetStringArray("upstream-env")
+		vars, err := keyValues(env)
+		if err != nil {
+			return nil, err
+		}
+		upstream.Env = vars
+		return upstream, nil
+	case url != "":
+		upstream := &mcp.Upstream{URL: url}
+		upstream.Type, _ = cmd.Flags().GetString("upstream-transport")
+		headers, _ := cmd.Flags().GetStringArray("upstream-header")
+		vars, err := keyValues(headers)
+		if err != nil {
+			return nil, err
+		}
+		upstream.Headers = vars
+		return upstream, nil
+	}
+	return nil, nil
+}
+
+// keyValues parses the KEY=VALUE pairs
+func keyValues(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid %q, expected KEY=VALUE", pair)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func deleteHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	err := cli.DeleteMcpServer(name)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func listHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	servers, err := cli.ListMcpServers()
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Description", "Version", "Status", "Transports", "Source", "Labels", "Created_At", "Updated_At"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, server := range servers {
+		source := ""
+		if server.Upstream != nil {
+			source = server.Upstream.String()
+			if status := server.UpstreamStatus; server.State == mcp.McpServerStateRunning && status != nil && !status.Connected {
+				source += " (disconnected)"
+			}
+		}
+		if server.Gateway != nil {
+			source = server.Gateway.String()
+			if status := server.GatewayStatus; server.State == mcp.McpServerStateRunning && status != nil && len(status.Unavailable) > 0 {
+				source += fmt.Sprintf(" (unavailable: %s)", strings.Join(status.Unavailable, ","))
+			}
+		}
+		table.Append([]string{server.Name, server.Desc, server.Version, string(server.State), strings.Join(server.Transports, ","), source, mcp.FormatLabels(server.Labels), server.CreatedAt.Format(time.DateTime), server.UpdatedAt.Format(time.DateTime)})
+	}
+	table.Render()
+	return nil
+}
+
+func startHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	err := cli.StartMcpServer(name)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func logsHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	req := web.ServerLogsReq{}
+	req.Name, _ = cmd.Flags().GetString("name")
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	req.Follow, _ = cmd.Flags().GetBool("follow")
+	if since, _ := cmd.Flags().GetDuration("since"); since > 0 {
+		req.Since = time.Now().Add(-since)
+	}
+	asJSON, _ := cmd.Flags().GetBool("json")
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	return cli.ServerLogs(ctx, req, func(line mcp.LogLine) error {
+		if asJSON {
+			return encoder.Encode(line)
+		}
+		_, err := fmt.Fprintln(cmd.OutOrStdout(), formatLogLine(line))
+		return err
+	})
+}
+
+// formatLogLine formats the line like the text logs, with the fields sorted by key
+func formatLogLine(line mcp.LogLine) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-7s %s", line.Time.Local().Format(time.DateTime), strings.ToUpper(line.Level), line.Message)
+	keys := make([]string, 0, len(line.Fields))
+	for key := range line.Fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value := line.Fields[key]
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+	return b.String()
+}
+
+func stopHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	err := cli.StopMcpServer(name)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func loadHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	file, _ := cmd.Flags().GetString("file")
+	if file == "" {
+		return fmt.Errorf("file is required")
+	}
+	vars, _ := cmd.Flags().GetStringSlice("var")
+	if len(vars) == 0 {
+		return fmt.Errorf("var is required")
+	}
+	mcpType, _ := cmd.Flags().GetString("type")
+
+	plugins := make([]mcp.Plugin, 0, len(vars))
+	for _, varName := range vars {
+		plugins = append(plugins, mcp.Plugin{
+			MCPType: mcpType,
+			Name:    varName,
+			VarName: varName,
+		})
+	}
+	signature, _ := cmd.Flags().GetString("signature")
+	if signature == "" {
+		if _, err := os.Stat(file + ".sig"); err == nil {
+			signature = file + ".sig"
+		}
+	}
+	resp, err := cli.Load(server, file, signature, plugins)
+	if err != nil {
+		return err
+	}
+	signer := resp.Signer
+	if signer == "" {
+		signer = "unsigned"
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "stored plugin %s, signed by %s\n", resp.Digest, signer)
+	results := resp.Results
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Plugin", "Success", "Message", "Tools", "Resources"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	for _, result := range results {
+		table.Append([]string{result.Name, strconv.FormatBool(result.Success), result.Message, strings.Join(result.Tools, ","), strings.Join(result.Resources, ",")})
+	}
+	table.Render()
+	return nil
+}
+func addToolFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("server", "s", "", "The name of the MCP server")
+	cmd.Flags().StringP("name", "n", "", "The name of the tool")
+	cmd.Flags().StringP("desc", "d", "", "The description of the tool, overrides the one of the source")
+	cmd.Flags().String("source", web.ToolSourceCatalog, "The source of the tool, catalog, plugin or definition")
+	cmd.Flags().String("plugin-file", "", "The digest of a loaded plugin file, for the plugin source")
+	cmd.Flags().String("var", "", "The exported variable of the plugin, for the plugin source")
+	cmd.Flags().String("definition", "", "The path of a json tool definition, for the definition source")
+	cmd.Flags().StringSlice("secret", nil, "A secret the handler of the tool receives in its context, besides the ones the plugin declares")
+	cmd.Flags().Bool("require-approval", false, "Hold every call of the tool until an operator approves it")
+}
+
+// toolReq builds the tool request from the flags
+func toolReq(cmd *cobra.Command) (web.AddToolReq, error) {
+	req := web.AddToolReq{}
+	req.Server, _ = cmd.Flags().GetString("server")
+	if req.Server == "" {
+		return req, fmt.Errorf("server is required")
+	}
+	req.Name, _ = cmd.Flags().GetString("name")
+	if req.Name == "" {
+		return req, fmt.Errorf("name is required")
+	}
+	req.Desc, _ = cmd.Flags().GetString("desc")
+	req.Secrets, _ = cmd.Flags().GetStringSlice("secret")
+	req.RequireApproval, _ = cmd.Flags().GetBool("require-approval")
+	req.Source, _ = cmd.Flags().GetString("source")
+	switch req.Source {
+	case web.ToolSourcePlugin:
+		pluginFile, _ := cmd.Flags().GetString("plugin-file")
+		varName, _ := cmd.Flags().GetString("var")
+		req.Plugin = &mcp.Plugin{
+			MCPType:    mcp.PluginTypeTool,
+			Name:       varName,
+			VarName:    varName,
+			PluginFile: pluginFile,
+		}
+	case web.ToolSourceDefinition:
+		path, _ := cmd.Flags().GetString("definition")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return req, err
+		}
+		req.Definition = &mcp.ToolDefinition{}
+		if err := json.Unmarshal(data, req.Definition); err != nil {
+			return req, fmt.Errorf("invalid definition %s: %w", path, err)
+		}
+	}
+	return req, nil
+}
+
+func toolListHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	catalog, _ := cmd.Flags().GetBool("catalog")
+	if server == "" && !catalog {
+		return fmt.Errorf("server is required")
+	}
+	tools, err := cli.ListTools(server, catalog)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Description", "Source", "Created_At", "Updated_At"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	for _, tool := range tools {
+		source := web.ToolSourceCatalog
+		if tool.Mount != "" {
+			source = "mount:" + tool.Mount
+		} else if tool.Plugin != nil {
+			source = web.ToolSourcePlugin
+		} else if tool.Definition != nil {
+			source = web.ToolSourceDefinition
+		}
+		table.Append([]string{tool.Name, tool.Desc, source, tool.CreatedAt.Format(time.DateTime), tool.UpdatedAt.Format(time.DateTime)})
+	}
+	table.Render()
+	return nil
+}
+
+func toolAddHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	req, err := toolReq(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err := cli.AddTool(req); err != nil {
+		return err
+	}
+	return nil
+}
+
+func toolUpdateHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	req, err := toolReq(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err := cli.UpdateTool(web.UpdateToolReq(req)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func toolDeleteHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := cli.DeleteTool(server, name); err != nil {
+		return err
+	}
+	return nil
+}
+
+func resourceListHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	resources, err := cli.ListResources(server)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"URI", "Name", "Description", "Mime_Type", "Source", "Created_At"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	for _, resource := range resources {
+		source := web.ToolSourcePlugin
+		if resource.Mount != "" {
+			source = "mount:" + resource.Mount
+		} else if resource.Source != nil {
+			source = resource.Source.Type
+		}
+		table.Append([]string{resource.URI, resource.Name, resource.Desc, resource.MimeType, source, resource.CreatedAt.Format(time.DateTime)})
+	}
+	table.Render()
+	return nil
+}
+
+func resourceAddHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	req := web.AddResourceReq{Source: &mcp.ResourceSource{}}
+	req.Server, _ = cmd.Flags().GetString("server")
+	if req.Server == "" {
+		return fmt.Errorf("server is required")
+	}
+	req.URI, _ = cmd.Flags().GetString("uri")
+	if req.URI == "" {
+		return fmt.Errorf("uri is required")
+	}
+	req.Name, _ = cmd.Flags().GetString("name")
+	req.Desc, _ = cmd.Flags().GetString("desc")
+	req.MimeType, _ = cmd.Flags().GetString("mime")
+	req.Source.Type, _ = cmd.Flags().GetString("source")
+	req.Source.Text, _ = cmd.Flags().GetString("text")
+	req.Source.Path, _ = cmd.Flags().GetString("path")
+	if _, err := cli.AddResource(req); err != nil {
+		return err
+	}
+	return nil
+}
+
+func resourceDeleteHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	uri, _ := cmd.Flags().GetString("uri")
+	if uri == "" {
+		return fmt.Errorf("uri is required")
+	}
+	if err := cli.DeleteResource(server, uri); err != nil {
+		return err
+	}
+	return nil
+}
+
+func promptListHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	prompts, err := cli.ListPrompts(server)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Description", "Arguments", "Messages", "Created_At"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	for _, prompt := range prompts {
+		arguments := make([]string, 0, len(prompt.Arguments))
+		for _, arg := range prompt.Arguments {
+			if arg.Required {
+				arguments = append(arguments, arg.Name+"*")
+			} else {
+				arguments = append(arguments, arg.Name)
+			}
+		}
+		table.Append([]string{prompt.Name, prompt.Desc, strings.Join(arguments, ","), strconv.Itoa(len(prompt.Messages)), prompt.CreatedAt.Format(time.DateTime)})
+	}
+	table.Render()
+	return nil
+}
+
+// promptFromFlags builds the prompt from the json file, or from the flags
+func promptFromFlags(cmd *cobra.Command) (mcp.MCPPrompt, error) {
+	var prompt mcp.MCPPrompt
+	if path, _ := cmd.Flags().GetString("file"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return prompt, err
+		}
+		if err := json.Unmarshal(data, &prompt); err != nil {
+			return prompt, fmt.Errorf("invalid prompt %s: %w", path, err)
+		}
+	}
+	if name, _ := cmd.Flags().GetString("name"); name != "" {
+		prompt.Name = name
+	}
+	if desc, _ := cmd.Flags().GetString("desc"); desc != "" {
+		prompt.Desc = desc
+	}
+	messages, _ := cmd.Flags().GetStringArray("message")
+	for _, message := range messages {
+		role, content, ok := strings.Cut(message, ":")
+		if !ok {
+			return prompt, fmt.Errorf("invalid message %q, expected role:template", message)
+		}
+		prompt.Messages = append(prompt.Messages, mcp.PromptMessage{Role: strings.TrimSpace(role), Content: content})
+	}
+	required, _ := cmd.Flags().GetStringSlice("required")
+	arguments, _ := cmd.Flags().GetStringArray("arg")
+	for _, argument := range arguments {
+		name, desc, _ := strings.Cut(argument, ":")
+		prompt.Arguments = append(prompt.Arguments, mcp.PromptArgument{
+			Name:     name,
+			Desc:     desc,
+			Required: slices.Contains(required, name),
+		})
+	}
+	return prompt, nil
+}
+
+func promptCreateHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	prompt, err := promptFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if prompt.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := cli.CreatePrompt(server, prompt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func promptRenderHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	values, _ := cmd.Flags().GetStringArray("arg")
+	arguments, err := keyValues(values)
+	if err != nil {
+		return err
+	}
+	messages, err := cli.RenderPrompt(server, name, arguments)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		cmd.Printf("[%s]\n%s\n\n", message.Role, message.Content)
+	}
+	return nil
+}
+
+func promptDeleteHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := cli.DeletePrompt(server, name); err != nil {
+		return err
+	}
+	return nil
+}
+
+func policyListHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	policies, err := cli.ListPolicies(server)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Tools", "When", "Decision", "Reason"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, policy := range policies {
+		tools := "*"
+		if len(policy.Tools) > 0 {
+			tools = strings.Join(policy.Tools, ",")
+		}
+		table.Append([]string{policy.Name, tools, policy.When, string(policy.Decision), policy.Reason})
+	}
+	table.Render()
+	return nil
+}
+
+func policyAddHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	req := web.AddPolicyReq{Server: server, Policy: mcp.Policy{Name: name}}
+	req.Policy.Desc, _ = cmd.Flags().GetString("desc")
+	req.Policy.Tools, _ = cmd.Flags().GetStringArray("tool")
+	req.Policy.When, _ = cmd.Flags().GetString("when")
+	decision, _ := cmd.Flags().GetString("decision")
+	req.Policy.Decision = mcp.Decision(decision)
+	req.Policy.Reason, _ = cmd.Flags().GetString("reason")
+	req.Before, _ = cmd.Flags().GetString("before")
+	return cli.AddPolicy(req)
+}
+
+func policyDeleteHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return cli.DeletePolicy(server, name)
+}
+
+func policyEvalHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	req := web.EvalPolicyReq{}
+	req.Server, _ = cmd.Flags().GetString("server")
+	if req.Server == "" {
+		return fmt.Errorf("server is required")
+	}
+	req.Tool, _ = cmd.Flags().GetString("tool")
+	if req.Tool == "" {
+		return fmt.Errorf("tool is required")
+	}
+	if raw, _ := cmd.Flags().GetString("args"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &req.Arguments); err != nil {
+			return fmt.Errorf("invalid args, a json object is required: %w", err)
+		}
+	}
+	if sub, _ := cmd.Flags().GetString("sub"); sub != "" {
+		req.Identity = &mcp.Identity{Subject: sub}
+		req.Identity.Groups, _ = cmd.Flags().GetStringSlice("group")
+		req.Identity.Scopes, _ = cmd.Flags().GetStringSlice("scope")
+	}
+	if raw, _ := cmd.Flags().GetString("time"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return fmt.Errorf("invalid time: %w", err)
+		}
+		req.Time = t
+	}
+	result, err := cli.EvalPolicy(req)
+	if err != nil {
+		return err
+	}
+	if result.Policy == "" {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s, no policy matched\n", result.Decision)
+		return nil
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s by policy %s", result.Decision, result.Policy)
+	if result.Reason != "" {
+		fmt.Fprintf(cmd.OutOrStdout(), ": %s", result.Reason)
+	}
+	fmt.Fprintln(cmd.OutOrStdout())
+	return nil
+}
+
+func tokenListHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	tokens, err := cli.ListTokens()
 	if err != nil {
 		return err
 	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Name", "Roles", "Status", "Created_At", "Expires_At", "Last_Used_At"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, token := range tokens {
+		table.Append([]string{token.ID, token.Name, token.Principal().Roles.String(), token.Status(), token.CreatedAt.Format(time.DateTime), formatTime(token.ExpiresAt, "never"), formatTime(token.LastUsedAt, "")})
+	}
+	table.Render()
 	return nil
 }
 
-// createHandler creates a new MCP server
-func createHandler(cmd *cobra.Command, args []string) error {
+func tokenCreateHandler(cmd *cobra.Command, args []string) error {
 	cli := NewOmcpServerCli(config.Host())
 	name, _ := cmd.Flags().GetString("name")
 	if name == "" {
 		return fmt.Errorf("name is required")
 	}
-	desc, _ := cmd.Flags().GetString("desc")
-	version, _ := cmd.Flags().GetString("version")
-	err := cli.CreateMcpServer(name, desc, version)
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+	var lifetime string
+	if ttl > 0 {
+		lifetime = ttl.String()
+	}
+	roleNames, _ := cmd.Flags().GetStringSlice("role")
+	servers, _ := cmd.Flags().GetStringSlice("server")
+	selector, _ := cmd.Flags().GetString("selector")
+	roles := make(auth.RoleBindings, 0, len(roleNames))
+	for _, role := range roleNames {
+		roles = append(roles, auth.RoleBinding{Role: auth.Role(role), Servers: servers, Selector: selector})
+	}
+	secret, _, err := cli.CreateToken(name, roles, lifetime)
 	if err != nil {
-		cmd.PrintErrln(err)
 		return err
 	}
+	// the secret goes to stdout, so it can be captured by scripts
+	fmt.Fprintln(cmd.OutOrStdout(), secret)
 	return nil
 }
 
-func deleteHandler(cmd *cobra.Command, args []string) error {
+func tokenRevokeHandler(cmd *cobra.Command, args []string) error {
 	cli := NewOmcpServerCli(config.Host())
 	name, _ := cmd.Flags().GetString("name")
 	if name == "" {
 		return fmt.Errorf("name is required")
 	}
-	err := cli.DeleteMcpServer(name)
-	if err != nil {
-		cmd.PrintErrln(err)
+	if err := cli.RevokeToken(name); err != nil {
 		return err
 	}
 	return nil
 }
 
-func listHandler(cmd *cobra.Command, args []string) error {
+func secretListHandler(cmd *cobra.Command, args []string) error {
 	cli := NewOmcpServerCli(config.Host())
-	servers, err := cli.ListMcpServers()
+	secrets, err := cli.ListSecrets()
 	if err != nil {
 		return err
 	}
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "Description", "Version", "Status", "Created_At", "Updated_At"})
+	table.SetHeader([]string{"Name", "Desc", "Created_At", "Updated_At"})
 	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	table.SetHeaderLine(false)
 	table.SetBorder(false)
-	for _, server := range servers {
-		table.Append([]string{server.Name, server.Desc, server.Version, string(server.State), server.CreatedAt.Format(time.DateTime), server.UpdatedAt.Format(time.DateTime)})
+	table.SetAutoWrapText(false)
+	for _, s := range secrets {
+		table.Append([]string{s.Name, s.Desc, s.CreatedAt.Format(time.DateTime), s.UpdatedAt.Format(time.DateTime)})
 	}
 	table.Render()
 	return nil
 }
 
-func startHandler(cmd *cobra.Command, args []string) error {
+func secretSetHandler(cmd *cobra.Command, args []string) error {
 	cli := NewOmcpServerCli(config.Host())
 	name, _ := cmd.Flags().GetString("name")
 	if name == "" {
 		return fmt.Errorf("name is required")
 	}
-	err := cli.StartMcpServer(name)
-	if err != nil {
-		cmd.PrintErrln(err)
+	desc, _ := cmd.Flags().GetString("desc")
+	value, _ := cmd.Flags().GetString("value")
+	if path, _ := cmd.Flags().GetString("from-file"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		value = string(data)
+	} else if value == "" {
+		data, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		// a value piped by echo ends with a newline
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+	if value == "" {
+		return fmt.Errorf("value is required")
+	}
+	if err := cli.SetSecret(web.SetSecretReq{Name: name, Desc: desc, Value: value}); err != nil {
 		return err
 	}
 	return nil
 }
 
-func stopHandler(cmd *cobra.Command, args []string) error {
+func secretDeleteHandler(cmd *cobra.Command, args []string) error {
 	cli := NewOmcpServerCli(config.Host())
 	name, _ := cmd.Flags().GetString("name")
 	if name == "" {
 		return fmt.Errorf("name is required")
 	}
-	err := cli.StopMcpServer(name)
+	if err := cli.DeleteSecret(name); err != nil {
+		return err
+	}
+	return nil
+}
+
+func secretKeygenHandler(cmd *cobra.Command, args []string) error {
+	out, _ := cmd.Flags().GetString("out")
+	if err := secret.GenerateMasterKey(out); err != nil {
+		return err
+	}
+	cmd.Printf("wrote the master key to %s, keep it safe, the secrets can't be decrypted without it\n", out)
+	return nil
+}
+
+func approvalListHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	req := web.ListApprovalReq{}
+	status, _ := cmd.Flags().GetString("status")
+	req.Status = mcp.ApprovalStatus(status)
+	req.Server, _ = cmd.Flags().GetString("server")
+	approvals, err := cli.ListApprovals(req)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Server", "Tool", "Caller", "Status", "Approver", "Created_At", "Expires_At"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, approval := range approvals {
+		caller := ""
+		if approval.Identity != nil {
+			caller = approval.Identity.Subject
+		}
+		table.Append([]string{approval.ID, approval.Server, approval.Tool, caller, string(approval.Status), approval.Approver,
+			approval.CreatedAt.Format(time.DateTime), approval.ExpiresAt.Format(time.DateTime)})
+	}
+	table.Render()
+	return nil
+}
+
+func approvalShowHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	approval, err := cli.GetApproval(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(approval, "", "  ")
 	if err != nil {
-		cmd.PrintErrln(err)
 		return err
 	}
+	fmt.Fprintln(cmd.OutOrStdout(), string(data))
 	return nil
 }
 
-func loadHandler(cmd *cobra.Command, args []string) error {
+// approvalDecideHandler approves or rejects the approval of the argument
+func approvalDecideHandler(decision string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cli := NewOmcpServerCli(config.Host())
+		comment, _ := cmd.Flags().GetString("comment")
+		approval, err := cli.DecideApproval(args[0], web.DecideApprovalReq{Decision: decision, Comment: comment})
+		if err != nil {
+			return err
+		}
+		cmd.Printf("%s the call of tool %s of server %s\n", approval.Status, approval.Tool, approval.Server)
+		return nil
+	}
+}
+
+// callFilter is the filter of the call flags
+func callFilter(cmd *cobra.Command) web.ListCallReq {
+	var req web.ListCallReq
+	req.Server, _ = cmd.Flags().GetString("server")
+	req.Tool, _ = cmd.Flags().GetString("tool")
+	req.Session, _ = cmd.Flags().GetString("session")
+	req.Status, _ = cmd.Flags().GetString("status")
+	return req
+}
+
+func callsListHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	req := callFilter(cmd)
+	req.Limit, _ = cmd.Flags().GetInt("limit")
+	if since, _ := cmd.Flags().GetDuration("since"); since > 0 {
+		req.Since = time.Now().Add(-since)
+	}
+	calls, err := cli.ListCalls(req)
+	if err != nil {
+		return err
+	}
+	renderCalls(calls, true)
+	return nil
+}
+
+// renderCalls prints the calls as a table, the header is left out for the calls following a tail
+func renderCalls(calls []mcp.CallRecord, header bool) {
+	table := tablewriter.NewWriter(os.Stdout)
+	if header {
+		table.SetHeader([]string{"ID", "Time", "Server", "Tool", "Client", "Caller", "Status", "Duration", "Result"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetHeaderLine(false)
+	}
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, call := range calls {
+		result := call.Result
+		if call.Error != "" {
+			result = call.Error
+		}
+		table.Append([]string{
+			call.ID,
+			call.Start.Local().Format(time.DateTime),
+			call.Server,
+			call.Tool,
+			callClient(call),
+			call.Subject,
+			call.Status,
+			callDuration(call).String(),
+			oneLine(result, 60),
+		})
+	}
+	table.Render()
+}
+
+func callsShowHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	call, err := cli.GetCall(args[0])
+	if err != nil {
+		return err
+	}
+	arguments, err := json.MarshalIndent(call.Arguments, "", "  ")
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.AppendBulk([][]string{
+		{"ID", call.ID},
+		{"Time", call.Start.Local().Format(time.DateTime)},
+		{"Server", call.Server},
+		{"Tool", call.Tool},
+		{"Session", call.Session},
+		{"Client", callClient(*call)},
+		{"Caller", call.Subject},
+		{"Status", call.Status},
+		{"Duration", callDuration(*call).String()},
+		{"Arguments", string(arguments)},
+		{"Result", call.Result},
+		{"Error", call.Error},
+	})
+	table.Render()
 	return nil
 }
+
+// callsTailHandler prints the latest calls and then polls the calls after the last one until it's interrupted
+func callsTailHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	req := callFilter(cmd)
+	req.Limit, _ = cmd.Flags().GetInt("lines")
+	header := true
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		calls, err := cli.ListCalls(req)
+		if err != nil {
+			return err
+		}
+		if len(calls) > 0 {
+			renderCalls(calls, header)
+			header = false
+			req.After = calls[len(calls)-1].Seq
+		}
+		// every call after the printed ones is followed
+		req.Limit = 0
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func callClient(call mcp.CallRecord) string {
+	if call.ClientVersion == "" {
+		return call.ClientName
+	}
+	return call.ClientName + "/" + call.ClientVersion
+}
+
+func callDuration(call mcp.CallRecord) time.Duration {
+	return time.Duration(call.DurationMs * float64(time.Millisecond)).Round(time.Microsecond)
+}
+
+// oneLine fits a text in a cell of n runes
+func oneLine(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-3]) + "..."
+	}
+	return text
+}
+
+func oauthKeygenHandler(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	if dir == "" {
+		return fmt.Errorf("dir is required")
+	}
+	if err := auth.GenerateIssuerKey(dir); err != nil {
+		return err
+	}
+	cmd.Printf("the signing key is %s, the jwks is %s\n", filepath.Join(dir, auth.IssuerKeyFile), filepath.Join(dir, auth.IssuerJWKSFile))
+	return nil
+}
+
+func oauthTokenHandler(cmd *cobra.Command, args []string) error {
+	key, _ := cmd.Flags().GetString("key")
+	issuer, _ := cmd.Flags().GetString("issuer")
+	if issuer == "" {
+		return fmt.Errorf("issuer is required")
+	}
+	sub, _ := cmd.Flags().GetString("sub")
+	if sub == "" {
+		return fmt.Errorf("sub is required")
+	}
+	aud, _ := cmd.Flags().GetStringSlice("aud")
+	if len(aud) == 0 {
+		return fmt.Errorf("aud is required")
+	}
+	scopes, _ := cmd.Flags().GetStringSlice("scope")
+	groups, _ := cmd.Flags().GetStringSlice("group")
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+	token, err := auth.SignToken(key, auth.TokenClaims{
+		Issuer:   issuer,
+		Subject:  sub,
+		Audience: aud,
+		Scopes:   scopes,
+		Groups:   groups,
+		TTL:      ttl,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), token)
+	return nil
+}
+
+func keyListHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	keys, err := cli.ListClientKeys(server)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Server", "Name", "Status", "Tools", "Resources", "Created_At", "Expires_At", "Last_Used_At"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, key := range keys {
+		table.Append([]string{key.ID, key.Server, key.Name, key.Status(), scopeString(key.Scope.Tools), scopeString(key.Scope.Resources),
+			key.CreatedAt.Format(time.DateTime), formatTime(key.ExpiresAt, "never"), formatTime(key.LastUsedAt, "")})
+	}
+	table.Render()
+	return nil
+}
+
+func keyCreateHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	req := web.CreateClientKeyReq{}
+	req.Server, _ = cmd.Flags().GetString("server")
+	if req.Server == "" {
+		return fmt.Errorf("server is required")
+	}
+	req.Name, _ = cmd.Flags().GetString("name")
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	req.Scope.Tools, _ = cmd.Flags().GetStringArray("tool")
+	req.Scope.Resources, _ = cmd.Flags().GetStringArray("resource")
+	if ttl, _ := cmd.Flags().GetDuration("ttl"); ttl > 0 {
+		req.TTL = ttl.String()
+	}
+	secret, err := cli.CreateClientKey(req)
+	if err != nil {
+		return err
+	}
+	// the secret goes to stdout, so it can be captured by scripts
+	fmt.Fprintln(cmd.OutOrStdout(), secret)
+	return nil
+}
+
+func keyRevokeHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		return fmt.Errorf("server is required")
+	}
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := cli.RevokeClientKey(server, name); err != nil {
+		return err
+	}
+	return nil
+}
+
+// scopeString shows the patterns of a scope, an empty scope allows everything
+func scopeString(patterns []string) string {
+	if len(patterns) == 0 {
+		return "*"
+	}
+	return strings.Join(patterns, ",")
+}
+
+// formatTime formats the time for the tables, the zero time is shown as zero
+func formatTime(t time.Time, zero string) string {
+	if t.IsZero() {
+		return zero
+	}
+	return t.Format(time.DateTime)
+}
+
 func versionHandler(cmd *cobra.Command, args []string) {
 	cmd.Println("omcp version 0.0.1")
 }
 
 // probeServerReady probes the omcp server to see if it is ready
 func probeServerReady(cmd *cobra.Command, args []string) error {
-	resp, err := http.Get(fmt.Sprintf("%s/ready", config.Host()))
+	client, err := httpClient()
 	if err != nil {
-		cmd.PrintErrln("OMCP server is not ready, please start the server first")
 		return err
 	}
+	resp, err := client.Get(fmt.Sprintf("%s/ready", config.Host()))
+	if err != nil {
+		return fmt.Errorf("OMCP server is not ready, please start the server first: %w", err)
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK {
 		return nil
 	}
-	cmd.PrintErrln("OMCP server is not ready, please start the server first")
-	return fmt.Errorf("server is not ready")
+	return fmt.Errorf("OMCP server is not ready, please start the server first, status code: %d", resp.StatusCode)
+}
+
+func auditHandler(cmd *cobra.Command, args []string) error {
+	cli := NewOmcpServerCli(config.Host())
+	var req web.ListAuditReq
+	req.Actor, _ = cmd.Flags().GetString("actor")
+	req.Action, _ = cmd.Flags().GetString("action")
+	req.Server, _ = cmd.Flags().GetString("server")
+	req.Tool, _ = cmd.Flags().GetString("tool")
+	req.Status, _ = cmd.Flags().GetString("status")
+	req.Limit, _ = cmd.Flags().GetInt("limit")
+	if since, _ := cmd.Flags().GetDuration("since"); since > 0 {
+		req.Since = time.Now().Add(-since)
+	}
+	entries, err := cli.ListAudit(req)
+	if err != nil {
+		return err
+	}
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Time", "Actor", "Action", "Server", "Target", "Status", "Latency", "Error"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, entry := range entries {
+		target := entry.Tool
+		if target == "" {
+			target = entry.Target
+		}
+		latency := time.Duration(entry.LatencyMs * float64(time.Millisecond)).Round(time.Microsecond)
+		table.Append([]string{
+			entry.Time.Local().Format(time.DateTime),
+			entry.Actor,
+			entry.Action,
+			entry.Server,
+			target,
+			entry.Status,
+			latency.String(),
+			entry.Error,
+		})
+	}
+	table.Render()
+	return nil
+}
+
+func pluginKeygenHandler(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	keyID, err := artifact.GenerateSigningKey(dir)
+	if err != nil {
+		return err
+	}
+	cmd.Printf("wrote the signing key %s and the public key %s, key id %s\n",
+		filepath.Join(dir, artifact.SigningKeyFile), filepath.Join(dir, artifact.PublicKeyFile), keyID)
+	cmd.Println("copy the public key into the plugin trust dir of the OMCP server")
+	return nil
+}
+
+func pluginSignHandler(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+	if file == "" {
+		return fmt.Errorf("file is required")
+	}
+	key, _ := cmd.Flags().GetString("key")
+	out, _ := cmd.Flags().GetString("out")
+	if out == "" {
+		out = file + ".sig"
+	}
+	sig, err := artifact.Sign(key, file)
+	if err != nil {
+		return err
+	}
+	data, err := sig.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		return err
+	}
+	cmd.Printf("signed %s with key %s into %s\n", sig.Digest, sig.KeyID, out)
+	return nil
+}
+
+func pluginVerifyHandler(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+	if file == "" {
+		return fmt.Errorf("file is required")
+	}
+	trustDir, _ := cmd.Flags().GetString("trust-dir")
+	if trustDir == "" {
+		return fmt.Errorf("trust-dir is required")
+	}
+	sigPath, _ := cmd.Flags().GetString("signature")
+	if sigPath == "" {
+		sigPath = file + ".sig"
+	}
+	data, err := os.ReadFile(sigPath)
+	if err != nil {
+		return err
+	}
+	sig, err := artifact.ParseSignature(data)
+	if err != nil {
+		return err
+	}
+	digest, err := artifact.FileDigest(file)
+	if err != nil {
+		return err
+	}
+	keyID, err := artifact.NewTrustStore(trustDir).Verify(digest, sig)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "verified %s, signed by key %s\n", digest, keyID)
+	return nil
 }
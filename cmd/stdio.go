@@ -0,0 +1,483 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jyz0309/omcp/mcp"
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	bridgeMaxRetries   = 5
+	bridgeRetryBackoff = 500 * time.Millisecond
+	bridgeMaxBackoff   = 10 * time.Second
+)
+
+// errSessionExpired is returned when the server no longer knows the session,
+// e.g. it restarted or the server was stopped
+var errSessionExpired = errors.New("session expired")
+
+// errUnauthorized is returned when the client key is missing or rejected, it's not retried
+var errUnauthorized = errors.New("unauthorized")
+
+// unsafeMethods may change the state behind the server, e.g. a tool deleting a repository, they are
+// only retried if they never reached the server since a lost response doesn't tell they didn't run
+var unsafeMethods = map[string]bool{
+	string(mcpgo.MethodToolsCall): true,
+}
+
+// notDelivered reports whether the request provably never reached the server, it failed to connect
+func notDelivered(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// stdioBridge relays the messages between a stdio client and the streamable http endpoint
+// of a managed server. The server notifications are read from the listen stream, the broken
+// streams are resumed with Last-Event-ID and an expired session is initialized again
+type stdioBridge struct {
+	url string
+	// key is the client key of the server, if it requires one
+	key    string
+	client *http.Client
+	logger *log.Logger
+
+	// outMu serializes the messages written to the client
+	outMu sync.Mutex
+	out   io.Writer
+
+	// reinitMu serializes the replays of the initialize request
+	reinitMu sync.Mutex
+	// mu guards the session, the initialize request is replayed to establish a new session
+	mu          sync.Mutex
+	sessionID   string
+	initialize  []byte
+	initialized []byte
+	listening   bool
+}
+
+func newStdioBridge(url, key string, client *http.Client, out io.Writer, logger *log.Logger) *stdioBridge {
+	return &stdioBridge{
+		url:    url,
+		key:    key,
+		client: client,
+		logger: logger,
+		out:    out,
+	}
+}
+
+// Run relays the messages read from in until it's closed or the context is done,
+// the session is terminated on return
+func (b *stdioBridge) Run(ctx context.Context, in io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the input is read aside, a blocked read must not delay the shutdown
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	var err error
+loop:
+	for {
+		select {
+		case line := <-lines:
+			// the messages following the initialize request need its session
+			if isInitialize(line) {
+				b.relay(ctx, line)
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.relay(ctx, line)
+			}()
+		case err = <-readErr:
+			if err == io.EOF {
+				err = nil
+			}
+			break loop
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	wg.Wait()
+	// the listen stream ends with the session, it's not reconnected
+	cancel()
+	b.terminate()
+	return err
+}
+
+func isInitialize(message []byte) bool {
+	var header struct {
+		Method string `json:"method"`
+	}
+	return json.Unmarshal(message, &header) == nil && header.Method == string(mcpgo.MethodInitialize)
+}
+
+// relay sends a message of the client, the connection errors are retried with a backoff, the unsafe
+// methods only if they were not delivered, a request that can't be relayed is answered with an error
+func (b *stdioBridge) relay(ctx context.Context, message []byte) {
+	var header struct {
+		ID     any    `json:"id"`
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(message, &header); err != nil {
+		b.logger.Printf("invalid message from the client: %v", err)
+		return
+	}
+	switch header.Method {
+	case string(mcpgo.MethodInitialize):
+		b.mu.Lock()
+		b.initialize = message
+		b.sessionID = ""
+		b.mu.Unlock()
+	case "notifications/initialized":
+		b.mu.Lock()
+		b.initialized = message
+		b.mu.Unlock()
+	}
+
+	backoff := bridgeRetryBackoff
+	for attempt := 0; ; attempt++ {
+		sessionID, err := b.session(), error(nil)
+		if header.Method != string(mcpgo.MethodInitialize) {
+			sessionID, err = b.ensureSession(ctx)
+		}
+		sent := false
+		if err == nil {
+			sent = true
+			err = b.post(ctx, message, true)
+		}
+		if err == nil {
+			break
+		}
+		// the server refuses the messages of an expired session without handling them
+		expired := errors.Is(err, errSessionExpired)
+		if expired {
+			if err = b.reinitialize(ctx, sessionID); err == nil {
+				continue
+			}
+		}
+		retry := !unsafeMethods[header.Method] || !sent || expired || notDelivered(err)
+		if ctx.Err() != nil || attempt >= bridgeMaxRetries || errors.Is(err, errUnauthorized) || !retry {
+			b.logger.Printf("failed to relay %s: %v", header.Method, err)
+			if header.ID != nil && header.Method != "" {
+				b.write(errorMessage(header.ID, err))
+			}
+			return
+		}
+		b.logger.Printf("failed to relay %s, retrying in %s: %v", header.Method, backoff, err)
+		if !sleep(ctx, backoff) {
+			return
+		}
+		backoff = min(backoff*2, bridgeMaxBackoff)
+	}
+
+	if header.Method == string(mcpgo.MethodInitialize) {
+		b.startListening(ctx)
+	}
+}
+
+// do sends the request with the client key
+func (b *stdioBridge) do(req *http.Request) (*http.Response, error) {
+	if b.key != "" {
+		req.Header.Set("Authorization", "Bearer "+b.key)
+	}
+	return b.client.Do(req)
+}
+
+// post sends a message and relays the reply, forward is false for the messages
+// replayed by the bridge itself
+func (b *stdioBridge) post(ctx context.Context, message []byte, forward bool) error {
+	sessionID := b.session()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if sessionID != "" {
+		req.Header.Set(mcp.HeaderSessionID, sessionID)
+	}
+	resp, err := b.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && sessionID != "":
+		return errSessionExpired
+	case resp.StatusCode == http.StatusAccepted:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s", errUnauthorized, strings.TrimSpace(string(body)))
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status code: %d, %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if id := resp.Header.Get(mcp.HeaderSessionID); id != "" {
+		b.mu.Lock()
+		b.sessionID = id
+		b.mu.Unlock()
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if forward {
+			b.write(body)
+		}
+		return nil
+	}
+
+	// the reply is a stream of the notifications followed by the response,
+	// a broken stream is resumed from its last event
+	lastEventID := ""
+	for {
+		lastEventID, err = b.readStream(resp.Body, lastEventID, forward)
+		if err == nil || lastEventID == "" || ctx.Err() != nil {
+			return err
+		}
+		b.logger.Printf("reply stream broken, resuming from %s: %v", lastEventID, err)
+		resp.Body.Close()
+		resp, err = b.get(ctx, sessionID, lastEventID)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (b *stdioBridge) session() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sessionID
+}
+
+// ensureSession returns the current session, a session lost to a failed replay is initialized again
+func (b *stdioBridge) ensureSession(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	sessionID, initialize := b.sessionID, b.initialize
+	b.mu.Unlock()
+	if sessionID != "" || initialize == nil {
+		return sessionID, nil
+	}
+	if err := b.reinitialize(ctx, ""); err != nil {
+		return "", err
+	}
+	return b.session(), nil
+}
+
+// reinitialize replays the initialize request of the client to replace the expired session,
+// the replies are not forwarded since the client has seen them already
+func (b *stdioBridge) reinitialize(ctx context.Context, expired string) error {
+	b.reinitMu.Lock()
+	defer b.reinitMu.Unlock()
+	b.mu.Lock()
+	if b.sessionID != expired {
+		// replaced meanwhile by another request
+		b.mu.Unlock()
+		return nil
+	}
+	b.logger.Printf("session %s expired, initializing a new one", expired)
+	initialize, initialized := b.initialize, b.initialized
+	b.sessionID = ""
+	b.mu.Unlock()
+	if initialize == nil {
+		return errors.New("the client has not initialized")
+	}
+	if err := b.post(ctx, initialize, false); err != nil {
+		return err
+	}
+	if initialized != nil {
+		if err := b.post(ctx, initialized, false); err != nil {
+			return err
+		}
+	}
+	b.startListening(ctx)
+	return nil
+}
+
+// startListening opens the listen stream once per bridge, it follows the current session
+func (b *stdioBridge) startListening(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.listening {
+		return
+	}
+	b.listening = true
+	go b.listen(ctx)
+}
+
+// listen relays the server notifications, the stream is reconnected until the context is done
+func (b *stdioBridge) listen(ctx context.Context) {
+	backoff := bridgeRetryBackoff
+	lastEventID, streamSession := "", ""
+	for ctx.Err() == nil {
+		sessionID, err := b.ensureSession(ctx)
+		if sessionID != streamSession {
+			// the events of an expired session can't be resumed
+			lastEventID, streamSession = "", sessionID
+		}
+
+		var resp *http.Response
+		if err == nil {
+			resp, err = b.get(ctx, sessionID, lastEventID)
+		}
+		if err == nil {
+			backoff = bridgeRetryBackoff
+			lastEventID, err = b.readStream(resp.Body, lastEventID, true)
+			resp.Body.Close()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errSessionExpired) {
+			if err = b.reinitialize(ctx, sessionID); err == nil {
+				continue
+			}
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		b.logger.Printf("listen stream closed, reconnecting in %s: %v", backoff, err)
+		if !sleep(ctx, backoff) {
+			return
+		}
+		backoff = min(backoff*2, bridgeMaxBackoff)
+	}
+}
+
+// get opens the listen stream, or resumes the stream of the last event
+func (b *stdioBridge) get(ctx context.Context, sessionID, lastEventID string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(mcp.HeaderSessionID, sessionID)
+	if lastEventID != "" {
+		req.Header.Set(mcp.HeaderLastEventID, lastEventID)
+	}
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errSessionExpired
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return nil, fmt.Errorf("status code: %d, %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// readStream relays the events of a sse stream until it ends, it returns the id of the last event
+func (b *stdioBridge) readStream(body io.Reader, lastEventID string, forward bool) (string, error) {
+	reader := bufio.NewReader(body)
+	var id string
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return lastEventID, nil
+			}
+			return lastEventID, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if forward {
+					b.write([]byte(strings.Join(data, "\n")))
+				}
+				if id != "" {
+					lastEventID = id
+				}
+			}
+			id, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// comment, e.g. the heartbeat
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+// terminate deletes the session on the server
+func (b *stdioBridge) terminate() {
+	sessionID := b.session()
+	if sessionID == "" {
+		return
+	}
+	req, err := http.NewRequest(http.MethodDelete, b.url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set(mcp.HeaderSessionID, sessionID)
+	if resp, err := b.do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// write writes a message to the client, one message per line
+func (b *stdioBridge) write(message []byte) {
+	b.outMu.Lock()
+	defer b.outMu.Unlock()
+	b.out.Write(append(bytes.TrimSpace(message), '\n'))
+}
+
+func errorMessage(id any, err error) []byte {
+	message, _ := json.Marshal(mcpgo.NewJSONRPCError(mcpgo.NewRequestId(id), mcpgo.INTERNAL_ERROR, err.Error(), nil))
+	return message
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
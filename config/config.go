@@ -1,5 +1,7 @@
 package config
 
+import "os"
+
 type EnvVar struct {
 	Name        string
 	Value       any
@@ -13,9 +15,151 @@ func AsMap() map[string]EnvVar {
 			Value:       "http://localhost:8080",
 			Description: "The HOST of the OMCP server",
 		},
+		"OMCP_DATA_DIR": {
+			Name:        "OMCP_DATA_DIR",
+			Value:       DataDir(),
+			Description: "The directory where the OMCP server persists its state",
+		},
+		"OMCP_STORE": {
+			Name:        "OMCP_STORE",
+			Value:       StoreDriver(),
+			Description: "The store driver of the OMCP server, file or sqlite",
+		},
+		"OMCP_TOKEN": {
+			Name:        "OMCP_TOKEN",
+			Value:       "",
+			Description: "The admin api token sent by the CLI",
+		},
+		"OMCP_CLIENT_KEY": {
+			Name:        "OMCP_CLIENT_KEY",
+			Value:       "",
+			Description: "The client key sent by omcp stdio to the MCP server",
+		},
+		"OMCP_OAUTH_CONFIG": {
+			Name:        "OMCP_OAUTH_CONFIG",
+			Value:       OAuthConfig(),
+			Description: "The oauth config file to validate the bearer tokens of the MCP endpoints",
+		},
+		"OMCP_TLS_CA": {
+			Name:        "OMCP_TLS_CA",
+			Value:       TLSCA(),
+			Description: "The CA bundle the CLI verifies the OMCP server against instead of the system roots",
+		},
+		"OMCP_TLS_CERT": {
+			Name:        "OMCP_TLS_CERT",
+			Value:       TLSCert(),
+			Description: "The client certificate the CLI presents to an OMCP server requiring mTLS",
+		},
+		"OMCP_TLS_KEY": {
+			Name:        "OMCP_TLS_KEY",
+			Value:       TLSKey(),
+			Description: "The key of the client certificate",
+		},
+		"OMCP_AUDIT_LOG": {
+			Name:        "OMCP_AUDIT_LOG",
+			Value:       AuditLog(),
+			Description: "The audit log file of the OMCP server, audit.log in the data directory if empty",
+		},
+		"OMCP_MASTER_KEY": {
+			Name:        "OMCP_MASTER_KEY",
+			Value:       MasterKey(),
+			Description: "The base64 or hex encoded 32 byte key the OMCP server encrypts the secrets with",
+		},
+		"OMCP_MASTER_KEY_FILE": {
+			Name:        "OMCP_MASTER_KEY_FILE",
+			Value:       MasterKeyFile(),
+			Description: "The file of the master key, it takes precedence over OMCP_MASTER_KEY",
+		},
+		"OMCP_LOG_LEVEL": {
+			Name:        "OMCP_LOG_LEVEL",
+			Value:       LogLevel(),
+			Description: "The level of the OMCP server logs, debug, info, warn or error",
+		},
+		"OMCP_LOG_FORMAT": {
+			Name:        "OMCP_LOG_FORMAT",
+			Value:       LogFormat(),
+			Description: "The format of the OMCP server logs, text or json",
+		},
+		"OMCP_LOG_FILE": {
+			Name:        "OMCP_LOG_FILE",
+			Value:       LogFile(),
+			Description: "The rotated file the OMCP server logs to instead of stdout",
+		},
+		"OMCP_TRACE_EXPORTER": {
+			Name:        "OMCP_TRACE_EXPORTER",
+			Value:       TraceExporter(),
+			Description: "The exporter of the OMCP server spans, none, otlp, stdout or file",
+		},
 	}
 }
 
 func Host() string {
-	return "http://localhost:8080"
+	return getEnv("OMCP_HOST", "http://localhost:8080")
+}
+
+func DataDir() string {
+	return getEnv("OMCP_DATA_DIR", "./data")
+}
+
+func StoreDriver() string {
+	return getEnv("OMCP_STORE", "file")
+}
+
+func getEnv(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func Token() string {
+	return os.Getenv("OMCP_TOKEN")
+}
+
+func ClientKey() string {
+	return os.Getenv("OMCP_CLIENT_KEY")
+}
+
+func OAuthConfig() string {
+	return os.Getenv("OMCP_OAUTH_CONFIG")
+}
+
+func AuditLog() string {
+	return os.Getenv("OMCP_AUDIT_LOG")
+}
+
+func MasterKey() string {
+	return os.Getenv("OMCP_MASTER_KEY")
+}
+
+func MasterKeyFile() string {
+	return os.Getenv("OMCP_MASTER_KEY_FILE")
+}
+
+func TLSCA() string {
+	return os.Getenv("OMCP_TLS_CA")
+}
+
+func TLSCert() string {
+	return os.Getenv("OMCP_TLS_CERT")
+}
+
+func TLSKey() string {
+	return os.Getenv("OMCP_TLS_KEY")
+}
+
+func TraceExporter() string {
+	return getEnv("OMCP_TRACE_EXPORTER", "none")
+}
+
+func LogLevel() string {
+	return getEnv("OMCP_LOG_LEVEL", "info")
+}
+
+func LogFormat() string {
+	return getEnv("OMCP_LOG_FORMAT", "text")
+}
+
+func LogFile() string {
+	return os.Getenv("OMCP_LOG_FILE")
 }
@@ -0,0 +1,51 @@
+// Package main is an example tool plugin, build it with
+//
+//	go build -buildmode=plugin -o hello.so ./example/plugin
+//
+// and load it with
+//
+//	omcp load --server hello --file hello.so --var Plugin
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	omcp "github.com/jyz0309/omcp/mcp"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+type helloPlugin struct{}
+
+// Plugin is the exported symbol looked up by omcp
+var Plugin helloPlugin
+
+func (helloPlugin) Tools() []omcp.MCPTool {
+	return []omcp.MCPTool{
+		{
+			Name: "hello_plugin",
+			Desc: "Say hello to someone from a plugin",
+			Option: []mcp.ToolOption{
+				mcp.WithString("name",
+					mcp.Required(),
+					mcp.Description("Name of the person to greet"),
+				),
+			},
+			Handler: helloHandler,
+		},
+	}
+}
+
+func helloHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, ok := request.GetArguments()["name"].(string)
+	if !ok {
+		return nil, errors.New("name must be a string")
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Hello from plugin, %s!", name)), nil
+}
+
+// main is never called, it only makes the package buildable with go build ./...
+func main() {}
@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jyz0309/omcp/rotate"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+
+	DefaultMaxSize    = 100 << 20
+	DefaultMaxBackups = 10
+
+	// RequestIDHeader carries the id of a request, the one of the client is kept if it's valid
+	RequestIDHeader = "X-Request-ID"
+
+	// the fields correlating the log lines
+	FieldRequestID = "request_id"
+	FieldServer    = "server"
+	FieldTool      = "tool"
+	FieldSession   = "session"
+)
+
+// Config is the level, the format and the output of the logs
+type Config struct {
+	Level  string
+	Format string
+	// File is the file the logs are written to instead of stdout, it's rotated once it exceeds the max size
+	File       string
+	MaxSize    int64
+	MaxBackups int
+}
+
+// Setup configures the standard logrus logger every package logs with, the returned closer closes the log file
+func Setup(config Config) (io.Closer, error) {
+	logger := logrus.StandardLogger()
+	level := logrus.InfoLevel
+	if config.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(config.Level); err != nil {
+			return nil, err
+		}
+	}
+	var formatter logrus.Formatter
+	switch config.Format {
+	case "", FormatText:
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return nil, fmt.Errorf("unknown log format %s, text or json", config.Format)
+	}
+
+	var out io.Writer = os.Stdout
+	var closer io.Closer = io.NopCloser(nil)
+	if config.File != "" {
+		maxSize, maxBackups := config.MaxSize, config.MaxBackups
+		if maxSize <= 0 {
+			maxSize = DefaultMaxSize
+		}
+		if maxBackups <= 0 {
+			maxBackups = DefaultMaxBackups
+		}
+		file, err := rotate.Open(config.File, maxSize, maxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out, closer = file, file
+	}
+	logger.SetLevel(level)
+	logger.SetFormatter(formatter)
+	logger.SetOutput(out)
+	return closer, nil
+}
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// WithRequestID puts the id of the request into ctx, the loggers of ctx get it as a field
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithLogger puts the logger into ctx, e.g. the logger of a tool call handed to its handler
+func WithLogger(ctx context.Context, logger *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext is the logger of ctx, or the standard logger with the id of the request of ctx
+func FromContext(ctx context.Context) *logrus.Entry {
+	if logger, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return logger
+	}
+	logger := logrus.NewEntry(logrus.StandardLogger())
+	if id := RequestIDFromContext(ctx); id != "" {
+		logger = logger.WithField(FieldRequestID, id)
+	}
+	return logger
+}
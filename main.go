@@ -84,9 +84,16 @@ import (
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/jyz0309/omcp/cmd"
 )
 
 func main() {
-	cmd.NewCli().Execute()
+	// the commands don't print their errors, so every error is printed once here
+	if err := cmd.NewCli().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,354 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jyz0309/omcp/logging"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ApprovalStatus string
+
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalRejected ApprovalStatus = "rejected"
+	ApprovalExpired  ApprovalStatus = "expired"
+	// ApprovalCanceled is an approval whose call went away before it was decided, e.g. the client canceled it
+	ApprovalCanceled ApprovalStatus = "canceled"
+
+	DefaultApprovalTimeout = 5 * time.Minute
+	// DefaultApprovalRetention is how long the decided approvals are kept
+	DefaultApprovalRetention = 7 * 24 * time.Hour
+
+	// approvalProgressInterval is how often the client of a pending call is told it's still waiting
+	approvalProgressInterval = 5 * time.Second
+)
+
+var (
+	ErrApprovalNotFound = errors.New("approval not found")
+	ErrApprovalDecided  = errors.New("approval is already decided")
+	ErrCallRejected     = errors.New("tool call rejected")
+	ErrApprovalExpired  = errors.New("tool call approval timed out")
+)
+
+// Approval is a tool call waiting for an operator, or the decision on it
+type Approval struct {
+	ID        string         `json:"id"`
+	Server    string         `json:"server"`
+	Tool      string         `json:"tool"`
+	Identity  *Identity      `json:"identity,omitempty"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+	// Policy is the policy which requires the approval, empty if the tool requires it
+	Policy string         `json:"policy,omitempty"`
+	Reason string         `json:"reason,omitempty"`
+	Status ApprovalStatus `json:"status"`
+	// Approver is the admin principal which decided the approval
+	Approver  string    `json:"approver,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	DecidedAt time.Time `json:"decided_at,omitempty"`
+
+	decided chan struct{}
+}
+
+// Err is the error the caller gets for the decision, nil if the call is approved
+func (a Approval) Err() error {
+	switch a.Status {
+	case ApprovalApproved:
+		return nil
+	case ApprovalRejected:
+		if a.Comment != "" {
+			return fmt.Errorf("%w by %s: %s (approval %s)", ErrCallRejected, a.Approver, a.Comment, a.ID)
+		}
+		return fmt.Errorf("%w by %s (approval %s)", ErrCallRejected, a.Approver, a.ID)
+	case ApprovalExpired:
+		return fmt.Errorf("%w after %s (approval %s)", ErrApprovalExpired, a.ExpiresAt.Sub(a.CreatedAt).Round(time.Second), a.ID)
+	default:
+		return fmt.Errorf("%w: approval %s is %s", ErrApprovalRequired, a.ID, a.Status)
+	}
+}
+
+// ApprovalPersister persists the approvals, it's called after every change, the dropped ones are deleted
+type ApprovalPersister interface {
+	SaveApproval(approval *Approval) error
+	DeleteApproval(id string) error
+}
+
+// Approvals keeps the pending approvals and the decided ones for their retention,
+// it's safe to be used from multiple goroutines
+type Approvals struct {
+	mu        sync.Mutex
+	approvals map[string]*Approval
+	timeout   time.Duration
+	retention time.Duration
+	persister ApprovalPersister
+	redact    func(args map[string]any) map[string]any
+}
+
+// NewApprovals creates the approvals expiring after the timeout and kept for the retention once decided,
+// the retention is unlimited if 0, the persister can be nil to keep them in memory only
+func NewApprovals(timeout, retention time.Duration, persister ApprovalPersister) *Approvals {
+	if timeout <= 0 {
+		timeout = DefaultApprovalTimeout
+	}
+	return &Approvals{
+		approvals: make(map[string]*Approval),
+		timeout:   timeout,
+		retention: retention,
+		persister: persister,
+	}
+}
+
+// SetRedactor redacts the arguments of the calls before the approvals are persisted and listed,
+// the call itself gets the arguments unchanged
+func (a *Approvals) SetRedactor(redact func(args map[string]any) map[string]any) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.redact = redact
+}
+
+// redactArguments returns the redacted copy of the arguments, the caller must hold a.mu
+func (a *Approvals) redactArguments(args map[string]any) map[string]any {
+	if a.redact == nil {
+		return args
+	}
+	return a.redact(args)
+}
+
+// Add adds the restored approvals, the pending ones are canceled since their calls are gone,
+// the ones beyond the retention are dropped and the arguments persisted before the redaction are redacted
+func (a *Approvals) Add(approvals ...*Approval) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var errs []error
+	for _, approval := range approvals {
+		if redacted := a.redactArguments(approval.Arguments); len(redacted) > 0 && !reflect.DeepEqual(redacted, approval.Arguments) {
+			approval.Arguments = redacted
+			errs = append(errs, a.persist(approval))
+		}
+		if approval.Status == ApprovalPending {
+			approval.Status = ApprovalCanceled
+			approval.Comment = "the server restarted before the approval was decided"
+			approval.DecidedAt = time.Now()
+			errs = append(errs, a.persist(approval))
+		}
+		a.approvals[approval.ID] = approval
+	}
+	errs = append(errs, a.prune(time.Now()))
+	return errors.Join(errs...)
+}
+
+func (a *Approvals) persist(approval *Approval) error {
+	if a.persister == nil {
+		return nil
+	}
+	return a.persister.SaveApproval(approval)
+}
+
+// prune drops the decided approvals beyond the retention, the caller must hold a.mu
+func (a *Approvals) prune(now time.Time) error {
+	if a.retention <= 0 {
+		return nil
+	}
+	var errs []error
+	for id, approval := range a.approvals {
+		if approval.Status == ApprovalPending || now.Sub(approval.DecidedAt) <= a.retention {
+			continue
+		}
+		if a.persister != nil {
+			if err := a.persister.DeleteApproval(id); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		delete(a.approvals, id)
+	}
+	return errors.Join(errs...)
+}
+
+// List returns the approvals of the status and the server, all of them if empty, the oldest first,
+// the expired approvals are dropped first
+func (a *Approvals) List(status ApprovalStatus, server string) []Approval {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.prune(time.Now()); err != nil {
+		logrus.WithError(err).Error("failed to delete expired approvals")
+	}
+	approvals := make([]Approval, 0, len(a.approvals))
+	for _, approval := range a.approvals {
+		if (status == "" || approval.Status == status) && (server == "" || approval.Server == server) {
+			approvals = append(approvals, *approval)
+		}
+	}
+	sort.Slice(approvals, func(i, j int) bool { return approvals[i].CreatedAt.Before(approvals[j].CreatedAt) })
+	return approvals
+}
+
+func (a *Approvals) Get(id string) (Approval, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	approval, ok := a.approvals[id]
+	if !ok {
+		return Approval{}, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	return *approval, nil
+}
+
+// Decide approves or rejects a pending approval, the waiting call resumes with the decision
+func (a *Approvals) Decide(id string, approve bool, approver, comment string) (Approval, error) {
+	status := ApprovalRejected
+	if approve {
+		status = ApprovalApproved
+	}
+	return a.finish(id, status, approver, comment)
+}
+
+// finish decides the approval if it's still pending
+func (a *Approvals) finish(id string, status ApprovalStatus, approver, comment string) (Approval, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	approval, ok := a.approvals[id]
+	if !ok {
+		return Approval{}, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	if approval.Status != ApprovalPending {
+		return *approval, fmt.Errorf("%w: %s is %s", ErrApprovalDecided, id, approval.Status)
+	}
+	approval.Status = status
+	approval.Approver = approver
+	approval.Comment = comment
+	approval.DecidedAt = time.Now()
+	if approval.decided != nil {
+		close(approval.decided)
+	}
+	// the decision stands even if it isn't persisted, the call is waiting for it
+	if err := a.persist(approval); err != nil {
+		logrus.WithError(err).Errorf("failed to persist approval %s", id)
+	}
+	return *approval, nil
+}
+
+// Await creates the pending approval and blocks until it's decided, it expires or ctx is done,
+// progress is called while it's pending
+func (a *Approvals) Await(ctx context.Context, approval Approval, progress func(pending Approval, waited time.Duration)) (Approval, error) {
+	now := time.Now()
+	approval.ID = uuid.NewString()
+	approval.Status = ApprovalPending
+	approval.CreatedAt = now
+	approval.ExpiresAt = now.Add(a.timeout)
+	// the pending one is changed by its decision, the snapshot is handed to progress
+	snapshot := approval
+	pending := &approval
+	pending.decided = make(chan struct{})
+
+	a.mu.Lock()
+	pending.Arguments = a.redactArguments(pending.Arguments)
+	snapshot.Arguments = pending.Arguments
+	if err := a.persist(pending); err != nil {
+		a.mu.Unlock()
+		return Approval{}, fmt.Errorf("failed to persist approval: %w", err)
+	}
+	a.approvals[pending.ID] = pending
+	if err := a.prune(now); err != nil {
+		logrus.WithError(err).Error("failed to delete expired approvals")
+	}
+	a.mu.Unlock()
+
+	timeout := time.NewTimer(a.timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(approvalProgressInterval)
+	defer ticker.Stop()
+	progress(snapshot, 0)
+	for {
+		select {
+		case <-pending.decided:
+			return a.Get(snapshot.ID)
+		case <-timeout.C:
+			// a decision racing the timeout wins, finish keeps it
+			finished, _ := a.finish(snapshot.ID, ApprovalExpired, "", "")
+			return finished, nil
+		case <-ctx.Done():
+			finished, _ := a.finish(snapshot.ID, ApprovalCanceled, "", ctx.Err().Error())
+			if finished.Status == ApprovalCanceled {
+				return finished, ctx.Err()
+			}
+			return finished, nil
+		case <-ticker.C:
+			progress(snapshot, time.Since(now))
+		}
+	}
+}
+
+// SetApprovals makes the calls requiring approval wait for an operator, without it they are refused
+func (r *Registry) SetApprovals(approvals *Approvals) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.approvals = approvals
+}
+
+func (r *Registry) approvalStore() *Approvals {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.approvals
+}
+
+// awaitApproval holds the call until an operator decides it, the client is sent progress notifications
+// with the id of the approval if it asked for the progress of the call
+func (s *MCPServer) awaitApproval(ctx context.Context, tool string, args map[string]any, result PolicyResult, meta *mcp.Meta) error {
+	s.mu.RLock()
+	approvals := s.registry.approvalStore()
+	s.mu.RUnlock()
+	if approvals == nil {
+		return result.Err()
+	}
+	logger := s.contextLogger(ctx).WithField(logging.FieldTool, tool)
+	approval, err := approvals.Await(ctx, Approval{
+		Server:    s.Name,
+		Tool:      tool,
+		Identity:  IdentityFromContext(ctx),
+		Arguments: args,
+		Policy:    result.Policy,
+		Reason:    result.Reason,
+	}, func(pending Approval, waited time.Duration) {
+		if waited == 0 {
+			logger.Infof("tool call waiting for approval %s", pending.ID)
+			trace.SpanFromContext(ctx).AddEvent("waiting for approval", trace.WithAttributes(attribute.String("omcp.approval.id", pending.ID)))
+		}
+		if meta == nil || meta.ProgressToken == nil {
+			return
+		}
+		total := pending.ExpiresAt.Sub(pending.CreatedAt)
+		_ = s.baseServer.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+			"progressToken": meta.ProgressToken,
+			"progress":      waited.Seconds(),
+			"total":         total.Seconds(),
+			"message":       fmt.Sprintf("waiting for approval %s, %s left", pending.ID, (total - waited).Round(time.Second)),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	logger.WithField("approver", approval.Approver).Infof("tool call approval %s %s", approval.ID, approval.Status)
+	trace.SpanFromContext(ctx).AddEvent("approval decided", trace.WithAttributes(
+		attribute.String("omcp.approval.id", approval.ID),
+		attribute.String("omcp.approval.status", string(approval.Status)),
+		attribute.String("omcp.approval.approver", approval.Approver),
+	))
+	return approval.Err()
+}
@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// memoryApprovalPersister keeps the last persisted version of the approvals
+type memoryApprovalPersister map[string]Approval
+
+func (p memoryApprovalPersister) SaveApproval(approval *Approval) error {
+	p[approval.ID] = *approval
+	return nil
+}
+
+func (p memoryApprovalPersister) DeleteApproval(id string) error {
+	delete(p, id)
+	return nil
+}
+
+func TestApprovalsRetention(t *testing.T) {
+	now := time.Now()
+	restored := func() []*Approval {
+		return []*Approval{
+			{ID: "old", Status: ApprovalApproved, CreatedAt: now.Add(-49 * time.Hour), DecidedAt: now.Add(-48 * time.Hour)},
+			{ID: "recent", Status: ApprovalRejected, CreatedAt: now.Add(-2 * time.Hour), DecidedAt: now.Add(-time.Hour)},
+			// the pending approvals are canceled by the restart, so they are decided now
+			{ID: "pending", Status: ApprovalPending, CreatedAt: now.Add(-3 * time.Hour)},
+		}
+	}
+	tests := []struct {
+		name      string
+		retention time.Duration
+		want      []string
+	}{
+		{name: "retention", retention: 24 * time.Hour, want: []string{"pending", "recent"}},
+		{name: "unlimited", want: []string{"old", "pending", "recent"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			persister := memoryApprovalPersister{}
+			for _, approval := range restored() {
+				persister[approval.ID] = *approval
+			}
+			approvals := NewApprovals(0, tt.retention, persister)
+			if err := approvals.Add(restored()...); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, approval := range approvals.List("", "") {
+				got = append(got, approval.ID)
+			}
+			if len(got) != len(tt.want) || len(persister) != len(tt.want) {
+				t.Fatalf("List() = %v with %d persisted, want %v", got, len(persister), tt.want)
+			}
+			for i, id := range tt.want {
+				if got[i] != id {
+					t.Fatalf("List() = %v, want %v", got, tt.want)
+				}
+				if _, ok := persister[id]; !ok {
+					t.Fatalf("approval %s isn't persisted", id)
+				}
+			}
+		})
+	}
+}
+
+func TestApprovalsRedact(t *testing.T) {
+	redact := func(args map[string]any) map[string]any {
+		redacted := maps.Clone(args)
+		if _, ok := redacted["password"]; ok {
+			redacted["password"] = "[REDACTED]"
+		}
+		return redacted
+	}
+	persister := memoryApprovalPersister{}
+	approvals := NewApprovals(time.Minute, 0, persister)
+	approvals.SetRedactor(redact)
+	args := map[string]any{"user": "alice", "password": "hunter2"}
+	want := map[string]any{"user": "alice", "password": "[REDACTED]"}
+
+	// the approvals persisted before the redaction are redacted once restored
+	if err := approvals.Add(&Approval{ID: "restored", Status: ApprovalApproved, Arguments: maps.Clone(args), DecidedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if got := persister["restored"].Arguments; !reflect.DeepEqual(got, want) {
+		t.Fatalf("restored approval persisted with %v, want %v", got, want)
+	}
+
+	awaited := make(chan Approval)
+	go func() {
+		approval, _ := approvals.Await(context.Background(), Approval{Server: "s", Tool: "login", Arguments: args}, func(Approval, time.Duration) {})
+		awaited <- approval
+	}()
+	var pending []Approval
+	for deadline := time.Now().Add(5 * time.Second); len(pending) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the call never waited for approval")
+		}
+		pending = approvals.List(ApprovalPending, "")
+	}
+	if got := pending[0].Arguments; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List() arguments = %v, want %v", got, want)
+	}
+	if got := persister[pending[0].ID].Arguments; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pending approval persisted with %v, want %v", got, want)
+	}
+	if _, err := approvals.Decide(pending[0].ID, true, "admin", ""); err != nil {
+		t.Fatal(err)
+	}
+	<-awaited
+	if args["password"] != "hunter2" {
+		t.Fatalf("the redaction changed the arguments of the call: %v", args)
+	}
+}
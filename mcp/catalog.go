@@ -0,0 +1,53 @@
+package mcp
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	catalogMu sync.RWMutex
+	catalog   = make(map[string]MCPTool)
+)
+
+// RegisterCatalogTool adds a built-in tool to the catalog,
+// persisted tools are rehydrated from the catalog by name
+func RegisterCatalogTool(tool MCPTool) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	catalog[tool.Name] = tool
+}
+
+func CatalogTool(name string) (MCPTool, bool) {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	tool, ok := catalog[name]
+	return tool, ok
+}
+
+func CatalogTools() []MCPTool {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	tools := make([]MCPTool, 0, len(catalog))
+	for _, tool := range catalog {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// CatalogResolver resolves the handler of a persisted tool from the catalog
+func CatalogResolver(tool MCPTool) (MCPTool, error) {
+	resolved, ok := CatalogTool(tool.Name)
+	if !ok {
+		return MCPTool{}, fmt.Errorf("tool %s not found in catalog", tool.Name)
+	}
+	// the description may have been overridden when the tool was added
+	if tool.Desc != "" {
+		resolved.Desc = tool.Desc
+	}
+	resolved.CreatedAt = tool.CreatedAt
+	resolved.UpdatedAt = tool.UpdatedAt
+	return resolved, nil
+}
@@ -0,0 +1,70 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	ParamTypeString  = "string"
+	ParamTypeNumber  = "number"
+	ParamTypeBoolean = "boolean"
+)
+
+type ToolParam struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Desc     string `json:"desc"`
+	Required bool   `json:"required"`
+}
+
+// ToolDefinition is a declarative tool, it's defined without any go code,
+// the result of the tool is the response template rendered with the arguments
+type ToolDefinition struct {
+	Params   []ToolParam `json:"params"`
+	Response string      `json:"response"`
+}
+
+// Build validates the definition and builds the tool from it
+func (d *ToolDefinition) Build(name, desc string) (MCPTool, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(d.Response)
+	if err != nil {
+		return MCPTool{}, fmt.Errorf("invalid response template of tool %s: %w", name, err)
+	}
+
+	opts := make([]mcp.ToolOption, 0, len(d.Params))
+	for _, param := range d.Params {
+		propOpts := []mcp.PropertyOption{mcp.Description(param.Desc)}
+		if param.Required {
+			propOpts = append(propOpts, mcp.Required())
+		}
+		switch param.Type {
+		case ParamTypeString, "":
+			opts = append(opts, mcp.WithString(param.Name, propOpts...))
+		case ParamTypeNumber:
+			opts = append(opts, mcp.WithNumber(param.Name, propOpts...))
+		case ParamTypeBoolean:
+			opts = append(opts, mcp.WithBoolean(param.Name, propOpts...))
+		default:
+			return MCPTool{}, fmt.Errorf("unknown type %s of param %s", param.Type, param.Name)
+		}
+	}
+
+	return MCPTool{
+		Name:       name,
+		Desc:       desc,
+		Definition: d,
+		Option:     opts,
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, request.GetArguments()); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(buf.String()), nil
+		},
+	}, nil
+}
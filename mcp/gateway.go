@@ -0,0 +1,348 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// NamespaceAlways prefixes every tool and prompt with the name of its member
+	NamespaceAlways = "always"
+	// NamespaceOnConflict prefixes only the names served by more than one member
+	NamespaceOnConflict = "on-conflict"
+	// NamespaceNever keeps the names, the first member in the list wins a conflict
+	NamespaceNever = "never"
+
+	DefaultNamespaceSeparator = "__"
+)
+
+var ErrMemberNotRunning = errors.New("gateway member is not running")
+
+// Gateway aggregates the tools, resources and prompts of the member servers into one server,
+// the resources keep their uris, a uri served by several members is served by the first one,
+// the members are called in process so the client keys of the members are not checked, the gateway
+// is refused unless it has client keys itself once a member has some
+type Gateway struct {
+	Members []string `json:"members"`
+	// Namespace tells when the names are prefixed with the member, always by default
+	Namespace string `json:"namespace,omitempty"`
+	// Separator joins the member and the name, __ by default
+	Separator string `json:"separator,omitempty"`
+}
+
+// GatewayStatus is the result of the last sync of the members
+type GatewayStatus struct {
+	// Unavailable are the members which don't exist or are not running
+	Unavailable []string `json:"unavailable,omitempty"`
+	// Conflicts are the names which are not served since another item took them
+	Conflicts []string  `json:"conflicts,omitempty"`
+	SyncedAt  time.Time `json:"synced_at,omitempty"`
+}
+
+func (g *Gateway) Validate(server string) error {
+	if len(g.Members) == 0 {
+		return errors.New("at least one member of the gateway is required")
+	}
+	for i, member := range g.Members {
+		if member == "" {
+			return errors.New("member name of the gateway is required")
+		}
+		if member == server {
+			return fmt.Errorf("gateway %s can't be a member of itself", server)
+		}
+		if slices.Contains(g.Members[:i], member) {
+			return fmt.Errorf("duplicated gateway member: %s", member)
+		}
+	}
+	switch g.Namespace {
+	case "", NamespaceAlways, NamespaceOnConflict, NamespaceNever:
+	default:
+		return fmt.Errorf("unknown gateway namespace: %s", g.Namespace)
+	}
+	return nil
+}
+
+// String describes the gateway for the listings
+func (g *Gateway) String() string {
+	return fmt.Sprintf("gateway: %s", strings.Join(g.Members, ","))
+}
+
+// itemName is the name an item of the member is served as, shared is set
+// if the name is served by more than one member
+func (g *Gateway) itemName(member, name string, shared bool) string {
+	switch g.Namespace {
+	case NamespaceNever:
+		return name
+	case NamespaceOnConflict:
+		if !shared {
+			return name
+		}
+	}
+	separator := g.Separator
+	if separator == "" {
+		separator = DefaultNamespaceSeparator
+	}
+	return member + separator + name
+}
+
+// aggregator mounts the items of the gateway members and re-mounts them
+// whenever a member changes, the calls are routed to the owning members
+type aggregator struct {
+	server   *MCPServer
+	gateway  Gateway
+	registry *Registry
+	logger   *logrus.Entry
+
+	changed chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// startGateway mounts the members and watches them, it's a no-op until the server is registered
+func (s *MCPServer) startGateway() {
+	s.mu.Lock()
+	if s.Gateway == nil || s.registry == nil || s.aggregator != nil {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &aggregator{
+		server:   s,
+		gateway:  *s.Gateway,
+		registry: s.registry,
+		logger:   s.Logger(),
+		changed:  make(chan struct{}, 1),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	s.aggregator = a
+	s.mu.Unlock()
+
+	a.registry.watch(a)
+	// the members are served once the start returns
+	a.sync()
+	go a.run(ctx)
+}
+
+// stopGateway stops watching the members and removes their items
+func (s *MCPServer) stopGateway() {
+	s.mu.Lock()
+	a := s.aggregator
+	s.aggregator = nil
+	s.mu.Unlock()
+	if a == nil {
+		return
+	}
+	a.registry.unwatch(a)
+	a.cancel()
+	<-a.done
+	for _, member := range a.gateway.Members {
+		s.Unmount(member)
+	}
+}
+
+// notify schedules a sync, the changes made meanwhile are synced together
+func (a *aggregator) notify() {
+	select {
+	case a.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (a *aggregator) run(ctx context.Context) {
+	defer close(a.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.changed:
+			a.sync()
+		}
+	}
+}
+
+// memberItems are the items of a running member
+type memberItems struct {
+	name      string
+	tools     []MCPTool
+	resources []MCPResource
+	prompts   []MCPPrompt
+}
+
+// sync mounts the current items of the running members
+func (a *aggregator) sync() {
+	var members []memberItems
+	var unavailable []string
+	for _, name := range a.gateway.Members {
+		member, err := a.registry.Get(name)
+		// a gateway isn't aggregated again, so the gateways never watch each other
+		if err != nil || !member.IsRunning() || member.Gateway != nil {
+			unavailable = append(unavailable, name)
+			a.server.Unmount(name)
+			continue
+		}
+		tools, _ := member.ListTools()
+		members = append(members, memberItems{
+			name:      name,
+			tools:     tools,
+			resources: member.ListResources(),
+			prompts:   member.ListPrompts(),
+		})
+	}
+
+	toolMembers := make(map[string]int)
+	promptMembers := make(map[string]int)
+	for _, member := range members {
+		for _, tool := range member.tools {
+			toolMembers[tool.Name]++
+		}
+		for _, prompt := range member.prompts {
+			promptMembers[prompt.Name]++
+		}
+	}
+
+	mounts := make([]memberItems, 0, len(members))
+	var conflicts []string
+	served := make(map[string]bool)
+	// serve claims the name of the kind for the member, the earlier members win
+	serve := func(kind, name string) bool {
+		if served[kind+":"+name] {
+			conflicts = append(conflicts, name)
+			return false
+		}
+		served[kind+":"+name] = true
+		return true
+	}
+	for _, member := range members {
+		mount := memberItems{name: member.name}
+		for _, tool := range member.tools {
+			name := a.gateway.itemName(member.name, tool.Name, toolMembers[tool.Name] > 1)
+			if !serve("tool", name) {
+				continue
+			}
+			tool.Handler = a.callTool(member.name, tool.Name)
+			// the member holds the call for the approval, the gateway doesn't ask twice
+			tool.RequireApproval = false
+			tool.Name = name
+			mount.tools = append(mount.tools, tool)
+		}
+		for _, resource := range member.resources {
+			if !serve("resource", resource.URI) {
+				continue
+			}
+			resource.Handler = a.readResource(member.name, resource.URI)
+			mount.resources = append(mount.resources, resource)
+		}
+		for _, prompt := range member.prompts {
+			name := a.gateway.itemName(member.name, prompt.Name, promptMembers[prompt.Name] > 1)
+			if !serve("prompt", name) {
+				continue
+			}
+			prompt.Handler = a.getPrompt(member.name, prompt.Name)
+			prompt.Name = name
+			mount.prompts = append(mount.prompts, prompt)
+		}
+		mounts = append(mounts, mount)
+	}
+
+	// a name moving between the members is still held by its previous member
+	// in the first pass, the second one mounts it once it's released
+	var shadowed []string
+	for pass := 0; pass < 2; pass++ {
+		shadowed = shadowed[:0]
+		for _, mount := range mounts {
+			shadowed = append(shadowed, a.server.Mount(mount.name, mount.tools, mount.resources, mount.prompts)...)
+		}
+		if len(shadowed) == 0 {
+			break
+		}
+	}
+	conflicts = append(conflicts, shadowed...)
+	if len(conflicts) > 0 {
+		a.logger.Warnf("gateway items shadowed by the other items: %v", conflicts)
+	}
+
+	a.server.mu.Lock()
+	a.server.GatewayStatus = &GatewayStatus{
+		Unavailable: unavailable,
+		Conflicts:   conflicts,
+		SyncedAt:    time.Now(),
+	}
+	a.server.mu.Unlock()
+}
+
+// member returns the running member the call is routed to
+func (a *aggregator) member(name string) (*MCPServer, error) {
+	member, err := a.registry.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if !member.IsRunning() {
+		return nil, fmt.Errorf("%w: %s", ErrMemberNotRunning, name)
+	}
+	return member, nil
+}
+
+// callTool routes the call to the tool of the member under its own name
+func (a *aggregator) callTool(member, name string) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		server, err := a.member(member)
+		if err != nil {
+			return nil, err
+		}
+		tool, ok := server.GetTool(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrToolNotFound, name)
+		}
+		// the policies of the member decide the calls through the gateway as well
+		if err := server.authorizeCall(ctx, tool, request); err != nil {
+			return nil, err
+		}
+		ctx, err = server.withSecrets(ctx, tool)
+		if err != nil {
+			return nil, err
+		}
+		request.Params.Name = name
+		return tool.Handler(ctx, request)
+	}
+}
+
+func (a *aggregator) readResource(member, uri string) ResourceHandler {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		server, err := a.member(member)
+		if err != nil {
+			return nil, err
+		}
+		resources := server.ListResources()
+		i := slices.IndexFunc(resources, func(resource MCPResource) bool { return resource.URI == uri })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrResourceNotFound, request.Params.URI)
+		}
+		return resources[i].Handler(ctx, request)
+	}
+}
+
+func (a *aggregator) getPrompt(member, name string) PromptHandler {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		server, err := a.member(member)
+		if err != nil {
+			return nil, err
+		}
+		prompt, ok := server.GetPrompt(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPromptNotFound, name)
+		}
+		if prompt.Handler == nil {
+			return prompt.Render(request.Params.Arguments)
+		}
+		request.Params.Name = name
+		return prompt.Handler(ctx, request)
+	}
+}
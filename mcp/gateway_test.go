@@ -0,0 +1,191 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// echoTool replies with the name of the member, so the routing of a call can be told
+func echoTool(name, member string) MCPTool {
+	return MCPTool{
+		Name: name,
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(member + ":" + request.Params.Name), nil
+		},
+	}
+}
+
+// newTestGateway starts the members a, with the tools search and read, and b, with the tool search,
+// and the gateway g over them
+func newTestGateway(t *testing.T, gateway Gateway) (*Registry, *MCPServer) {
+	t.Helper()
+	registry := NewRegistry(nil)
+	members := map[string][]string{"a": {"search", "read"}, "b": {"search"}}
+	for _, name := range []string{"a", "b"} {
+		member, err := registry.Create(name, "", "1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tool := range members[name] {
+			if err := member.AddTool(echoTool(tool, name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := registry.Start(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server, err := registry.Create("g", "", "1.0.0", WithGateway(&gateway))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Start("g"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Stop() })
+	return registry, server
+}
+
+func toolNames(server *MCPServer) []string {
+	tools, _ := server.ListTools()
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// gatewayStatus reads the status under the lock, the gateway syncs in the background
+func gatewayStatus(server *MCPServer) GatewayStatus {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	return *server.GatewayStatus
+}
+
+func callTool(server *MCPServer, name string) (string, error) {
+	tool, ok := server.GetTool(name)
+	if !ok {
+		return "", ErrToolNotFound
+	}
+	result, err := tool.Handler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Name: name}})
+	if err != nil {
+		return "", err
+	}
+	return result.Content[0].(mcp.TextContent).Text, nil
+}
+
+func TestGatewayNamespace(t *testing.T) {
+	tests := []struct {
+		name          string
+		gateway       Gateway
+		wantTools     []string
+		wantConflicts []string
+		// wantCalls maps the served names to the member and the name they are routed to
+		wantCalls map[string]string
+	}{
+		{
+			name:      "always",
+			gateway:   Gateway{Members: []string{"a", "b"}},
+			wantTools: []string{"a__read", "a__search", "b__search"},
+			wantCalls: map[string]string{"a__search": "a:search", "b__search": "b:search", "a__read": "a:read"},
+		},
+		{
+			name:      "custom separator",
+			gateway:   Gateway{Members: []string{"a", "b"}, Separator: "."},
+			wantTools: []string{"a.read", "a.search", "b.search"},
+			wantCalls: map[string]string{"b.search": "b:search"},
+		},
+		{
+			name:      "on conflict",
+			gateway:   Gateway{Members: []string{"a", "b"}, Namespace: NamespaceOnConflict},
+			wantTools: []string{"a__search", "b__search", "read"},
+			wantCalls: map[string]string{"read": "a:read", "b__search": "b:search"},
+		},
+		{
+			// the first member in the list wins the conflict
+			name:          "never",
+			gateway:       Gateway{Members: []string{"b", "a"}, Namespace: NamespaceNever},
+			wantTools:     []string{"read", "search"},
+			wantConflicts: []string{"search"},
+			wantCalls:     map[string]string{"search": "b:search", "read": "a:read"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, gateway := newTestGateway(t, tt.gateway)
+			if got := toolNames(gateway); !slices.Equal(got, tt.wantTools) {
+				t.Fatalf("tools = %v, want %v", got, tt.wantTools)
+			}
+			if got := gatewayStatus(gateway).Conflicts; !slices.Equal(got, tt.wantConflicts) {
+				t.Errorf("conflicts = %v, want %v", got, tt.wantConflicts)
+			}
+			for name, want := range tt.wantCalls {
+				if got, err := callTool(gateway, name); err != nil || got != want {
+					t.Errorf("call %s = %q, %v, want %q", name, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGatewayMembers(t *testing.T) {
+	registry, gateway := newTestGateway(t, Gateway{Members: []string{"a", "b", "missing"}})
+	if got := gatewayStatus(gateway).Unavailable; !slices.Equal(got, []string{"missing"}) {
+		t.Fatalf("unavailable = %v, want [missing]", got)
+	}
+
+	// the policies of the member decide the calls through the gateway
+	a, err := registry.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddPolicy(Policy{Name: "no-read", Tools: []string{"read"}, Decision: DecisionDeny}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := callTool(gateway, "a__read"); !errors.Is(err, ErrCallDenied) {
+		t.Fatalf("call of a denied tool error = %v, want %v", err, ErrCallDenied)
+	}
+	if got, err := callTool(gateway, "a__search"); err != nil || got != "a:search" {
+		t.Fatalf("call of an allowed tool = %q, %v", got, err)
+	}
+
+	// a stopped member is unmounted once the gateway syncs
+	if _, err := registry.Stop("b"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for slices.Contains(toolNames(gateway), "b__search") {
+		if time.Now().After(deadline) {
+			t.Fatalf("tools of the stopped member are still served: %v", toolNames(gateway))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGatewayValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		gateway Gateway
+		wantErr bool
+	}{
+		{name: "members", gateway: Gateway{Members: []string{"a", "b"}}},
+		{name: "no member", gateway: Gateway{}, wantErr: true},
+		{name: "empty member", gateway: Gateway{Members: []string{""}}, wantErr: true},
+		{name: "itself", gateway: Gateway{Members: []string{"a", "g"}}, wantErr: true},
+		{name: "duplicated member", gateway: Gateway{Members: []string{"a", "a"}}, wantErr: true},
+		{name: "unknown namespace", gateway: Gateway{Members: []string{"a"}, Namespace: "sometimes"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.gateway.Validate("g"); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultHistorySize      = 10000
+	DefaultHistoryRetention = 7 * 24 * time.Hour
+
+	// maxCallSummary is the length the result summary and the error of a call are cut at
+	maxCallSummary = 1024
+)
+
+var ErrCallNotFound = errors.New("tool call not found")
+
+// CallRecord is a tool call kept in the history
+type CallRecord struct {
+	ID string `json:"id"`
+	// Seq orders the records by the time they finished, a tail follows the records after a seq
+	Seq           uint64         `json:"seq"`
+	Server        string         `json:"server"`
+	Tool          string         `json:"tool"`
+	Session       string         `json:"session,omitempty"`
+	ClientName    string         `json:"client_name,omitempty"`
+	ClientVersion string         `json:"client_version,omitempty"`
+	Subject       string         `json:"subject,omitempty"`
+	Arguments     map[string]any `json:"arguments,omitempty"`
+	Status        string         `json:"status"`
+	// Result is the summary of the content of the result, Error the error of the call or of its result
+	Result     string    `json:"result,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Start      time.Time `json:"start"`
+	DurationMs float64   `json:"duration_ms"`
+}
+
+// CallFilter selects the records, the empty fields match every record
+type CallFilter struct {
+	Server  string    `json:"server,omitempty"`
+	Tool    string    `json:"tool,omitempty"`
+	Session string    `json:"session,omitempty"`
+	Status  string    `json:"status,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+	Until   time.Time `json:"until,omitempty"`
+	// After selects the records after the seq, to follow the history
+	After uint64 `json:"after,omitempty"`
+	// Limit keeps the latest records, all of them if 0
+	Limit int `json:"limit,omitempty"`
+}
+
+func (f CallFilter) Matches(record CallRecord) bool {
+	switch {
+	case f.Server != "" && record.Server != f.Server,
+		f.Tool != "" && record.Tool != f.Tool,
+		f.Session != "" && record.Session != f.Session,
+		f.Status != "" && record.Status != f.Status,
+		!f.Since.IsZero() && record.Start.Before(f.Since),
+		!f.Until.IsZero() && record.Start.After(f.Until),
+		record.Seq <= f.After:
+		return false
+	}
+	return true
+}
+
+// HistoryPersister persists the records, the dropped ones are deleted
+type HistoryPersister interface {
+	SaveCall(record *CallRecord) error
+	DeleteCall(id string) error
+}
+
+// History keeps the latest tool calls up to its size and for its retention, it's safe to be used from multiple goroutines
+type History struct {
+	mu        sync.Mutex
+	records   []*CallRecord
+	seq       uint64
+	size      int
+	retention time.Duration
+	persister HistoryPersister
+}
+
+// NewHistory creates the history keeping size records for the retention, the retention is unlimited if 0,
+// the persister can be nil to keep them in memory only
+func NewHistory(size int, retention time.Duration, persister HistoryPersister) *History {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &History{
+		size:      size,
+		retention: retention,
+		persister: persister,
+	}
+}
+
+// Add adds the restored records, the ones beyond the size and the retention are dropped
+func (h *History) Add(records ...*CallRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, records...)
+	sort.Slice(h.records, func(i, j int) bool { return h.records[i].Seq < h.records[j].Seq })
+	if n := len(h.records); n > 0 && h.records[n-1].Seq > h.seq {
+		h.seq = h.records[n-1].Seq
+	}
+	return h.prune(time.Now())
+}
+
+// Record adds a finished call, the result is summarized
+func (h *History) Record(call ToolCall) {
+	record := &CallRecord{
+		ID:            uuid.NewString(),
+		Server:        call.Server,
+		Tool:          call.Tool,
+		Session:       call.Session,
+		ClientName:    call.Client.Name,
+		ClientVersion: call.Client.Version,
+		Arguments:     call.Arguments,
+		Status:        call.Status,
+		Start:         call.Start,
+		DurationMs:    float64(call.Duration.Microseconds()) / 1000,
+	}
+	if call.Identity != nil {
+		record.Subject = call.Identity.Subject
+	}
+	switch {
+	case call.Err != nil:
+		record.Error = truncate(call.Err.Error(), maxCallSummary)
+	case call.Result != nil && call.Result.IsError:
+		record.Error = truncate(summarizeResult(call.Result), maxCallSummary)
+	case call.Result != nil:
+		record.Result = truncate(summarizeResult(call.Result), maxCallSummary)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	record.Seq = h.seq
+	h.records = append(h.records, record)
+	// the call is kept even if it isn't persisted
+	errs := []error{h.persist(record), h.prune(time.Now())}
+	if err := errors.Join(errs...); err != nil {
+		logrus.WithError(err).Error("failed to persist tool call history")
+	}
+}
+
+func (h *History) persist(record *CallRecord) error {
+	if h.persister == nil {
+		return nil
+	}
+	return h.persister.SaveCall(record)
+}
+
+// prune drops the records beyond the size and the retention, the caller must hold h.mu
+func (h *History) prune(now time.Time) error {
+	drop := max(len(h.records)-h.size, 0)
+	if h.retention > 0 {
+		for drop < len(h.records) && now.Sub(h.records[drop].Start) > h.retention {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return nil
+	}
+	var errs []error
+	if h.persister != nil {
+		for _, record := range h.records[:drop] {
+			errs = append(errs, h.persister.DeleteCall(record.ID))
+		}
+	}
+	h.records = append(h.records[:0], h.records[drop:]...)
+	return errors.Join(errs...)
+}
+
+// List returns the records of the filter from the oldest one, the expired records are dropped first
+func (h *History) List(filter CallFilter) []CallRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.prune(time.Now()); err != nil {
+		logrus.WithError(err).Error("failed to delete expired tool call history")
+	}
+	records := []CallRecord{}
+	for _, record := range h.records {
+		if filter.Matches(*record) {
+			records = append(records, *record)
+		}
+	}
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[len(records)-filter.Limit:]
+	}
+	return records
+}
+
+func (h *History) Get(id string) (CallRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, record := range h.records {
+		if record.ID == id {
+			return *record, nil
+		}
+	}
+	return CallRecord{}, fmt.Errorf("%w: %s", ErrCallNotFound, id)
+}
+
+// summarizeResult is the text of the result, the other contents are shown by their type
+func summarizeResult(result *mcp.CallToolResult) string {
+	var parts []string
+	for _, content := range result.Content {
+		switch content := content.(type) {
+		case mcp.TextContent:
+			parts = append(parts, content.Text)
+		case mcp.ImageContent:
+			parts = append(parts, fmt.Sprintf("[image %s]", content.MIMEType))
+		case mcp.AudioContent:
+			parts = append(parts, fmt.Sprintf("[audio %s]", content.MIMEType))
+		case mcp.EmbeddedResource:
+			parts = append(parts, "[resource]")
+		default:
+			parts = append(parts, "[content]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// cut on a rune boundary
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
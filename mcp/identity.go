@@ -0,0 +1,38 @@
+package mcp
+
+import (
+	"context"
+	"slices"
+)
+
+// Identity is the authenticated caller of a MCP request, the tool handlers read it from the context
+type Identity struct {
+	// Subject is the sub claim of a bearer token, or the client key as key:<name>
+	Subject string `json:"subject"`
+	// Issuer is the issuer of the bearer token, empty for a client key
+	Issuer string         `json:"issuer,omitempty"`
+	Scopes []string       `json:"scopes,omitempty"`
+	Groups []string       `json:"groups,omitempty"`
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+type identityKey struct{}
+
+// WithIdentity attaches the identity of the caller to the context
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity of the caller, nil for an anonymous one
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+func (i *Identity) HasScope(scope string) bool {
+	return i != nil && slices.Contains(i.Scopes, scope)
+}
+
+func (i *Identity) InGroup(group string) bool {
+	return i != nil && slices.Contains(i.Groups, group)
+}
@@ -0,0 +1,110 @@
+package mcp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+// WithLabels sets the labels of the server, the role bindings select the servers by them
+func WithLabels(labels map[string]string) ServerOption {
+	return func(s *MCPServer) error {
+		if err := ValidateLabels(labels); err != nil {
+			return err
+		}
+		if len(labels) > 0 {
+			s.Labels = labels
+		}
+		return nil
+	}
+}
+
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid label key: %q", key)
+		}
+		if strings.ContainsAny(value, ",=! ") {
+			return fmt.Errorf("invalid value of label %s: %q", key, value)
+		}
+	}
+	return nil
+}
+
+// FormatLabels formats the labels as k=v pairs sorted by key
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+type requirement struct {
+	key    string
+	value  string
+	negate bool
+	// exists requires the key only, with any value
+	exists bool
+}
+
+// Selector selects the servers by their labels, e.g. env=prod,tier!=db,team
+// requires env to be prod, tier not to be db and team to be set
+type Selector struct {
+	raw          string
+	requirements []requirement
+}
+
+// ParseSelector parses the comma separated requirements, key=value, key!=value or key,
+// an empty selector selects every server
+func ParseSelector(raw string) (Selector, error) {
+	selector := Selector{raw: raw}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var req requirement
+		if key, value, ok := strings.Cut(part, "!="); ok {
+			req = requirement{key: strings.TrimSpace(key), value: strings.TrimSpace(value), negate: true}
+		} else if key, value, ok := strings.Cut(part, "="); ok {
+			req = requirement{key: strings.TrimSpace(key), value: strings.TrimSpace(value)}
+		} else {
+			req = requirement{key: part, exists: true}
+		}
+		if !labelKeyPattern.MatchString(req.key) {
+			return Selector{}, fmt.Errorf("invalid label selector %q: invalid key %q", raw, req.key)
+		}
+		selector.requirements = append(selector.requirements, req)
+	}
+	return selector, nil
+}
+
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s.requirements {
+		value, ok := labels[req.key]
+		switch {
+		case req.exists:
+			if !ok {
+				return false
+			}
+		case req.negate:
+			if ok && value == req.value {
+				return false
+			}
+		default:
+			if !ok || value != req.value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	return s.raw
+}
@@ -0,0 +1,33 @@
+package mcp
+
+import (
+	"context"
+
+	"github.com/jyz0309/omcp/logging"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger is the logger of the server, every line has the name of the server
+func (s *MCPServer) Logger() *logrus.Entry {
+	return logrus.WithField(logging.FieldServer, s.Name)
+}
+
+// contextLogger is the logger of the server with the request and the client session of ctx
+func (s *MCPServer) contextLogger(ctx context.Context) *logrus.Entry {
+	logger := s.Logger()
+	if id := logging.RequestIDFromContext(ctx); id != "" {
+		logger = logger.WithField(logging.FieldRequestID, id)
+	}
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		logger = logger.WithField(logging.FieldSession, session.SessionID())
+	}
+	return logger
+}
+
+// LoggerFromContext is the logger a plugin handler logs with, it has the server, the tool,
+// the client session and the request of the call
+func LoggerFromContext(ctx context.Context) *logrus.Entry {
+	return logging.FromContext(ctx)
+}
@@ -0,0 +1,172 @@
+package mcp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jyz0309/omcp/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultLogBufferSize = 1000
+
+	// logFollowerBuffer is how many lines a follower can fall behind before it's dropped
+	logFollowerBuffer = 256
+)
+
+// LogLine is a log line of a server
+type LogLine struct {
+	Seq     uint64            `json:"seq"`
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// LogBuffer keeps the latest log lines of a server in a ring and hands the new ones to its followers,
+// it's safe to be used from multiple goroutines
+type LogBuffer struct {
+	mu        sync.Mutex
+	lines     []LogLine
+	next      int
+	seq       uint64
+	followers map[chan LogLine]struct{}
+	closed    bool
+}
+
+func NewLogBuffer(size int) *LogBuffer {
+	if size <= 0 {
+		size = DefaultLogBufferSize
+	}
+	return &LogBuffer{
+		lines:     make([]LogLine, 0, size),
+		followers: make(map[chan LogLine]struct{}),
+	}
+}
+
+// Append adds the line, the oldest one is overwritten once the ring is full,
+// a follower which can't keep up is dropped so it notices the lines it missed
+func (b *LogBuffer) Append(line LogLine) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.seq++
+	line.Seq = b.seq
+	if len(b.lines) < cap(b.lines) {
+		b.lines = append(b.lines, line)
+	} else {
+		b.lines[b.next] = line
+		b.next = (b.next + 1) % len(b.lines)
+	}
+	for follower := range b.followers {
+		select {
+		case follower <- line:
+		default:
+			delete(b.followers, follower)
+			close(follower)
+		}
+	}
+}
+
+// Lines returns the kept lines since the time from the oldest one, all of them if since is zero
+func (b *LogBuffer) Lines(since time.Time) []LogLine {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.since(since)
+}
+
+// since is Lines without the lock, the caller must hold b.mu
+func (b *LogBuffer) since(since time.Time) []LogLine {
+	lines := make([]LogLine, 0, len(b.lines))
+	for i := range b.lines {
+		line := b.lines[(b.next+i)%len(b.lines)]
+		if !since.IsZero() && line.Time.Before(since) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Follow returns the kept lines since the time and a channel of the lines appended after them,
+// the channel is closed if the follower falls behind or the buffer is closed, stop must be called once done
+func (b *LogBuffer) Follow(since time.Time) (lines []LogLine, follow <-chan LogLine, stop func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	follower := make(chan LogLine, logFollowerBuffer)
+	if b.closed {
+		close(follower)
+	} else {
+		b.followers[follower] = struct{}{}
+	}
+	stop = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.followers[follower]; ok {
+			delete(b.followers, follower)
+			close(follower)
+		}
+	}
+	return b.since(since), follower, stop
+}
+
+// Close ends the followers, e.g. once the server is deleted, the later lines are discarded
+func (b *LogBuffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for follower := range b.followers {
+		delete(b.followers, follower)
+		close(follower)
+	}
+}
+
+// Logs is the log buffer of the server
+func (s *MCPServer) Logs() *LogBuffer {
+	return s.logs
+}
+
+// logHook copies the log lines of the servers, the ones with their name in the server field, to their log buffers
+type logHook struct {
+	buffers *sync.Map
+}
+
+func (h logHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h logHook) Fire(entry *logrus.Entry) error {
+	name, ok := entry.Data[logging.FieldServer].(string)
+	if !ok {
+		return nil
+	}
+	buffer, ok := h.buffers.Load(name)
+	if !ok {
+		return nil
+	}
+	line := LogLine{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+	}
+	for key, value := range entry.Data {
+		if key == logging.FieldServer {
+			continue
+		}
+		if line.Fields == nil {
+			line.Fields = make(map[string]string, len(entry.Data))
+		}
+		if err, ok := value.(error); ok {
+			line.Fields[key] = err.Error()
+		} else {
+			line.Fields[key] = fmt.Sprint(value)
+		}
+	}
+	buffer.(*LogBuffer).Append(line)
+	return nil
+}
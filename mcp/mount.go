@@ -0,0 +1,88 @@
+package mcp
+
+import (
+	"slices"
+)
+
+// Mount replaces the tools, resources and prompts mounted from the upstream with the given ones.
+// The local items and the items of the other upstreams win the name conflicts, the skipped
+// names are returned. The mounted items are served like the local ones, but they are not restored
+func (s *MCPServer) Mount(upstream string, tools []MCPTool, resources []MCPResource, prompts []MCPPrompt) (conflicts []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the mounted items are not part of the server definition
+	updatedAt := s.UpdatedAt
+	defer func() { s.UpdatedAt = updatedAt }()
+
+	var stale []string
+	for _, tool := range s.Tools {
+		if tool.Mount == upstream && !slices.ContainsFunc(tools, func(t MCPTool) bool { return t.Name == tool.Name }) {
+			stale = append(stale, tool.Name)
+		}
+	}
+	if len(stale) > 0 {
+		s.Tools = slices.DeleteFunc(s.Tools, func(tool MCPTool) bool {
+			return tool.Mount == upstream && slices.Contains(stale, tool.Name)
+		})
+		s.baseServer.DeleteTools(stale...)
+	}
+	for _, tool := range tools {
+		tool.Mount = upstream
+		if i := s.toolIndex(tool.Name); i >= 0 {
+			if s.Tools[i].Mount != upstream {
+				conflicts = append(conflicts, tool.Name)
+				continue
+			}
+			tool.CreatedAt, tool.UpdatedAt = s.Tools[i].CreatedAt, s.Tools[i].UpdatedAt
+		}
+		s.putTool(tool)
+	}
+
+	for i := len(s.Resources) - 1; i >= 0; i-- {
+		resource := s.Resources[i]
+		if resource.Mount == upstream && !slices.ContainsFunc(resources, func(r MCPResource) bool { return r.URI == resource.URI }) {
+			s.removeResource(i)
+		}
+	}
+	for _, resource := range resources {
+		resource.Mount = upstream
+		if i := s.resourceIndex(resource.URI); i >= 0 {
+			if s.Resources[i].Mount != upstream {
+				conflicts = append(conflicts, resource.URI)
+				continue
+			}
+			resource.CreatedAt, resource.UpdatedAt = s.Resources[i].CreatedAt, s.Resources[i].UpdatedAt
+		}
+		s.putResource(resource)
+	}
+
+	stale = stale[:0]
+	for _, prompt := range s.Prompts {
+		if prompt.Mount == upstream && !slices.ContainsFunc(prompts, func(p MCPPrompt) bool { return p.Name == prompt.Name }) {
+			stale = append(stale, prompt.Name)
+		}
+	}
+	if len(stale) > 0 {
+		s.Prompts = slices.DeleteFunc(s.Prompts, func(prompt MCPPrompt) bool {
+			return prompt.Mount == upstream && slices.Contains(stale, prompt.Name)
+		})
+		s.baseServer.DeletePrompts(stale...)
+	}
+	for _, prompt := range prompts {
+		prompt.Mount = upstream
+		if i := s.promptIndex(prompt.Name); i >= 0 {
+			if s.Prompts[i].Mount != upstream {
+				conflicts = append(conflicts, prompt.Name)
+				continue
+			}
+			prompt.CreatedAt, prompt.UpdatedAt = s.Prompts[i].CreatedAt, s.Prompts[i].UpdatedAt
+		}
+		s.putPrompt(prompt)
+	}
+	return conflicts
+}
+
+// Unmount removes all the items mounted from the upstream
+func (s *MCPServer) Unmount(upstream string) {
+	s.Mount(upstream, nil, nil, nil)
+}
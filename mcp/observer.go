@@ -0,0 +1,87 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	CallStatusSuccess = "success"
+	CallStatusError   = "error"
+	CallStatusDenied  = "denied"
+)
+
+// ToolCall is a finished call of a tool of a managed server
+type ToolCall struct {
+	Server   string
+	Tool     string
+	Identity *Identity
+	// Session is the id of the client session, Client is the client of its initialize request
+	Session   string
+	Client    mcp.Implementation
+	Arguments map[string]any
+	Result    *mcp.CallToolResult
+	Err       error
+	// Status is success, error, including a result flagged as an error, or denied by the scope or the policies
+	Status   string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// CallObserver is told about every tool call of the servers of a registry, e.g. to audit them,
+// it's called synchronously after the call so it must not block
+type CallObserver interface {
+	ToolCalled(ctx context.Context, call ToolCall)
+}
+
+type CallObserverFunc func(ctx context.Context, call ToolCall)
+
+func (f CallObserverFunc) ToolCalled(ctx context.Context, call ToolCall) {
+	f(ctx, call)
+}
+
+// AddCallObserver adds an observer of the tool calls of the servers
+func (r *Registry) AddCallObserver(observer CallObserver) {
+	r.observersMu.Lock()
+	defer r.observersMu.Unlock()
+	r.observers = append(r.observers, observer)
+}
+
+func (r *Registry) observeCall(ctx context.Context, call ToolCall) {
+	r.observersMu.RLock()
+	observers := r.observers
+	r.observersMu.RUnlock()
+	for _, observer := range observers {
+		observer.ToolCalled(ctx, call)
+	}
+}
+
+// callSession is the client session of the call and the client it was initialized by
+func callSession(ctx context.Context) (string, mcp.Implementation) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return "", mcp.Implementation{}
+	}
+	var client mcp.Implementation
+	if withClientInfo, ok := session.(server.SessionWithClientInfo); ok {
+		client = withClientInfo.GetClientInfo()
+	}
+	return session.SessionID(), client
+}
+
+// callStatus classifies the outcome of a call
+func callStatus(result *mcp.CallToolResult, err error) string {
+	switch {
+	case errors.Is(err, ErrNotInScope), errors.Is(err, ErrCallDenied), errors.Is(err, ErrApprovalRequired),
+		errors.Is(err, ErrCallRejected), errors.Is(err, ErrApprovalExpired):
+		return CallStatusDenied
+	case err != nil, result != nil && result.IsError:
+		return CallStatusError
+	default:
+		return CallStatusSuccess
+	}
+}
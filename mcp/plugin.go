@@ -1,8 +1,212 @@
 package mcp
 
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/jyz0309/omcp/artifact"
+)
+
+const (
+	PluginTypeTool     = "tool"
+	PluginTypeResource = "resource"
+)
+
 type Plugin struct {
 	MCPType    string `json:"mcp_type"`
 	Name       string `json:"name"`
 	VarName    string `json:"var_name"`
 	PluginFile string `json:"plugin_file"`
+	// Digest is the SHA-256 of the plugin file, the file is checked against it before it's opened
+	Digest string `json:"digest,omitempty"`
+	// Signer is the id of the trusted key which signed the plugin file, empty if it's unsigned
+	Signer string `json:"signer,omitempty"`
+}
+
+// CheckPlugin checks the stored artifact of the plugin digest against its content and the policy,
+// and points the plugin at the artifact
+func CheckPlugin(plugin *Plugin, plugins *artifact.Store, policy artifact.Policy) error {
+	if plugin.Digest == "" {
+		// the plugins stored before the artifacts were content addressed have no digest
+		if !policy.AllowUnsigned {
+			return fmt.Errorf("plugin %s: %w", plugin.Name, artifact.ErrUnsigned)
+		}
+		return nil
+	}
+	digest, err := artifact.ParseDigest(plugin.Digest)
+	if err != nil {
+		return err
+	}
+	if err := plugins.Verify(digest); err != nil {
+		return err
+	}
+	sig, err := plugins.Signature(digest)
+	if err != nil {
+		return err
+	}
+	signer, err := policy.Check(digest, sig)
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", plugin.Name, err)
+	}
+	plugin.Digest = digest
+	plugin.Signer = signer
+	plugin.PluginFile = plugins.Path(digest)
+	return nil
+}
+
+// DropPlugins drops the tools and resources of the persisted server whose plugins the check rejects,
+// before the server is restored, every dropped item is told to dropped
+func (s *MCPServer) DropPlugins(check func(*Plugin) error, dropped func(item string, err error)) {
+	tools := s.Tools[:0]
+	for _, tool := range s.Tools {
+		if tool.Plugin != nil {
+			if err := check(tool.Plugin); err != nil {
+				dropped("tool "+tool.Name, err)
+				continue
+			}
+		}
+		tools = append(tools, tool)
+	}
+	s.Tools = tools
+
+	resources := s.Resources[:0]
+	for _, resource := range s.Resources {
+		if resource.Plugin != nil {
+			if err := check(resource.Plugin); err != nil {
+				dropped("resource "+resource.URI, err)
+				continue
+			}
+		}
+		resources = append(resources, resource)
+	}
+	s.Resources = resources
+}
+
+// ToolProvider is the interface the exported symbol of a tool plugin implements
+type ToolProvider interface {
+	Tools() []MCPTool
+}
+
+// ResourceProvider is the interface the exported symbol of a resource plugin implements
+type ResourceProvider interface {
+	Resources() []MCPResource
+}
+
+// lookup checks the digest of the plugin file, opens it and resolves the exported symbol,
+// the go runtime caches the opened plugins, so opening a file twice is cheap
+func (p Plugin) lookup() (plugin.Symbol, error) {
+	if p.VarName == "" {
+		return nil, fmt.Errorf("plugin %s has no var name", p.Name)
+	}
+	if p.Digest != "" {
+		digest, err := artifact.FileDigest(p.PluginFile)
+		if err != nil {
+			return nil, fmt.Errorf("open plugin %s: %w", p.PluginFile, err)
+		}
+		if digest != p.Digest {
+			return nil, fmt.Errorf("plugin %s has digest %s, not %s", p.PluginFile, digest, p.Digest)
+		}
+	}
+	plug, err := plugin.Open(p.PluginFile)
+	if err != nil {
+		return nil, fmt.Errorf("open plugin %s: %w", p.PluginFile, err)
+	}
+	sym, err := plug.Lookup(p.VarName)
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s in plugin %s: %w", p.VarName, p.PluginFile, err)
+	}
+	return sym, nil
+}
+
+// LoadTools resolves the tools provided by the plugin, every tool remembers
+// the plugin, so it can be loaded again when the server is restored
+func (p Plugin) LoadTools() ([]MCPTool, error) {
+	if p.MCPType != PluginTypeTool {
+		return nil, fmt.Errorf("plugin %s is a %s plugin, not a tool plugin", p.Name, p.MCPType)
+	}
+	sym, err := p.lookup()
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := sym.(ToolProvider)
+	if !ok {
+		return nil, fmt.Errorf("symbol %s of plugin %s doesn't implement ToolProvider", p.VarName, p.Name)
+	}
+	tools := provider.Tools()
+	for i := range tools {
+		if tools[i].Handler == nil {
+			return nil, fmt.Errorf("tool %s of plugin %s has no handler", tools[i].Name, p.Name)
+		}
+		plug := p
+		tools[i].Plugin = &plug
+	}
+	return tools, nil
+}
+
+// LoadResources resolves the resources provided by the plugin
+func (p Plugin) LoadResources() ([]MCPResource, error) {
+	if p.MCPType != PluginTypeResource {
+		return nil, fmt.Errorf("plugin %s is a %s plugin, not a resource plugin", p.Name, p.MCPType)
+	}
+	sym, err := p.lookup()
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := sym.(ResourceProvider)
+	if !ok {
+		return nil, fmt.Errorf("symbol %s of plugin %s doesn't implement ResourceProvider", p.VarName, p.Name)
+	}
+	resources := provider.Resources()
+	for i := range resources {
+		plug := p
+		resources[i].Plugin = &plug
+		built, err := resources[i].Build()
+		if err != nil {
+			return nil, fmt.Errorf("resource %s of plugin %s: %w", resources[i].URI, p.Name, err)
+		}
+		resources[i] = built
+	}
+	return resources, nil
+}
+
+// PluginResolver resolves the handler of a persisted tool by loading its plugin again
+func PluginResolver(tool MCPTool) (MCPTool, error) {
+	tools, err := tool.Plugin.LoadTools()
+	if err != nil {
+		return MCPTool{}, err
+	}
+	for _, resolved := range tools {
+		if resolved.Name == tool.Name {
+			if tool.Desc != "" {
+				resolved.Desc = tool.Desc
+			}
+			resolved.CreatedAt = tool.CreatedAt
+			resolved.UpdatedAt = tool.UpdatedAt
+			return resolved, nil
+		}
+	}
+	return MCPTool{}, fmt.Errorf("tool %s not found in plugin %s", tool.Name, tool.Plugin.Name)
+}
+
+// ResolveTool resolves a persisted tool from its plugin or its definition,
+// or from the catalog when it has neither, the secrets it was granted and its approval requirement are kept
+func ResolveTool(tool MCPTool) (MCPTool, error) {
+	var resolved MCPTool
+	var err error
+	switch {
+	case tool.Plugin != nil:
+		resolved, err = PluginResolver(tool)
+	case tool.Definition != nil:
+		resolved, err = tool.Definition.Build(tool.Name, tool.Desc)
+		resolved.CreatedAt = tool.CreatedAt
+		resolved.UpdatedAt = tool.UpdatedAt
+	default:
+		resolved, err = CatalogResolver(tool)
+	}
+	if err != nil {
+		return MCPTool{}, err
+	}
+	resolved.Secrets = MergeSecrets(resolved.Secrets, tool.Secrets)
+	resolved.RequireApproval = resolved.RequireApproval || tool.RequireApproval
+	return resolved, nil
 }
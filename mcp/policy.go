@@ -0,0 +1,300 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jyz0309/omcp/logging"
+
+	"cel.dev/cel-go/cel"
+	"cel.dev/cel-go/ext"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sirupsen/logrus"
+)
+
+type Decision string
+
+const (
+	DecisionAllow           Decision = "allow"
+	DecisionDeny            Decision = "deny"
+	DecisionRequireApproval Decision = "require-approval"
+
+	// policyCostLimit bounds the evaluation of a condition, e.g. a comprehension over a huge argument
+	policyCostLimit = 100000
+)
+
+var (
+	ErrPolicyNotFound   = errors.New("policy not found")
+	ErrPolicyExists     = errors.New("policy already exists")
+	ErrCallDenied       = errors.New("tool call denied")
+	ErrApprovalRequired = errors.New("tool call requires approval")
+)
+
+// policyEnv declares the variables of the conditions:
+//
+//	identity  the caller, identity.subject, identity.issuer, identity.scopes, identity.groups and identity.claims,
+//	          the subject is empty for an anonymous caller
+//	server    the name of the server
+//	tool      the name of the tool
+//	args      the arguments of the call
+//	now       the time of the call, e.g. now.getHours("Europe/Berlin")
+var policyEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("identity", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("server", cel.StringType),
+		cel.Variable("tool", cel.StringType),
+		cel.Variable("args", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("now", cel.TimestampType),
+		ext.Strings(),
+	)
+})
+
+// Policy decides the calls of the tools it matches, the policies of a server are evaluated in order
+// and the first matching one decides, a call no policy matches is allowed
+type Policy struct {
+	Name string `json:"name"`
+	Desc string `json:"desc,omitempty"`
+	// Tools are path.Match patterns of the tool names, all the tools if empty
+	Tools []string `json:"tools,omitempty"`
+	// When is a CEL condition, e.g. !args.path.startsWith("/tmp/"), the policy matches every call if empty
+	When     string   `json:"when,omitempty"`
+	Decision Decision `json:"decision"`
+	// Reason is told to the caller of a denied call
+	Reason string `json:"reason,omitempty"`
+
+	program cel.Program
+}
+
+// Compile validates the policy and compiles its condition
+func (p *Policy) Compile() error {
+	if p.Name == "" {
+		return errors.New("policy name is required")
+	}
+	switch p.Decision {
+	case DecisionAllow, DecisionDeny, DecisionRequireApproval:
+	default:
+		return fmt.Errorf("unknown decision %q of policy %s, allow, deny or require-approval", p.Decision, p.Name)
+	}
+	for _, pattern := range p.Tools {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %q of policy %s: %w", pattern, p.Name, err)
+		}
+	}
+	p.program = nil
+	if p.When == "" {
+		return nil
+	}
+	env, err := policyEnv()
+	if err != nil {
+		return err
+	}
+	ast, issues := env.Compile(p.When)
+	if issues.Err() != nil {
+		return fmt.Errorf("invalid condition of policy %s: %w", p.Name, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType {
+		return fmt.Errorf("invalid condition of policy %s: a bool is required, got %s", p.Name, ast.OutputType())
+	}
+	program, err := env.Program(ast, cel.CostLimit(policyCostLimit))
+	if err != nil {
+		return fmt.Errorf("invalid condition of policy %s: %w", p.Name, err)
+	}
+	p.program = program
+	return nil
+}
+
+// CallInput is what the policies know about a tool call
+type CallInput struct {
+	Identity  *Identity      `json:"identity,omitempty"`
+	Server    string         `json:"server"`
+	Tool      string         `json:"tool"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+	Time      time.Time      `json:"time"`
+}
+
+// PolicyResult is the decision of a call and the policy which made it, empty if no policy matched
+type PolicyResult struct {
+	Decision Decision `json:"decision"`
+	Policy   string   `json:"policy,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// Err is the error of a denied call or a call requiring approval, nil if the call is allowed
+func (r PolicyResult) Err() error {
+	var err error
+	switch r.Decision {
+	case DecisionAllow:
+		return nil
+	case DecisionRequireApproval:
+		err = ErrApprovalRequired
+	default:
+		err = ErrCallDenied
+	}
+	if r.Reason != "" {
+		return fmt.Errorf("%w by policy %s: %s", err, r.Policy, r.Reason)
+	}
+	return fmt.Errorf("%w by policy %s", err, r.Policy)
+}
+
+// matches evaluates the policy against the call
+func (p *Policy) matches(input CallInput, activation map[string]any) (bool, error) {
+	if len(p.Tools) > 0 && !matchAny(p.Tools, input.Tool) {
+		return false, nil
+	}
+	if p.When == "" {
+		return true, nil
+	}
+	if p.program == nil {
+		return false, errors.New("condition doesn't compile")
+	}
+	out, _, err := p.program.Eval(activation)
+	if err != nil {
+		return false, err
+	}
+	matched, _ := out.Value().(bool)
+	return matched, nil
+}
+
+func (i CallInput) activation() map[string]any {
+	identity := map[string]any{
+		"subject": "",
+		"issuer":  "",
+		"scopes":  []string{},
+		"groups":  []string{},
+		"claims":  map[string]any{},
+	}
+	if i.Identity != nil {
+		identity["subject"] = i.Identity.Subject
+		identity["issuer"] = i.Identity.Issuer
+		if i.Identity.Scopes != nil {
+			identity["scopes"] = i.Identity.Scopes
+		}
+		if i.Identity.Groups != nil {
+			identity["groups"] = i.Identity.Groups
+		}
+		if i.Identity.Claims != nil {
+			identity["claims"] = i.Identity.Claims
+		}
+	}
+	args := i.Arguments
+	if args == nil {
+		args = map[string]any{}
+	}
+	return map[string]any{
+		"identity": identity,
+		"server":   i.Server,
+		"tool":     i.Tool,
+		"args":     args,
+		"now":      i.Time,
+	}
+}
+
+// EvaluatePolicies decides the call, the first matching policy decides and the call is allowed if none matches,
+// a condition which fails to evaluate, e.g. on a missing argument, denies the call so the policies fail closed
+func (s *MCPServer) EvaluatePolicies(input CallInput) PolicyResult {
+	s.mu.RLock()
+	policies := slices.Clone(s.Policies)
+	s.mu.RUnlock()
+
+	activation := input.activation()
+	for _, policy := range policies {
+		matched, err := policy.matches(input, activation)
+		if err != nil {
+			return PolicyResult{
+				Decision: DecisionDeny,
+				Policy:   policy.Name,
+				Reason:   fmt.Sprintf("condition failed: %v", err),
+			}
+		}
+		if matched {
+			return PolicyResult{Decision: policy.Decision, Policy: policy.Name, Reason: policy.Reason}
+		}
+	}
+	return PolicyResult{Decision: DecisionAllow}
+}
+
+// authorizeCall evaluates the policies of the server before the tool runs, the decisions are logged,
+// a call requiring approval by a policy or by its tool waits for an operator to decide it
+func (s *MCPServer) authorizeCall(ctx context.Context, tool MCPTool, request mcp.CallToolRequest) error {
+	s.mu.RLock()
+	empty := len(s.Policies) == 0
+	s.mu.RUnlock()
+	result := PolicyResult{Decision: DecisionAllow}
+	if !empty {
+		identity := IdentityFromContext(ctx)
+		result = s.EvaluatePolicies(CallInput{
+			Identity:  identity,
+			Server:    s.Name,
+			Tool:      tool.Name,
+			Arguments: request.GetArguments(),
+			Time:      time.Now(),
+		})
+		subject := ""
+		if identity != nil {
+			subject = identity.Subject
+		}
+		s.contextLogger(ctx).WithFields(logrus.Fields{
+			logging.FieldTool: tool.Name,
+			"subject":         subject,
+			"decision":        result.Decision,
+			"policy":          result.Policy,
+			"reason":          result.Reason,
+		}).Info("tool call policy decision")
+	}
+	if result.Decision == DecisionAllow && tool.RequireApproval {
+		result = PolicyResult{Decision: DecisionRequireApproval, Reason: "the tool requires approval"}
+	}
+	if result.Decision == DecisionRequireApproval {
+		return s.awaitApproval(ctx, tool.Name, request.GetArguments(), result, request.Params.Meta)
+	}
+	return result.Err()
+}
+
+// ListPolicies returns the policies in the order they are evaluated
+func (s *MCPServer) ListPolicies() []Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.Policies)
+}
+
+// AddPolicy compiles the policy and inserts it before the policy named before, or appends it if before is empty
+func (s *MCPServer) AddPolicy(policy Policy, before string) error {
+	if err := policy.Compile(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policyIndex(policy.Name) >= 0 {
+		return fmt.Errorf("%w: %s", ErrPolicyExists, policy.Name)
+	}
+	i := len(s.Policies)
+	if before != "" {
+		if i = s.policyIndex(before); i < 0 {
+			return fmt.Errorf("%w: %s", ErrPolicyNotFound, before)
+		}
+	}
+	s.Policies = slices.Insert(s.Policies, i, policy)
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MCPServer) DeletePolicy(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.policyIndex(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrPolicyNotFound, name)
+	}
+	s.Policies = slices.Delete(s.Policies, i, i+1)
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MCPServer) policyIndex(name string) int {
+	return slices.IndexFunc(s.Policies, func(policy Policy) bool { return policy.Name == name })
+}
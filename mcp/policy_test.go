@@ -0,0 +1,178 @@
+package mcp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicyCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "deny every call", policy: Policy{Name: "p", Decision: DecisionDeny}},
+		{name: "condition", policy: Policy{Name: "p", Decision: DecisionAllow, When: `args.path.startsWith("/tmp/")`}},
+		{name: "tool pattern", policy: Policy{Name: "p", Tools: []string{"fs_*"}, Decision: DecisionRequireApproval}},
+		{name: "missing name", policy: Policy{Decision: DecisionDeny}, wantErr: true},
+		{name: "unknown decision", policy: Policy{Name: "p", Decision: "maybe"}, wantErr: true},
+		{name: "invalid tool pattern", policy: Policy{Name: "p", Tools: []string{"fs_["}, Decision: DecisionDeny}, wantErr: true},
+		{name: "syntax error", policy: Policy{Name: "p", Decision: DecisionDeny, When: `args.path ==`}, wantErr: true},
+		{name: "undeclared variable", policy: Policy{Name: "p", Decision: DecisionDeny, When: `user == "alice"`}, wantErr: true},
+		{name: "condition not a bool", policy: Policy{Name: "p", Decision: DecisionDeny, When: `tool + "x"`}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Compile()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluatePolicies(t *testing.T) {
+	items := make([]any, 1000)
+	for i := range items {
+		items[i] = i
+	}
+	alice := &Identity{Subject: "alice", Groups: []string{"ops"}, Scopes: []string{"tools:call"}}
+
+	tests := []struct {
+		name       string
+		policies   []Policy
+		input      CallInput
+		want       Decision
+		wantPolicy string
+		wantErr    error
+	}{
+		{
+			name:  "no policy",
+			input: CallInput{Tool: "rm"},
+			want:  DecisionAllow,
+		},
+		{
+			name:     "no matching policy",
+			policies: []Policy{{Name: "fs", Tools: []string{"fs_*"}, Decision: DecisionDeny}},
+			input:    CallInput{Tool: "rm"},
+			want:     DecisionAllow,
+		},
+		{
+			name: "first matching policy decides",
+			policies: []Policy{
+				{Name: "ops", When: `"ops" in identity.groups`, Decision: DecisionAllow},
+				{Name: "deny", Decision: DecisionDeny},
+			},
+			input:      CallInput{Identity: alice, Tool: "rm"},
+			want:       DecisionAllow,
+			wantPolicy: "ops",
+		},
+		{
+			name: "later policy decides once the first doesn't match",
+			policies: []Policy{
+				{Name: "ops", When: `"ops" in identity.groups`, Decision: DecisionAllow},
+				{Name: "deny", Decision: DecisionDeny},
+			},
+			input:      CallInput{Tool: "rm"},
+			want:       DecisionDeny,
+			wantPolicy: "deny",
+			wantErr:    ErrCallDenied,
+		},
+		{
+			name:       "tool pattern",
+			policies:   []Policy{{Name: "fs", Tools: []string{"fs_*"}, Decision: DecisionRequireApproval}},
+			input:      CallInput{Tool: "fs_write"},
+			want:       DecisionRequireApproval,
+			wantPolicy: "fs",
+			wantErr:    ErrApprovalRequired,
+		},
+		{
+			name:       "condition on the arguments",
+			policies:   []Policy{{Name: "tmp", When: `!args.path.startsWith("/tmp/")`, Decision: DecisionDeny}},
+			input:      CallInput{Tool: "fs_write", Arguments: map[string]any{"path": "/etc/passwd"}},
+			want:       DecisionDeny,
+			wantPolicy: "tmp",
+			wantErr:    ErrCallDenied,
+		},
+		{
+			name:     "condition on the arguments not matching",
+			policies: []Policy{{Name: "tmp", When: `!args.path.startsWith("/tmp/")`, Decision: DecisionDeny}},
+			input:    CallInput{Tool: "fs_write", Arguments: map[string]any{"path": "/tmp/x"}},
+			want:     DecisionAllow,
+		},
+		{
+			name:       "condition on the server and the time",
+			policies:   []Policy{{Name: "night", When: `server == "prod" && now.getHours("UTC") < 6`, Decision: DecisionDeny}},
+			input:      CallInput{Server: "prod", Tool: "deploy", Time: time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)},
+			want:       DecisionDeny,
+			wantPolicy: "night",
+			wantErr:    ErrCallDenied,
+		},
+		{
+			name:     "anonymous caller",
+			policies: []Policy{{Name: "alice", When: `identity.subject == "alice"`, Decision: DecisionDeny}},
+			input:    CallInput{Tool: "rm"},
+			want:     DecisionAllow,
+		},
+		{
+			// a condition which fails to evaluate must not let the call through
+			name:       "missing argument fails closed",
+			policies:   []Policy{{Name: "tmp", When: `args.path.startsWith("/tmp/")`, Decision: DecisionAllow}},
+			input:      CallInput{Tool: "fs_write"},
+			want:       DecisionDeny,
+			wantPolicy: "tmp",
+			wantErr:    ErrCallDenied,
+		},
+		{
+			name:       "cost limit fails closed",
+			policies:   []Policy{{Name: "slow", When: `args.items.all(x, args.items.all(y, x == y || true))`, Decision: DecisionAllow}},
+			input:      CallInput{Tool: "sum", Arguments: map[string]any{"items": items}},
+			want:       DecisionDeny,
+			wantPolicy: "slow",
+			wantErr:    ErrCallDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &MCPServer{}
+			for _, policy := range tt.policies {
+				if err := server.AddPolicy(policy, ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result := server.EvaluatePolicies(tt.input)
+			if result.Decision != tt.want || result.Policy != tt.wantPolicy {
+				t.Fatalf("EvaluatePolicies() = %s by %q (%s), want %s by %q", result.Decision, result.Policy, result.Reason, tt.want, tt.wantPolicy)
+			}
+			if err := result.Err(); !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("Err() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddPolicyOrder(t *testing.T) {
+	server := &MCPServer{}
+	for _, policy := range []Policy{{Name: "a", Decision: DecisionAllow}, {Name: "c", Decision: DecisionDeny}} {
+		if err := server.AddPolicy(policy, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := server.AddPolicy(Policy{Name: "b", Decision: DecisionDeny}, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddPolicy(Policy{Name: "a", Decision: DecisionDeny}, ""); !errors.Is(err, ErrPolicyExists) {
+		t.Fatalf("AddPolicy() of a duplicate error = %v, want %v", err, ErrPolicyExists)
+	}
+	if err := server.AddPolicy(Policy{Name: "d", Decision: DecisionDeny}, "x"); !errors.Is(err, ErrPolicyNotFound) {
+		t.Fatalf("AddPolicy() before a missing policy error = %v, want %v", err, ErrPolicyNotFound)
+	}
+	var names string
+	for _, policy := range server.ListPolicies() {
+		names += policy.Name
+	}
+	if names != "abc" {
+		t.Fatalf("ListPolicies() = %s, want abc", names)
+	}
+}
@@ -0,0 +1,116 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var (
+	ErrPromptNotFound = errors.New("prompt not found")
+	ErrPromptExists   = errors.New("prompt already exists")
+)
+
+type PromptArgument struct {
+	Name     string `json:"name"`
+	Desc     string `json:"desc"`
+	Required bool   `json:"required"`
+}
+
+// PromptMessage is a message of the prompt, the content is a go template
+// rendered with the arguments of the prompt
+type PromptMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type PromptHandler func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error)
+
+// MCPPrompt is a prompt template exposed to the clients by prompts/list and prompts/get,
+// the messages are rendered from the templates, or by the handler for the mounted prompts
+type MCPPrompt struct {
+	Name      string           `json:"name"`
+	Desc      string           `json:"desc"`
+	Arguments []PromptArgument `json:"arguments"`
+	Messages  []PromptMessage  `json:"messages"`
+	// Mount is the upstream the prompt is mounted from, the mounted prompts are not restored
+	Mount     string    `json:"mount,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Handler   PromptHandler `json:"-"`
+	templates []*template.Template
+}
+
+// Build validates the prompt and parses the templates of the messages
+func (p MCPPrompt) Build() (MCPPrompt, error) {
+	if p.Name == "" {
+		return p, errors.New("prompt name is required")
+	}
+	if len(p.Messages) == 0 {
+		return p, fmt.Errorf("prompt %s has no message", p.Name)
+	}
+	p.templates = make([]*template.Template, 0, len(p.Messages))
+	for i, message := range p.Messages {
+		if message.Role != string(mcp.RoleUser) && message.Role != string(mcp.RoleAssistant) {
+			return p, fmt.Errorf("message %d of prompt %s has invalid role %s", i, p.Name, message.Role)
+		}
+		tmpl, err := template.New(fmt.Sprintf("%s-%d", p.Name, i)).Option("missingkey=zero").Parse(message.Content)
+		if err != nil {
+			return p, fmt.Errorf("invalid template of message %d of prompt %s: %w", i, p.Name, err)
+		}
+		p.templates = append(p.templates, tmpl)
+	}
+	return p, nil
+}
+
+// RenderMessages renders the messages with the arguments, the prompt must have been built
+func (p *MCPPrompt) RenderMessages(args map[string]string) ([]PromptMessage, error) {
+	for _, arg := range p.Arguments {
+		if arg.Required && args[arg.Name] == "" {
+			return nil, fmt.Errorf("argument %s of prompt %s is required", arg.Name, p.Name)
+		}
+	}
+	messages := make([]PromptMessage, 0, len(p.templates))
+	for i, tmpl := range p.templates {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, args); err != nil {
+			return nil, fmt.Errorf("render message %d of prompt %s: %w", i, p.Name, err)
+		}
+		messages = append(messages, PromptMessage{Role: p.Messages[i].Role, Content: buf.String()})
+	}
+	return messages, nil
+}
+
+// Render renders the prompt as the result of prompts/get
+func (p *MCPPrompt) Render(args map[string]string) (*mcp.GetPromptResult, error) {
+	messages, err := p.RenderMessages(args)
+	if err != nil {
+		return nil, err
+	}
+	result := &mcp.GetPromptResult{
+		Description: p.Desc,
+		Messages:    make([]mcp.PromptMessage, 0, len(messages)),
+	}
+	for _, message := range messages {
+		result.Messages = append(result.Messages, mcp.NewPromptMessage(mcp.Role(message.Role), mcp.NewTextContent(message.Content)))
+	}
+	return result, nil
+}
+
+func (p *MCPPrompt) mcpPrompt() mcp.Prompt {
+	opts := []mcp.PromptOption{mcp.WithPromptDescription(p.Desc)}
+	for _, arg := range p.Arguments {
+		argOpts := []mcp.ArgumentOption{mcp.ArgumentDescription(arg.Desc)}
+		if arg.Required {
+			argOpts = append(argOpts, mcp.RequiredArgument())
+		}
+		opts = append(opts, mcp.WithArgument(arg.Name, argOpts...))
+	}
+	return mcp.NewPrompt(p.Name, opts...)
+}
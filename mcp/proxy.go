@@ -0,0 +1,501 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jyz0309/omcp/tracing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// UpstreamStdio launches the upstream as a subprocess speaking over stdin and stdout
+	UpstreamStdio = "stdio"
+	// UpstreamSSE connects to a remote upstream over SSE
+	UpstreamSSE = "sse"
+	// UpstreamStreamableHTTP connects to a remote upstream over streamable http
+	UpstreamStreamableHTTP = "streamable-http"
+
+	// upstreamMount is the mount of the items served from the upstream of a proxied server
+	upstreamMount = "upstream"
+
+	upstreamPingInterval    = 15 * time.Second
+	upstreamRequestTimeout  = 10 * time.Second
+	upstreamRestartBackoff  = time.Second
+	upstreamMaxBackoff      = 30 * time.Second
+	upstreamHealthyDuration = time.Minute
+)
+
+var ErrUpstreamNotConnected = errors.New("upstream is not connected")
+
+// Upstream is an external MCP server proxied by a managed server, the values of its env
+// and headers can reference the secrets, e.g. Bearer ${secret:github}
+type Upstream struct {
+	Type    string            `json:"type"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// UpstreamStatus is the connection status of the upstream of a proxied server
+type UpstreamStatus struct {
+	Connected   bool      `json:"connected"`
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"last_error,omitempty"`
+	ConnectedAt time.Time `json:"connected_at,omitempty"`
+}
+
+func (u *Upstream) Validate() error {
+	switch u.Type {
+	case UpstreamStdio:
+		if u.Command == "" {
+			return errors.New("command of the stdio upstream is required")
+		}
+	case UpstreamSSE, UpstreamStreamableHTTP:
+		if u.URL == "" {
+			return fmt.Errorf("url of the %s upstream is required", u.Type)
+		}
+		if _, err := url.ParseRequestURI(u.URL); err != nil {
+			return fmt.Errorf("invalid url of the upstream: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown upstream type: %s", u.Type)
+	}
+	return nil
+}
+
+// String describes the upstream for the listings
+func (u *Upstream) String() string {
+	if u.Type == UpstreamStdio {
+		return fmt.Sprintf("%s: %s", u.Type, u.Command)
+	}
+	return fmt.Sprintf("%s: %s", u.Type, u.URL)
+}
+
+// connect starts the client of the upstream, the subprocess lives as long as the context
+func (u *Upstream) connect(ctx context.Context) (*client.Client, error) {
+	var t transport.Interface
+	switch u.Type {
+	case UpstreamStdio:
+		env := make([]string, 0, len(u.Env))
+		for name, value := range u.Env {
+			env = append(env, name+"="+value)
+		}
+		sort.Strings(env)
+		t = transport.NewStdio(u.Command, env, u.Args...)
+	case UpstreamSSE:
+		sse, err := transport.NewSSE(u.URL, transport.WithHeaders(u.Headers))
+		if err != nil {
+			return nil, err
+		}
+		t = sse
+	case UpstreamStreamableHTTP:
+		streamable, err := transport.NewStreamableHTTP(u.URL, transport.WithHTTPHeaders(u.Headers))
+		if err != nil {
+			return nil, err
+		}
+		t = streamable
+	default:
+		return nil, fmt.Errorf("unknown upstream type: %s", u.Type)
+	}
+	c := client.NewClient(t)
+	if err := c.Start(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// proxy serves the tools, resources and prompts of the upstream through the server,
+// it keeps the upstream connected and restarts it when it fails
+type proxy struct {
+	server   *MCPServer
+	upstream Upstream
+	logger   *logrus.Entry
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	client *client.Client
+
+	// progress maps the progress tokens sent upstream to the requests of the clients
+	progress      sync.Map
+	progressToken atomic.Int64
+}
+
+type progressRequest struct {
+	ctx   context.Context
+	token mcp.ProgressToken
+}
+
+// startProxy connects the upstream of the server and supervises it, it waits for the first
+// connection if wait is set and fails if it can't be made
+func (s *MCPServer) startProxy(wait bool) error {
+	if s.Upstream == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &proxy{
+		server:   s,
+		upstream: *s.Upstream,
+		logger:   s.Logger(),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	var first chan error
+	if wait {
+		first = make(chan error, 1)
+	}
+	s.mu.Lock()
+	s.proxy = p
+	s.UpstreamStatus = &UpstreamStatus{}
+	s.mu.Unlock()
+	go p.supervise(ctx, first)
+
+	if first != nil {
+		if err := <-first; err != nil {
+			s.stopProxy()
+			return fmt.Errorf("connect upstream of server %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// stopProxy disconnects the upstream and removes its items
+func (s *MCPServer) stopProxy() {
+	s.mu.Lock()
+	p := s.proxy
+	s.proxy = nil
+	s.mu.Unlock()
+	if p == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+	s.Unmount(upstreamMount)
+	s.setUpstreamStatus(func(status *UpstreamStatus) { status.Connected = false })
+}
+
+func (s *MCPServer) setUpstreamStatus(update func(status *UpstreamStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.UpstreamStatus != nil {
+		update(s.UpstreamStatus)
+	}
+}
+
+// supervise keeps the upstream connected until the context is done, the first connection
+// result is sent to first, a failed first connection isn't retried
+func (p *proxy) supervise(ctx context.Context, first chan<- error) {
+	defer close(p.done)
+	backoff := upstreamRestartBackoff
+	for {
+		started := time.Now()
+		err := p.run(ctx, func() {
+			if first != nil {
+				first <- nil
+				first = nil
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if first != nil {
+			first <- err
+			return
+		}
+
+		p.logger.Warnf("upstream failed, restarting in %s: %v", backoff, err)
+		p.server.setUpstreamStatus(func(status *UpstreamStatus) {
+			status.Connected = false
+			status.Restarts++
+			status.LastError = err.Error()
+		})
+		if time.Since(started) > upstreamHealthyDuration {
+			backoff = upstreamRestartBackoff
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, upstreamMaxBackoff)
+	}
+}
+
+// run connects the upstream, mounts its items and watches it until it fails
+func (p *proxy) run(ctx context.Context, connected func()) error {
+	// the secrets are resolved on every connect, so a reconnect picks up the rotated ones
+	upstream, err := p.upstream.resolveSecrets(p.server.secretSource())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c, err := upstream.connect(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	defer func() {
+		// the subprocess is killed with the context, so close doesn't wait for a hung one
+		cancel()
+		c.Close()
+		p.setClient(nil)
+	}()
+
+	exited := make(chan struct{})
+	if stderr, ok := client.GetStderr(c); ok {
+		go func() {
+			defer close(exited)
+			scanner := bufio.NewScanner(stderr)
+			for scanner.Scan() {
+				p.logger.Info(scanner.Text())
+			}
+		}()
+	}
+
+	changed := make(chan struct{}, 1)
+	c.OnNotification(func(notification mcp.JSONRPCNotification) {
+		switch notification.Method {
+		case mcp.MethodNotificationToolsListChanged, mcp.MethodNotificationResourcesListChanged, mcp.MethodNotificationPromptsListChanged:
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		default:
+			p.forward(notification)
+		}
+	})
+
+	initCtx, initCancel := context.WithTimeout(ctx, upstreamRequestTimeout)
+	defer initCancel()
+	request := mcp.InitializeRequest{}
+	request.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	request.Params.ClientInfo = mcp.Implementation{Name: "omcp", Version: "0.0.1"}
+	if _, err := c.Initialize(initCtx, request); err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	p.setClient(c)
+	if err := p.sync(ctx, c); err != nil {
+		return err
+	}
+	p.server.setUpstreamStatus(func(status *UpstreamStatus) {
+		status.Connected = true
+		status.ConnectedAt = time.Now()
+	})
+	p.logger.Infof("upstream connected, %s", p.upstream.String())
+	connected()
+
+	ticker := time.NewTicker(upstreamPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exited:
+			return errors.New("upstream process exited")
+		case <-changed:
+			if err := p.sync(ctx, c); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			pingCtx, pingCancel := context.WithTimeout(ctx, upstreamRequestTimeout)
+			err := c.Ping(pingCtx)
+			pingCancel()
+			if err != nil {
+				return fmt.Errorf("ping: %w", err)
+			}
+			// the streamable http client has no stream for the notifications out of requests
+			if p.upstream.Type == UpstreamStreamableHTTP {
+				if err := p.sync(ctx, c); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// sync mounts the current tools, resources and prompts of the upstream
+func (p *proxy) sync(ctx context.Context, c *client.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, upstreamRequestTimeout)
+	defer cancel()
+	capabilities := c.GetServerCapabilities()
+
+	var tools []MCPTool
+	if capabilities.Tools != nil {
+		result, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+		if err != nil {
+			return fmt.Errorf("list tools: %w", err)
+		}
+		for _, tool := range result.Tools {
+			tools = append(tools, p.tool(tool))
+		}
+	}
+
+	var resources []MCPResource
+	if capabilities.Resources != nil {
+		result, err := c.ListResources(ctx, mcp.ListResourcesRequest{})
+		if err != nil {
+			return fmt.Errorf("list resources: %w", err)
+		}
+		for _, resource := range result.Resources {
+			resources = append(resources, MCPResource{
+				Name:     resource.Name,
+				Desc:     resource.Description,
+				URI:      resource.URI,
+				MimeType: resource.MIMEType,
+				Handler:  p.readResource,
+			})
+		}
+		templates, err := c.ListResourceTemplates(ctx, mcp.ListResourceTemplatesRequest{})
+		if err != nil {
+			return fmt.Errorf("list resource templates: %w", err)
+		}
+		for _, template := range templates.ResourceTemplates {
+			resources = append(resources, MCPResource{
+				Name:     template.Name,
+				Desc:     template.Description,
+				URI:      template.URITemplate.Raw(),
+				MimeType: template.MIMEType,
+				Handler:  p.readResource,
+			})
+		}
+	}
+
+	var prompts []MCPPrompt
+	if capabilities.Prompts != nil {
+		result, err := c.ListPrompts(ctx, mcp.ListPromptsRequest{})
+		if err != nil {
+			return fmt.Errorf("list prompts: %w", err)
+		}
+		for _, prompt := range result.Prompts {
+			arguments := make([]PromptArgument, 0, len(prompt.Arguments))
+			for _, arg := range prompt.Arguments {
+				arguments = append(arguments, PromptArgument{Name: arg.Name, Desc: arg.Description, Required: arg.Required})
+			}
+			prompts = append(prompts, MCPPrompt{
+				Name:      prompt.Name,
+				Desc:      prompt.Description,
+				Arguments: arguments,
+				Handler:   p.getPrompt,
+			})
+		}
+	}
+
+	if conflicts := p.server.Mount(upstreamMount, tools, resources, prompts); len(conflicts) > 0 {
+		p.logger.Warnf("upstream items shadowed by the local ones: %v", conflicts)
+	}
+	return nil
+}
+
+// tool mirrors an upstream tool, the schema is kept as is
+func (p *proxy) tool(upstream mcp.Tool) MCPTool {
+	return MCPTool{
+		Name: upstream.Name,
+		Desc: upstream.Description,
+		Option: []mcp.ToolOption{func(tool *mcp.Tool) {
+			tool.InputSchema = upstream.InputSchema
+			tool.RawInputSchema = upstream.RawInputSchema
+			tool.Annotations = upstream.Annotations
+		}},
+		Handler: p.callTool,
+	}
+}
+
+func (p *proxy) setClient(c *client.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.client = c
+}
+
+func (p *proxy) getClient() (*client.Client, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.client == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUpstreamNotConnected, p.server.Name)
+	}
+	return p.client, nil
+}
+
+// callTool forwards the call, the progress token is replaced so the upstream progress
+// notifications can be routed back to the client which made the call, and the trace context is put in the _meta
+func (p *proxy) callTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	c, err := p.getClient()
+	if err != nil {
+		return nil, err
+	}
+	forwarded := mcp.Meta{AdditionalFields: map[string]any{}}
+	if meta := request.Params.Meta; meta != nil {
+		forwarded.ProgressToken = meta.ProgressToken
+		maps.Copy(forwarded.AdditionalFields, meta.AdditionalFields)
+		if meta.ProgressToken != nil {
+			token := fmt.Sprintf("omcp-%d", p.progressToken.Add(1))
+			p.progress.Store(token, progressRequest{ctx: ctx, token: meta.ProgressToken})
+			defer p.progress.Delete(token)
+			forwarded.ProgressToken = token
+		}
+	}
+	// the upstream continues the trace of the call whatever its transport
+	tracing.InjectMeta(ctx, forwarded.AdditionalFields)
+	if forwarded.ProgressToken != nil || len(forwarded.AdditionalFields) > 0 {
+		request.Params.Meta = &forwarded
+	}
+	return c.CallTool(ctx, request)
+}
+
+func (p *proxy) readResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	c, err := p.getClient()
+	if err != nil {
+		return nil, err
+	}
+	forwarded := mcp.ReadResourceRequest{}
+	forwarded.Params.URI = request.Params.URI
+	result, err := c.ReadResource(ctx, forwarded)
+	if err != nil {
+		return nil, err
+	}
+	return result.Contents, nil
+}
+
+func (p *proxy) getPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	c, err := p.getClient()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetPrompt(ctx, request)
+}
+
+// forward relays the upstream notifications, the progress goes to the client of the call
+// and the others to all the clients
+func (p *proxy) forward(notification mcp.JSONRPCNotification) {
+	params := notification.Params.AdditionalFields
+	if notification.Method == "notifications/progress" {
+		value, ok := p.progress.Load(fmt.Sprint(params["progressToken"]))
+		if !ok {
+			return
+		}
+		request := value.(progressRequest)
+		forwarded := make(map[string]any, len(params))
+		for name, value := range params {
+			forwarded[name] = value
+		}
+		forwarded["progressToken"] = request.token
+		p.server.baseServer.SendNotificationToClient(request.ctx, notification.Method, forwarded)
+		return
+	}
+	p.server.baseServer.SendNotificationToAllClients(notification.Method, params)
+}
@@ -0,0 +1,240 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/jyz0309/omcp/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrServerNotFound = errors.New("mcp server not found")
+	ErrServerExists   = errors.New("mcp server already exists")
+)
+
+// Persister persists the servers of the registry, it's called after every change
+type Persister interface {
+	SaveServer(server *MCPServer) error
+	DeleteServer(name string) error
+}
+
+// Registry owns the managed MCP servers and drives their lifecycle,
+// it's safe to be used from multiple goroutines
+type Registry struct {
+	mu      sync.RWMutex
+	servers map[string]*MCPServer
+
+	// persistMu serializes the writes, so the last write always carries the latest state
+	persistMu sync.Mutex
+	persister Persister
+
+	// watchMu guards the running gateways, it's taken under the lock of a changing server
+	watchMu  sync.Mutex
+	gateways []*aggregator
+
+	observersMu sync.RWMutex
+	observers   []CallObserver
+
+	// secrets resolves the secrets of the tools and the upstreams, guarded by mu
+	secrets SecretSource
+	// approvals hold the calls requiring approval, guarded by mu
+	approvals *Approvals
+
+	// logBuffers are the log buffers of the servers by name, read by the log hook without the lock
+	// since the servers log under it
+	logBuffers sync.Map
+}
+
+// NewRegistry creates a registry, the persister can be nil to keep the servers in memory only
+func NewRegistry(persister Persister) *Registry {
+	return &Registry{
+		servers:   make(map[string]*MCPServer),
+		persister: persister,
+	}
+}
+
+func (r *Registry) Get(name string) (*MCPServer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	server, ok := r.servers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	return server, nil
+}
+
+// List returns the servers sorted by name
+func (r *Registry) List() []*MCPServer {
+	r.mu.RLock()
+	servers := make([]*MCPServer, 0, len(r.servers))
+	for _, server := range r.servers {
+		servers = append(servers, server)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers
+}
+
+// Add registers an existing server without persisting it, e.g. a restored one,
+// it replaces the server of the same name, the members of a running gateway are mounted
+func (r *Registry) Add(server *MCPServer) error {
+	r.mu.Lock()
+	server.mu.Lock()
+	server.registry = r
+	server.mu.Unlock()
+	if server.GetState() == McpServerStateCreating {
+		if err := server.setState(McpServerStateStopped); err != nil {
+			r.mu.Unlock()
+			return err
+		}
+	}
+	if old, ok := r.servers[server.Name]; ok && old != server {
+		old.logs.Close()
+	}
+	r.servers[server.Name] = server
+	r.logBuffers.Store(server.Name, server.logs)
+	r.mu.Unlock()
+
+	if server.IsRunning() {
+		server.startGateway()
+	}
+	r.notify(server.Name)
+	return nil
+}
+
+// Create creates a stopped server configured by the options, the name is reserved while the server is creating
+func (r *Registry) Create(name, desc, version string, opts ...ServerOption) (*MCPServer, error) {
+	server := NewMcpSSEServer(name, desc, version)
+	for _, opt := range opts {
+		if err := opt(server); err != nil {
+			return nil, err
+		}
+	}
+	server.registry = r
+
+	r.mu.Lock()
+	if _, exist := r.servers[name]; exist {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrServerExists, name)
+	}
+	r.servers[name] = server
+	r.logBuffers.Store(name, server.logs)
+	r.mu.Unlock()
+
+	err := server.setState(McpServerStateStopped)
+	if err == nil {
+		err = r.Save(server)
+	}
+	if err != nil {
+		r.mu.Lock()
+		delete(r.servers, name)
+		r.logBuffers.Delete(name)
+		r.mu.Unlock()
+		return nil, err
+	}
+	return server, nil
+}
+
+// Delete stops the server if it's running and deletes it
+func (r *Registry) Delete(name string) error {
+	server, err := r.Get(name)
+	if err != nil {
+		return err
+	}
+	if server.GetState() == McpServerStateRunning {
+		if err := server.Stop(); err != nil {
+			return err
+		}
+	}
+	if err := server.setState(McpServerStateDeleted); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	// the name may have been taken by a new server after the old one was deleted
+	if r.servers[name] == server {
+		delete(r.servers, name)
+		r.logBuffers.Delete(name)
+		metrics.ForgetServer(name)
+	}
+	r.mu.Unlock()
+	server.logs.Close()
+
+	if r.persister == nil {
+		return nil
+	}
+	r.persistMu.Lock()
+	defer r.persistMu.Unlock()
+	return r.persister.DeleteServer(name)
+}
+
+func (r *Registry) Start(name string) (*MCPServer, error) {
+	server, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+	return server, r.Save(server)
+}
+
+func (r *Registry) Stop(name string) (*MCPServer, error) {
+	server, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.Stop(); err != nil {
+		return nil, err
+	}
+	return server, r.Save(server)
+}
+
+// Save persists the current state of the server
+func (r *Registry) Save(server *MCPServer) error {
+	if r.persister == nil {
+		return nil
+	}
+	r.persistMu.Lock()
+	defer r.persistMu.Unlock()
+	// a deleted server must not be written back by a late save
+	if server.GetState() == McpServerStateDeleted {
+		return nil
+	}
+	return r.persister.SaveServer(server)
+}
+
+// LogHook copies the log lines of the servers to their log buffers once it's added to the logger they log with
+func (r *Registry) LogHook() logrus.Hook {
+	return logHook{buffers: &r.logBuffers}
+}
+
+// watch notifies the gateway of the changes of its members
+func (r *Registry) watch(gateway *aggregator) {
+	r.watchMu.Lock()
+	defer r.watchMu.Unlock()
+	r.gateways = append(r.gateways, gateway)
+}
+
+func (r *Registry) unwatch(gateway *aggregator) {
+	r.watchMu.Lock()
+	defer r.watchMu.Unlock()
+	r.gateways = slices.DeleteFunc(r.gateways, func(g *aggregator) bool { return g == gateway })
+}
+
+// notify tells the gateways the server is a member of that it changed, it never blocks
+func (r *Registry) notify(name string) {
+	r.watchMu.Lock()
+	defer r.watchMu.Unlock()
+	for _, gateway := range r.gateways {
+		if slices.Contains(gateway.gateway.Members, name) {
+			gateway.notify()
+		}
+	}
+}
@@ -1,11 +1,303 @@
 package mcp
 
-import "time"
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var (
+	ErrResourceNotFound = errors.New("resource not found")
+	ErrResourceExists   = errors.New("resource already exists")
+)
+
+const (
+	// ResourceSourceText serves a static text
+	ResourceSourceText = "text"
+	// ResourceSourceFile serves a local file
+	ResourceSourceFile = "file"
+	// ResourceSourceDir serves the index of a local directory tree at the uri,
+	// and every file of the tree at uri/{+path}
+	ResourceSourceDir = "dir"
+	// ResourceSourceTemplate serves a go template rendered with the parameters of the uri template
+	ResourceSourceTemplate = "template"
+)
+
+// ResourceSource is where the content of a resource comes from
+type ResourceSource struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// ReadsHost reports whether the source serves the files of the host
+func (s *ResourceSource) ReadsHost() bool {
+	return s.Type == ResourceSourceFile || s.Type == ResourceSourceDir
+}
+
+type ResourceHandler func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error)
+
+// MCPResource is a read only context exposed to the clients by resources/list and resources/read,
+// the content comes from the source, or from the handler for the resources loaded from plugins
 type MCPResource struct {
-	Name      string    `json:"name"`
-	Desc      string    `json:"desc"`
-	Version   string    `json:"version"`
+	Name    string `json:"name"`
+	Desc    string `json:"desc"`
+	Version string `json:"version"`
+	// URI is the uri of the resource, or the uri template if it contains parameters
+	URI      string          `json:"uri"`
+	MimeType string          `json:"mime_type,omitempty"`
+	Source   *ResourceSource `json:"source,omitempty"`
+	Plugin   *Plugin         `json:"plugin,omitempty"`
+	// Mount is the upstream or the gateway member the resource is mounted from, the mounted resources are not restored
+	Mount     string    `json:"mount,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	Handler ResourceHandler `json:"-"`
+}
+
+// IsTemplate reports whether the uri is a RFC 6570 uri template
+func (r *MCPResource) IsTemplate() bool {
+	return strings.Contains(r.URI, "{")
+}
+
+// templateURI is the uri template registered on the base server, if any
+func (r *MCPResource) templateURI() string {
+	if r.Source != nil && r.Source.Type == ResourceSourceDir {
+		return strings.TrimSuffix(r.URI, "/") + "/{+path}"
+	}
+	if r.IsTemplate() {
+		return r.URI
+	}
+	return ""
+}
+
+// Build validates the source and builds the handler of the resource
+func (r MCPResource) Build() (MCPResource, error) {
+	if r.URI == "" {
+		return r, errors.New("resource uri is required")
+	}
+	if r.Source == nil {
+		if r.Handler == nil {
+			return r, fmt.Errorf("resource %s has neither source nor handler", r.URI)
+		}
+		return r, nil
+	}
+
+	if r.Source.Path != "" {
+		// the relative paths would change their meaning with the working dir
+		path, err := filepath.Abs(r.Source.Path)
+		if err != nil {
+			return r, err
+		}
+		source := *r.Source
+		source.Path = path
+		r.Source = &source
+	}
+
+	switch r.Source.Type {
+	case ResourceSourceText:
+		if r.MimeType == "" {
+			r.MimeType = "text/plain"
+		}
+		r.Handler = textHandler(r.MimeType, r.Source.Text)
+	case ResourceSourceFile:
+		info, err := os.Stat(r.Source.Path)
+		if err != nil {
+			return r, err
+		} else if info.IsDir() {
+			return r, fmt.Errorf("%s is a directory", r.Source.Path)
+		}
+		r.Handler = fileHandler(r.Source.Path, r.MimeType)
+		if r.MimeType == "" {
+			r.MimeType = DetectMimeType(r.Source.Path, nil)
+		}
+	case ResourceSourceDir:
+		info, err := os.Stat(r.Source.Path)
+		if err != nil {
+			return r, err
+		} else if !info.IsDir() {
+			return r, fmt.Errorf("%s is not a directory", r.Source.Path)
+		}
+		r.MimeType = "text/plain"
+		r.Handler = dirHandler(r.Source.Path)
+	case ResourceSourceTemplate:
+		if !r.IsTemplate() {
+			return r, fmt.Errorf("uri %s of a template resource has no parameters", r.URI)
+		}
+		tmpl, err := template.New(r.URI).Option("missingkey=zero").Parse(r.Source.Text)
+		if err != nil {
+			return r, fmt.Errorf("invalid template of resource %s: %w", r.URI, err)
+		}
+		if r.MimeType == "" {
+			r.MimeType = "text/plain"
+		}
+		r.Handler = templateHandler(tmpl, r.MimeType)
+	default:
+		return r, fmt.Errorf("unknown resource source: %s", r.Source.Type)
+	}
+	return r, nil
+}
+
+// ResolveResource resolves the handler of a persisted resource from its plugin or its source
+func ResolveResource(resource MCPResource) (MCPResource, error) {
+	if resource.Plugin == nil {
+		return resource.Build()
+	}
+	resources, err := resource.Plugin.LoadResources()
+	if err != nil {
+		return MCPResource{}, err
+	}
+	for _, resolved := range resources {
+		if resolved.URI == resource.URI {
+			resolved.CreatedAt = resource.CreatedAt
+			resolved.UpdatedAt = resource.UpdatedAt
+			return resolved.Build()
+		}
+	}
+	return MCPResource{}, fmt.Errorf("resource %s not found in plugin %s", resource.URI, resource.Plugin.Name)
+}
+
+// DetectMimeType detects the mime type by the extension of the file,
+// and falls back to sniff the content
+func DetectMimeType(path string, content []byte) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		return mimeType
+	}
+	if content == nil {
+		f, err := os.Open(path)
+		if err != nil {
+			return "application/octet-stream"
+		}
+		defer f.Close()
+		buf := make([]byte, 512)
+		n, _ := f.Read(buf)
+		content = buf[:n]
+	}
+	return http.DetectContentType(content)
+}
+
+func isText(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.HasPrefix(mimeType, "text/") ||
+		strings.HasSuffix(mimeType, "json") ||
+		strings.HasSuffix(mimeType, "xml") ||
+		strings.HasSuffix(mimeType, "yaml") ||
+		mimeType == "application/javascript"
+}
+
+// fileContents reads the file as a text content, or as a blob content for the binary files
+func fileContents(uri, path, mimeType string) ([]mcp.ResourceContents, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if mimeType == "" {
+		mimeType = DetectMimeType(path, data)
+	}
+	if isText(mimeType) {
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: mimeType, Text: string(data)}}, nil
+	}
+	return []mcp.ResourceContents{mcp.BlobResourceContents{URI: uri, MIMEType: mimeType, Blob: base64.StdEncoding.EncodeToString(data)}}, nil
+}
+
+func textHandler(mimeType, text string) ResourceHandler {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: request.Params.URI, MIMEType: mimeType, Text: text}}, nil
+	}
+}
+
+func fileHandler(path, mimeType string) ResourceHandler {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		return fileContents(request.Params.URI, path, mimeType)
+	}
+}
+
+// dirHandler serves the index of the tree when there is no path parameter,
+// and the file at the path otherwise
+func dirHandler(root string) ResourceHandler {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		path := templateArgs(request.Params.Arguments)["path"]
+		if path == "" {
+			var index strings.Builder
+			err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(root, p)
+				if err != nil {
+					return err
+				}
+				index.WriteString(filepath.ToSlash(rel) + "\n")
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			return []mcp.ResourceContents{mcp.TextResourceContents{URI: request.Params.URI, MIMEType: "text/plain", Text: index.String()}}, nil
+		}
+
+		full, ok := resolveWithin(root, filepath.Join(root, filepath.FromSlash(path)))
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrResourceNotFound, request.Params.URI)
+		}
+		return fileContents(request.Params.URI, full, "")
+	}
+}
+
+// resolveWithin resolves the symlinks of the path and reports whether it stays inside the root,
+// so neither a .. nor a link inside the root can reach the files outside it
+func resolveWithin(root, path string) (string, bool) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", false
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path, true
+}
+
+func templateHandler(tmpl *template.Template, mimeType string) ResourceHandler {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, templateArgs(request.Params.Arguments)); err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: request.Params.URI, MIMEType: mimeType, Text: buf.String()}}, nil
+	}
+}
+
+// templateArgs flattens the matched variables of the uri template,
+// which are decoded as lists of strings
+func templateArgs(args map[string]any) map[string]string {
+	flat := make(map[string]string, len(args))
+	for name, value := range args {
+		switch v := value.(type) {
+		case string:
+			flat[name] = v
+		case []string:
+			flat[name] = strings.Join(v, ",")
+		default:
+			flat[name] = fmt.Sprint(v)
+		}
+	}
+	return flat
 }
@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/jyz0309/omcp/logging"
+	"github.com/jyz0309/omcp/metrics"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrNotInScope = errors.New("not in the scope of the client")
+
+// ClientScope restricts the tools and resources a client can list and use, the patterns
+// are matched with path.Match and an empty list allows everything
+type ClientScope struct {
+	Tools     []string `json:"tools,omitempty"`
+	Resources []string `json:"resources,omitempty"`
+}
+
+type clientScopeKey struct{}
+
+// WithClientScope restricts the requests handled with the context to the scope
+func WithClientScope(ctx context.Context, scope *ClientScope) context.Context {
+	return context.WithValue(ctx, clientScopeKey{}, scope)
+}
+
+// ClientScopeFromContext returns the scope of the client, nil if the client isn't restricted
+func ClientScopeFromContext(ctx context.Context) *ClientScope {
+	scope, _ := ctx.Value(clientScopeKey{}).(*ClientScope)
+	return scope
+}
+
+// Validate checks the patterns are well formed
+func (s *ClientScope) Validate() error {
+	for _, pattern := range slices.Concat(s.Tools, s.Resources) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid scope pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (s *ClientScope) AllowsTool(name string) bool {
+	return s == nil || matchAny(s.Tools, name)
+}
+
+func (s *ClientScope) AllowsResource(uri string) bool {
+	return s == nil || matchAny(s.Resources, uri)
+}
+
+func matchAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+// guardTool refuses the calls of the clients the tool is out of the scope of, and the calls the policies don't allow,
+// the handler gets the secrets the tool references, the span and the logger of the call in its context,
+// every call is traced, measured, logged and told to the observers of the registry
+func (s *MCPServer) guardTool(tool MCPTool) server.ToolHandlerFunc {
+	name := tool.Name
+	return func(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+		start := time.Now()
+		ctx, span := s.startToolSpan(ctx, name, request.Params.Meta)
+		ctx = logging.WithLogger(ctx, s.contextLogger(ctx).WithField(logging.FieldTool, name))
+		defer func() {
+			status, duration := callStatus(result, err), time.Since(start)
+			endToolSpan(span, status, result, err)
+			metrics.ObserveToolCall(s.Name, name, status, status == CallStatusError, duration)
+			logCall(ctx, status, duration, err)
+			s.mu.RLock()
+			registry := s.registry
+			s.mu.RUnlock()
+			if registry == nil {
+				return
+			}
+			session, client := callSession(ctx)
+			registry.observeCall(ctx, ToolCall{
+				Server:    s.Name,
+				Tool:      name,
+				Identity:  IdentityFromContext(ctx),
+				Session:   session,
+				Client:    client,
+				Arguments: request.GetArguments(),
+				Result:    result,
+				Err:       err,
+				Status:    status,
+				Start:     start,
+				Duration:  duration,
+			})
+		}()
+		if !ClientScopeFromContext(ctx).AllowsTool(name) {
+			return nil, fmt.Errorf("tool %s is %w", name, ErrNotInScope)
+		}
+		if err := s.authorizeCall(ctx, tool, request); err != nil {
+			return nil, err
+		}
+		handlerCtx, err := s.withSecrets(ctx, tool)
+		if err != nil {
+			return nil, err
+		}
+		return tool.Handler(handlerCtx, request)
+	}
+}
+
+// logCall logs the finished call with the logger of ctx, the failed ones as warnings
+func logCall(ctx context.Context, status string, duration time.Duration, err error) {
+	logger := logging.FromContext(ctx).WithFields(logrus.Fields{"status": status, "duration": duration.String()})
+	if err != nil {
+		logger = logger.WithError(err)
+	}
+	if status == CallStatusSuccess {
+		logger.Info("tool called")
+	} else {
+		logger.Warn("tool called")
+	}
+}
+
+// filterTools hides the tools out of the scope of the client from tools/list
+func (s *MCPServer) filterTools(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	scope := ClientScopeFromContext(ctx)
+	return slices.DeleteFunc(tools, func(tool mcp.Tool) bool { return !scope.AllowsTool(tool.Name) })
+}
+
+// filterResources hides the resources out of the scope of the client from resources/list
+func (s *MCPServer) filterResources(ctx context.Context, id any, message *mcp.ListResourcesRequest, result *mcp.ListResourcesResult) {
+	scope := ClientScopeFromContext(ctx)
+	result.Resources = slices.DeleteFunc(result.Resources, func(resource mcp.Resource) bool { return !scope.AllowsResource(resource.URI) })
+}
@@ -0,0 +1,142 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+var (
+	ErrSecretsDisabled = errors.New("secrets are disabled, no master key is configured")
+
+	// secretRef is a reference to a secret in the env and the headers of an upstream, e.g. Bearer ${secret:github}
+	secretRef = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_.-]+)\}`)
+)
+
+// SecretSource resolves the secrets referenced by the tools and the upstreams
+type SecretSource interface {
+	Secret(name string) (string, error)
+}
+
+type secretsKey struct{}
+
+// SecretFromContext returns the value of a secret the running tool references in its secrets,
+// the other secrets are never in the context
+func SecretFromContext(ctx context.Context, name string) (string, bool) {
+	secrets, _ := ctx.Value(secretsKey{}).(map[string]string)
+	value, ok := secrets[name]
+	return value, ok
+}
+
+// SetSecrets resolves the secrets of the tools and the upstreams of the servers from the source
+func (r *Registry) SetSecrets(source SecretSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secrets = source
+}
+
+func (r *Registry) secretSource() SecretSource {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.secrets
+}
+
+func (s *MCPServer) secretSource() SecretSource {
+	s.mu.RLock()
+	registry := s.registry
+	s.mu.RUnlock()
+	return registry.secretSource()
+}
+
+// withSecrets puts the secrets the tool references into the context of its handler
+func (s *MCPServer) withSecrets(ctx context.Context, tool MCPTool) (context.Context, error) {
+	if len(tool.Secrets) == 0 {
+		return ctx, nil
+	}
+	source := s.secretSource()
+	if source == nil {
+		return nil, fmt.Errorf("tool %s references secrets: %w", tool.Name, ErrSecretsDisabled)
+	}
+	secrets := make(map[string]string, len(tool.Secrets))
+	for _, name := range tool.Secrets {
+		value, err := source.Secret(name)
+		if err != nil {
+			return nil, fmt.Errorf("tool %s: %w", tool.Name, err)
+		}
+		secrets[name] = value
+	}
+	return context.WithValue(ctx, secretsKey{}, secrets), nil
+}
+
+// MergeSecrets appends the names which aren't in the secrets yet
+func MergeSecrets(secrets []string, names []string) []string {
+	for _, name := range names {
+		if !slices.Contains(secrets, name) {
+			secrets = append(secrets, name)
+		}
+	}
+	return secrets
+}
+
+// expandSecrets replaces the secret references in the value
+func expandSecrets(value string, source SecretSource) (string, error) {
+	var errs []error
+	expanded := secretRef.ReplaceAllStringFunc(value, func(ref string) string {
+		name := secretRef.FindStringSubmatch(ref)[1]
+		if source == nil {
+			errs = append(errs, ErrSecretsDisabled)
+			return ""
+		}
+		secret, err := source.Secret(name)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return secret
+	})
+	return expanded, errors.Join(errs...)
+}
+
+// resolveSecrets copies the upstream with the secret references of its env and headers replaced,
+// so the persisted and listed upstream only carries the references
+func (u Upstream) resolveSecrets(source SecretSource) (Upstream, error) {
+	resolve := func(values map[string]string) (map[string]string, error) {
+		if values == nil {
+			return nil, nil
+		}
+		resolved := make(map[string]string, len(values))
+		for name, value := range values {
+			expanded, err := expandSecrets(value, source)
+			if err != nil {
+				return nil, fmt.Errorf("%s of upstream: %w", name, err)
+			}
+			resolved[name] = expanded
+		}
+		return resolved, nil
+	}
+	var err error
+	if u.Env, err = resolve(u.Env); err != nil {
+		return Upstream{}, err
+	}
+	if u.Headers, err = resolve(u.Headers); err != nil {
+		return Upstream{}, err
+	}
+	return u, nil
+}
+
+// SecretRefs are the names of the secrets the env and the headers of the upstream reference
+func (u *Upstream) SecretRefs() []string {
+	var names []string
+	for _, values := range []map[string]string{u.Env, u.Headers} {
+		for _, value := range values {
+			for _, match := range secretRef.FindAllStringSubmatch(value, -1) {
+				names = MergeSecrets(names, match[1:])
+			}
+		}
+	}
+	return names
+}
@@ -1,77 +1,640 @@
 package mcp
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/jyz0309/omcp/logging"
+	"github.com/jyz0309/omcp/metrics"
+
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/sirupsen/logrus"
 )
 
-type McpServerState string
-
 const (
-	McpServerStateRunning McpServerState = "running"
-	McpServerStateStopped McpServerState = "stopped"
+	TransportSSE            = "sse"
+	TransportStreamableHTTP = "streamable-http"
 )
 
+// DefaultTransports are the transports of a server created without a selection
+var DefaultTransports = []string{TransportSSE, TransportStreamableHTTP}
+
+// ValidateTransports checks the transports are known and not empty
+func ValidateTransports(transports []string) error {
+	if len(transports) == 0 {
+		return errors.New("at least one transport is required")
+	}
+	for _, transport := range transports {
+		if transport != TransportSSE && transport != TransportStreamableHTTP {
+			return fmt.Errorf("unknown transport: %s", transport)
+		}
+	}
+	return nil
+}
+
 type MCPServer struct {
+	// mu guards the state, tools and resources, the server is shared between the handlers
+	mu         sync.RWMutex
 	baseServer *server.MCPServer
 	*server.SSEServer
-	Name      string         `json:"name"`
-	Desc      string         `json:"desc"`
-	Version   string         `json:"version"`
-	State     McpServerState `json:"state"`
-	Tools     []MCPTool      `json:"tools"`
-	Resources []MCPResource  `json:"resources"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
+	streamable *StreamableHTTPServer
+	Name       string         `json:"name"`
+	Desc       string         `json:"desc"`
+	Version    string         `json:"version"`
+	State      McpServerState `json:"state"`
+	// Transports are the transports the server is reachable over
+	Transports []string `json:"transports"`
+	// Labels are selected by the scoped role bindings of the admin api
+	Labels map[string]string `json:"labels,omitempty"`
+	// Upstream is set for the servers proxying an external MCP server
+	Upstream       *Upstream       `json:"upstream,omitempty"`
+	UpstreamStatus *UpstreamStatus `json:"upstream_status,omitempty"`
+	proxy          *proxy
+	// Gateway is set for the servers aggregating other managed servers
+	Gateway       *Gateway       `json:"gateway,omitempty"`
+	GatewayStatus *GatewayStatus `json:"gateway_status,omitempty"`
+	aggregator    *aggregator
+	// registry is the registry the server is registered to, the gateways watching the server are notified of its changes
+	registry *Registry
+	// logs keep the latest log lines of the server
+	logs      *LogBuffer
+	Tools     []MCPTool     `json:"tools"`
+	Resources []MCPResource `json:"resources"`
+	Prompts   []MCPPrompt   `json:"prompts"`
+	// Policies decide the tool calls, in order
+	Policies  []Policy  `json:"policies,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func NewMcpSSEServer(name, desc, version string) *MCPServer {
-	mcpServer := server.NewMCPServer(
-		name,
-		version,
-		server.WithToolCapabilities(true),
-		server.WithLogging(),
-	)
-	sseServer := server.NewSSEServer(mcpServer, server.WithBasePath(fmt.Sprintf("/mcp/%s", name)))
-	return &MCPServer{
-		baseServer: mcpServer,
-		SSEServer:  sseServer,
+	s := &MCPServer{
 		Name:       name,
 		Desc:       desc,
 		Version:    version,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
-		State:      McpServerStateStopped,
+		State:      McpServerStateCreating,
+		Transports: slices.Clone(DefaultTransports),
+		logs:       NewLogBuffer(DefaultLogBufferSize),
 	}
+	hooks := &server.Hooks{}
+	hooks.AddAfterListResourceTemplates(s.filterResourceTemplates)
+	hooks.AddAfterListResources(s.filterResources)
+	hooks.AddOnRegisterSession(s.sessionOpened)
+	hooks.AddOnUnregisterSession(s.sessionClosed)
+	hooks.AddOnSuccess(endRequestSpan)
+	hooks.AddOnError(failRequestSpan)
+	s.baseServer = server.NewMCPServer(
+		name,
+		version,
+		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(false, true),
+		server.WithPromptCapabilities(true),
+		server.WithLogging(),
+		server.WithHooks(hooks),
+		server.WithToolFilter(s.filterTools),
+	)
+	s.SSEServer = server.NewSSEServer(s.baseServer, server.WithStaticBasePath(fmt.Sprintf("/mcp/%s", name)))
+	s.streamable = NewStreamableHTTPServer(s.baseServer)
+	return s
 }
 
-func (s *MCPServer) Start() {
-	s.State = McpServerStateRunning
+// ServerOption configures a server before it's created
+type ServerOption func(s *MCPServer) error
+
+// WithTransports selects the transports of the server, the default ones if empty
+func WithTransports(transports []string) ServerOption {
+	return func(s *MCPServer) error {
+		if len(transports) == 0 {
+			return nil
+		}
+		return s.SetTransports(transports)
+	}
 }
 
-func (s *MCPServer) Stop() {
-	s.State = McpServerStateStopped
+// WithUpstream makes the server a proxy of the upstream
+func WithUpstream(upstream *Upstream) ServerOption {
+	return func(s *MCPServer) error {
+		if upstream == nil {
+			return nil
+		}
+		if err := upstream.Validate(); err != nil {
+			return err
+		}
+		if s.Gateway != nil {
+			return errors.New("a gateway can't proxy an upstream")
+		}
+		s.Upstream = upstream
+		return nil
+	}
+}
+
+// WithGateway makes the server a gateway of the member servers
+func WithGateway(gateway *Gateway) ServerOption {
+	return func(s *MCPServer) error {
+		if gateway == nil {
+			return nil
+		}
+		if err := gateway.Validate(s.Name); err != nil {
+			return err
+		}
+		if s.Upstream != nil {
+			return errors.New("a gateway can't proxy an upstream")
+		}
+		s.Gateway = gateway
+		return nil
+	}
+}
+
+// ToolResolver resolves the handler of a persisted tool
+type ToolResolver func(tool MCPTool) (MCPTool, error)
+
+// RestoreMcpServer rebuilds a server from its persisted metadata and re-registers
+// the tools through the resolver, tools that can't be resolved are dropped and reported
+func RestoreMcpServer(saved *MCPServer, resolve ToolResolver) (*MCPServer, error) {
+	s := NewMcpSSEServer(saved.Name, saved.Desc, saved.Version)
+	s.CreatedAt = saved.CreatedAt
+	// the servers persisted before the transports were selectable serve all of them
+	if len(saved.Transports) > 0 {
+		s.Transports = slices.Clone(saved.Transports)
+	}
+	s.Labels = saved.Labels
+	s.Upstream = saved.Upstream
+	s.Gateway = saved.Gateway
+	// a server persisted in the middle of a transition never finished it
+	switch saved.State {
+	case McpServerStateRunning:
+		s.State = McpServerStateRunning
+	default:
+		s.State = McpServerStateStopped
+	}
+
+	var errs []error
+	tools := make([]MCPTool, 0, len(saved.Tools))
+	for _, tool := range saved.Tools {
+		// the mounted items come back from their upstream
+		if tool.Mount != "" {
+			continue
+		}
+		resolved, err := resolve(tool)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore tool %s of server %s: %w", tool.Name, saved.Name, err))
+			continue
+		}
+		tools = append(tools, resolved)
+	}
+	s.AddTools(tools)
+
+	resources := make([]MCPResource, 0, len(saved.Resources))
+	for _, resource := range saved.Resources {
+		if resource.Mount != "" {
+			continue
+		}
+		resolved, err := ResolveResource(resource)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore resource %s of server %s: %w", resource.URI, saved.Name, err))
+			continue
+		}
+		resources = append(resources, resolved)
+	}
+	s.AddResources(resources)
+
+	for _, prompt := range saved.Prompts {
+		if prompt.Mount != "" {
+			continue
+		}
+		built, err := prompt.Build()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore prompt %s of server %s: %w", prompt.Name, saved.Name, err))
+			continue
+		}
+		s.mu.Lock()
+		s.putPrompt(built)
+		s.mu.Unlock()
+	}
+	for _, policy := range saved.Policies {
+		// a policy which doesn't compile is kept, so it fails closed instead of being dropped
+		if err := policy.Compile(); err != nil {
+			errs = append(errs, fmt.Errorf("restore policy %s of server %s: %w", policy.Name, saved.Name, err))
+		}
+		s.Policies = append(s.Policies, policy)
+	}
+	s.UpdatedAt = saved.UpdatedAt
+	// the upstream may be down for now, it's retried in the background,
+	// the members of a gateway are mounted once it's added to a registry
+	if s.State == McpServerStateRunning {
+		s.startProxy(false)
+	}
+	return s, errors.Join(errs...)
+}
+
+// MarshalJSON holds the read lock, so the server can be listed while it changes state
+func (s *MCPServer) MarshalJSON() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	type alias MCPServer
+	return json.Marshal((*alias)(s))
+}
+
+func (s *MCPServer) GetState() McpServerState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.State
+}
+
+func (s *MCPServer) IsRunning() bool {
+	return s.GetState() == McpServerStateRunning
+}
+
+// Start moves the server through starting to running, the upstream of a proxied server
+// is connected meanwhile and the server goes back to stopped if it can't be,
+// the members of a gateway are mounted
+func (s *MCPServer) Start() error {
+	if err := s.setState(McpServerStateStarting); err != nil {
+		return err
+	}
+	if err := s.startProxy(true); err != nil {
+		s.setState(McpServerStateStopped)
+		return err
+	}
+	s.startGateway()
+	return s.setState(McpServerStateRunning)
+}
+
+// Stop moves the server through stopping to stopped, the sessions are closed
+// and the upstream of a proxied server or the members of a gateway are disconnected
+func (s *MCPServer) Stop() error {
+	if err := s.setState(McpServerStateStopping); err != nil {
+		return err
+	}
+	s.streamable.Close()
+	s.stopProxy()
+	s.stopGateway()
+	return s.setState(McpServerStateStopped)
+}
+
+// SetTransports selects the transports the server is reachable over
+func (s *MCPServer) SetTransports(transports []string) error {
+	if err := ValidateTransports(transports); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Transports = slices.Clone(transports)
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// HasTransport reports whether the server is reachable over the transport
+func (s *MCPServer) HasTransport(transport string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Contains(s.Transports, transport)
+}
+
+// ServeStdio serves the server over the stdio transport until the input is closed or the context is done,
+// the errors are logged to stderr since stdout carries the messages
+func (s *MCPServer) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	stdio := server.NewStdioServer(s.baseServer)
+	stdio.SetErrorLogger(log.New(os.Stderr, "", log.LstdFlags))
+	return stdio.Listen(ctx, in, out)
+}
+
+// ServeStreamableHTTP serves the requests of the streamable http transport
+func (s *MCPServer) ServeStreamableHTTP(w http.ResponseWriter, r *http.Request) {
+	s.streamable.ServeHTTP(w, r)
+}
+
+// sessionOpened counts the client sessions, the sessions other than the streamable http ones are sse sessions,
+// the stdio ones are only served by the processes which expose no metrics
+func (s *MCPServer) sessionOpened(ctx context.Context, session server.ClientSession) {
+	transport := sessionTransport(session)
+	metrics.Sessions.WithLabelValues(s.Name, transport).Inc()
+	s.Logger().WithFields(logrus.Fields{logging.FieldSession: session.SessionID(), "transport": transport}).Info("client session connected")
+}
+
+func (s *MCPServer) sessionClosed(ctx context.Context, session server.ClientSession) {
+	transport := sessionTransport(session)
+	metrics.Sessions.WithLabelValues(s.Name, transport).Dec()
+	s.Logger().WithFields(logrus.Fields{logging.FieldSession: session.SessionID(), "transport": transport}).Info("client session disconnected")
+}
+
+func sessionTransport(session server.ClientSession) string {
+	if _, ok := session.(*streamableSession); ok {
+		return TransportStreamableHTTP
+	}
+	return TransportSSE
+}
+
+func (s *MCPServer) setState(to McpServerState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transition(to)
 }
 
 func (s *MCPServer) ListTools() ([]MCPTool, error) {
-	return s.Tools, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.Tools), nil
 }
 
+// AddTools adds the tools to the server, a tool replaces the tool of the same name
 func (s *MCPServer) AddTools(tools []MCPTool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for _, tool := range tools {
-		tool.Option = append(tool.Option, mcp.WithDescription(tool.Desc))
-		s.baseServer.AddTool(mcp.NewTool(tool.Name, tool.Option...), tool.Handler)
+		s.putTool(tool)
 	}
-	s.Tools = append(s.Tools, tools...)
 }
 
-func (s *MCPServer) DeleteTool(name string) {
+// AddTool adds a new tool to the server, it fails if the tool already exists
+func (s *MCPServer) AddTool(tool MCPTool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.toolIndex(tool.Name) >= 0 {
+		return fmt.Errorf("%w: %s", ErrToolExists, tool.Name)
+	}
+	s.putTool(tool)
+	return nil
+}
+
+// UpdateTool replaces the definition of an existing tool in place
+func (s *MCPServer) UpdateTool(tool MCPTool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.toolIndex(tool.Name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrToolNotFound, tool.Name)
+	}
+	if s.Tools[i].Mount != "" {
+		return fmt.Errorf("tool %s is %w", tool.Name, ErrMounted)
+	}
+	tool.CreatedAt = s.Tools[i].CreatedAt
+	tool.UpdatedAt = time.Now()
+	s.putTool(tool)
+	return nil
+}
+
+func (s *MCPServer) GetTool(name string) (MCPTool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.toolIndex(name)
+	if i < 0 {
+		return MCPTool{}, false
+	}
+	return s.Tools[i], true
+}
+
+// DeleteTool removes the tool from the server, the connected clients are notified
+func (s *MCPServer) DeleteTool(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.toolIndex(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+	if s.Tools[i].Mount != "" {
+		return fmt.Errorf("tool %s is %w", name, ErrMounted)
+	}
+	s.Tools = slices.Delete(s.Tools, i, i+1)
+	s.UpdatedAt = time.Now()
 	s.baseServer.DeleteTools(name)
+	s.changed()
+	return nil
+}
+
+// putTool registers the tool on the base server, which notifies the connected clients
+// with notifications/tools/list_changed, the caller must hold s.mu
+func (s *MCPServer) putTool(tool MCPTool) {
+	now := time.Now()
+	if tool.CreatedAt.IsZero() {
+		tool.CreatedAt = now
+		tool.UpdatedAt = now
+	}
+	if i := s.toolIndex(tool.Name); i >= 0 {
+		s.Tools[i] = tool
+	} else {
+		s.Tools = append(s.Tools, tool)
+	}
+	s.UpdatedAt = now
+
+	opts := append(slices.Clone(tool.Option), mcp.WithDescription(tool.Desc))
+	s.baseServer.AddTool(mcp.NewTool(tool.Name, opts...), s.guardTool(tool))
+	s.changed()
+}
+
+func (s *MCPServer) toolIndex(name string) int {
+	return slices.IndexFunc(s.Tools, func(tool MCPTool) bool { return tool.Name == name })
 }
 
+// AddResources adds the built resources to the server, a resource replaces the resource of the same uri
 func (s *MCPServer) AddResources(resources []MCPResource) {
-	s.Resources = append(s.Resources, resources...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, resource := range resources {
+		s.putResource(resource)
+	}
+}
+
+// AddResource adds a new built resource to the server, it fails if the uri is taken
+func (s *MCPServer) AddResource(resource MCPResource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resourceIndex(resource.URI) >= 0 {
+		return fmt.Errorf("%w: %s", ErrResourceExists, resource.URI)
+	}
+	s.putResource(resource)
+	return nil
+}
+
+func (s *MCPServer) ListResources() []MCPResource {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.Resources)
+}
+
+// DeleteResource removes the resource from the server, the connected clients are notified
+func (s *MCPServer) DeleteResource(uri string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.resourceIndex(uri)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrResourceNotFound, uri)
+	}
+	if s.Resources[i].Mount != "" {
+		return fmt.Errorf("resource %s is %w", uri, ErrMounted)
+	}
+	s.removeResource(i)
+	return nil
+}
+
+// removeResource removes the resource at the index, the caller must hold s.mu
+func (s *MCPServer) removeResource(i int) {
+	resource := s.Resources[i]
+	s.Resources = slices.Delete(s.Resources, i, i+1)
+	s.UpdatedAt = time.Now()
+
+	// the base server can't remove a template, it's hidden from resources/templates/list
+	// by filterResourceTemplates and its handler refuses to read
+	if resource.IsTemplate() {
+		s.baseServer.SendNotificationToAllClients(mcp.MethodNotificationResourcesListChanged, nil)
+	} else {
+		s.baseServer.RemoveResource(resource.URI)
+	}
+	s.changed()
+}
+
+// putResource registers the resource on the base server, the caller must hold s.mu
+func (s *MCPServer) putResource(resource MCPResource) {
+	now := time.Now()
+	if resource.CreatedAt.IsZero() {
+		resource.CreatedAt = now
+		resource.UpdatedAt = now
+	}
+	if i := s.resourceIndex(resource.URI); i >= 0 {
+		s.Resources[i] = resource
+	} else {
+		s.Resources = append(s.Resources, resource)
+	}
+	s.UpdatedAt = now
+
+	handler := s.guardResource(resource.URI, resource.Handler)
+	if !resource.IsTemplate() {
+		s.baseServer.AddResource(mcp.NewResource(resource.URI, resource.Name,
+			mcp.WithResourceDescription(resource.Desc),
+			mcp.WithMIMEType(resource.MimeType),
+		), handler)
+	}
+	if uriTemplate := resource.templateURI(); uriTemplate != "" {
+		s.baseServer.AddResourceTemplate(mcp.NewResourceTemplate(uriTemplate, resource.Name,
+			mcp.WithTemplateDescription(resource.Desc),
+			mcp.WithTemplateMIMEType(resource.MimeType),
+		), server.ResourceTemplateHandlerFunc(handler))
+	}
+	s.changed()
+}
+
+// guardResource refuses to read a resource which has been deleted or is out of the scope of the client,
+// a template is in the scope if either its uri or the read uri is
+func (s *MCPServer) guardResource(uri string, handler ResourceHandler) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		s.mu.RLock()
+		exist := s.resourceIndex(uri) >= 0
+		s.mu.RUnlock()
+		if !exist {
+			return nil, fmt.Errorf("%w: %s", ErrResourceNotFound, request.Params.URI)
+		}
+		if scope := ClientScopeFromContext(ctx); !scope.AllowsResource(uri) && !scope.AllowsResource(request.Params.URI) {
+			return nil, fmt.Errorf("resource %s is %w", request.Params.URI, ErrNotInScope)
+		}
+		return handler(ctx, request)
+	}
+}
+
+// filterResourceTemplates hides the templates of the deleted resources and the ones out of the scope of the client
+func (s *MCPServer) filterResourceTemplates(ctx context.Context, id any, message *mcp.ListResourceTemplatesRequest, result *mcp.ListResourceTemplatesResult) {
+	scope := ClientScopeFromContext(ctx)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result.ResourceTemplates = slices.DeleteFunc(result.ResourceTemplates, func(template mcp.ResourceTemplate) bool {
+		i := slices.IndexFunc(s.Resources, func(resource MCPResource) bool {
+			return resource.templateURI() == template.URITemplate.Raw()
+		})
+		return i < 0 || !scope.AllowsResource(s.Resources[i].URI) && !scope.AllowsResource(template.URITemplate.Raw())
+	})
+}
+
+func (s *MCPServer) resourceIndex(uri string) int {
+	return slices.IndexFunc(s.Resources, func(resource MCPResource) bool { return resource.URI == uri })
+}
+
+// AddPrompt adds a new built prompt to the server, it fails if the prompt already exists
+func (s *MCPServer) AddPrompt(prompt MCPPrompt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.promptIndex(prompt.Name) >= 0 {
+		return fmt.Errorf("%w: %s", ErrPromptExists, prompt.Name)
+	}
+	s.putPrompt(prompt)
+	return nil
+}
+
+func (s *MCPServer) GetPrompt(name string) (MCPPrompt, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.promptIndex(name)
+	if i < 0 {
+		return MCPPrompt{}, false
+	}
+	return s.Prompts[i], true
+}
+
+func (s *MCPServer) ListPrompts() []MCPPrompt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.Prompts)
+}
+
+// DeletePrompt removes the prompt from the server, the connected clients are notified
+func (s *MCPServer) DeletePrompt(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.promptIndex(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrPromptNotFound, name)
+	}
+	if s.Prompts[i].Mount != "" {
+		return fmt.Errorf("prompt %s is %w", name, ErrMounted)
+	}
+	s.Prompts = slices.Delete(s.Prompts, i, i+1)
+	s.UpdatedAt = time.Now()
+	s.baseServer.DeletePrompts(name)
+	s.changed()
+	return nil
+}
+
+// putPrompt registers the prompt on the base server, the caller must hold s.mu
+func (s *MCPServer) putPrompt(prompt MCPPrompt) {
+	now := time.Now()
+	if prompt.CreatedAt.IsZero() {
+		prompt.CreatedAt = now
+		prompt.UpdatedAt = now
+	}
+	if i := s.promptIndex(prompt.Name); i >= 0 {
+		s.Prompts[i] = prompt
+	} else {
+		s.Prompts = append(s.Prompts, prompt)
+	}
+	s.UpdatedAt = now
+
+	handler := prompt.Handler
+	if handler == nil {
+		handler = func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return prompt.Render(request.Params.Arguments)
+		}
+	}
+	s.baseServer.AddPrompt(prompt.mcpPrompt(), server.PromptHandlerFunc(handler))
+	s.changed()
+}
+
+// changed notifies the gateways the server is a member of, the caller must hold s.mu
+func (s *MCPServer) changed() {
+	if s.registry != nil {
+		s.registry.notify(s.Name)
+	}
+}
+
+func (s *MCPServer) promptIndex(name string) int {
+	return slices.IndexFunc(s.Prompts, func(prompt MCPPrompt) bool { return prompt.Name == name })
 }
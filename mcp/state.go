@@ -0,0 +1,54 @@
+package mcp
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+type McpServerState string
+
+const (
+	McpServerStateCreating McpServerState = "creating"
+	McpServerStateStopped  McpServerState = "stopped"
+	McpServerStateStarting McpServerState = "starting"
+	McpServerStateRunning  McpServerState = "running"
+	McpServerStateStopping McpServerState = "stopping"
+	McpServerStateDeleted  McpServerState = "deleted"
+)
+
+// stateTransitions lists the states every state is allowed to move to
+var stateTransitions = map[McpServerState][]McpServerState{
+	McpServerStateCreating: {McpServerStateStopped, McpServerStateDeleted},
+	McpServerStateStopped:  {McpServerStateStarting, McpServerStateDeleted},
+	McpServerStateStarting: {McpServerStateRunning, McpServerStateStopped},
+	McpServerStateRunning:  {McpServerStateStopping},
+	McpServerStateStopping: {McpServerStateStopped},
+}
+
+// StateTransitionError is returned when a server is moved to a state
+// which is not reachable from its current state
+type StateTransitionError struct {
+	Server string
+	From   McpServerState
+	To     McpServerState
+}
+
+func (e *StateTransitionError) Error() string {
+	return fmt.Sprintf("mcp server %s can't move from %s to %s", e.Server, e.From, e.To)
+}
+
+func (s McpServerState) CanTransitionTo(to McpServerState) bool {
+	return slices.Contains(stateTransitions[s], to)
+}
+
+// transition moves the server to the state, the caller must hold s.mu
+func (s *MCPServer) transition(to McpServerState) error {
+	if !s.State.CanTransitionTo(to) {
+		return &StateTransitionError{Server: s.Name, From: s.State, To: to}
+	}
+	s.State = to
+	s.UpdatedAt = time.Now()
+	s.changed()
+	return nil
+}
@@ -0,0 +1,134 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStateTransitions(t *testing.T) {
+	states := []McpServerState{
+		McpServerStateCreating,
+		McpServerStateStopped,
+		McpServerStateStarting,
+		McpServerStateRunning,
+		McpServerStateStopping,
+		McpServerStateDeleted,
+	}
+	allowed := map[[2]McpServerState]bool{
+		{McpServerStateCreating, McpServerStateStopped}: true,
+		{McpServerStateCreating, McpServerStateDeleted}: true,
+		{McpServerStateStopped, McpServerStateStarting}: true,
+		{McpServerStateStopped, McpServerStateDeleted}:  true,
+		{McpServerStateStarting, McpServerStateRunning}: true,
+		{McpServerStateStarting, McpServerStateStopped}: true,
+		{McpServerStateRunning, McpServerStateStopping}: true,
+		{McpServerStateStopping, McpServerStateStopped}: true,
+	}
+	for _, from := range states {
+		for _, to := range states {
+			t.Run(fmt.Sprintf("%s to %s", from, to), func(t *testing.T) {
+				want := allowed[[2]McpServerState{from, to}]
+				if got := from.CanTransitionTo(to); got != want {
+					t.Fatalf("CanTransitionTo() = %v, want %v", got, want)
+				}
+				server := NewMcpSSEServer("s", "", "1.0.0")
+				server.State = from
+				err := server.setState(to)
+				if want {
+					if err != nil || server.GetState() != to {
+						t.Fatalf("setState() error = %v, state = %s", err, server.GetState())
+					}
+					return
+				}
+				var transitionErr *StateTransitionError
+				if !errors.As(err, &transitionErr) || server.GetState() != from {
+					t.Fatalf("setState() error = %v, state = %s, want a transition error in %s", err, server.GetState(), from)
+				}
+			})
+		}
+	}
+}
+
+func TestRegistryLifecycle(t *testing.T) {
+	registry := NewRegistry(nil)
+	server, err := registry.Create("s", "", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.GetState() != McpServerStateStopped {
+		t.Fatalf("Create() state = %s, want %s", server.GetState(), McpServerStateStopped)
+	}
+	if _, err := registry.Create("s", "", "1.0.0"); !errors.Is(err, ErrServerExists) {
+		t.Fatalf("Create() of an existing server error = %v, want %v", err, ErrServerExists)
+	}
+	if _, err := registry.Stop("s"); err == nil {
+		t.Fatal("Stop() of a stopped server succeeded")
+	}
+	if _, err := registry.Start("s"); err != nil || !server.IsRunning() {
+		t.Fatalf("Start() error = %v, state = %s", err, server.GetState())
+	}
+	if _, err := registry.Start("s"); err == nil {
+		t.Fatal("Start() of a running server succeeded")
+	}
+	// a running server is stopped before it's deleted
+	if err := registry.Delete("s"); err != nil {
+		t.Fatal(err)
+	}
+	if server.GetState() != McpServerStateDeleted {
+		t.Fatalf("Delete() state = %s, want %s", server.GetState(), McpServerStateDeleted)
+	}
+	if _, err := registry.Get("s"); !errors.Is(err, ErrServerNotFound) {
+		t.Fatalf("Get() of a deleted server error = %v, want %v", err, ErrServerNotFound)
+	}
+}
+
+// TestRegistryConcurrency drives the lifecycle from many goroutines, it's meant to be run with -race
+func TestRegistryConcurrency(t *testing.T) {
+	registry := NewRegistry(nil)
+	const servers = 4
+	for i := 0; i < servers; i++ {
+		if _, err := registry.Create(fmt.Sprintf("s%d", i), "", "1.0.0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				name := fmt.Sprintf("s%d", (worker+i)%servers)
+				switch i % 5 {
+				case 0:
+					// the transitions racing each other fail, the state stays consistent
+					registry.Start(name)
+				case 1:
+					registry.Stop(name)
+				case 2:
+					for _, server := range registry.List() {
+						server.IsRunning()
+						server.GetState()
+					}
+				case 3:
+					if server, err := registry.Get(name); err == nil {
+						server.MarshalJSON()
+					}
+				case 4:
+					registry.Add(NewMcpSSEServer(fmt.Sprintf("added%d", worker), "", "1.0.0"))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, server := range registry.List() {
+		switch state := server.GetState(); state {
+		case McpServerStateStopped, McpServerStateRunning:
+		default:
+			t.Errorf("server %s is left %s", server.Name, state)
+		}
+	}
+}
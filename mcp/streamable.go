@@ -0,0 +1,612 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	HeaderSessionID   = "Mcp-Session-Id"
+	HeaderLastEventID = "Last-Event-ID"
+
+	// listenStream is the stream of the GET request, it carries the notifications
+	// which are not sent in reply to a request
+	listenStream = 0
+	// maxSessionEvents bounds the events kept per session for the resumption
+	maxSessionEvents = 1024
+	// sessionIdleTimeout is how long a session without requests and streams is kept
+	sessionIdleTimeout = 30 * time.Minute
+	heartbeatInterval  = 30 * time.Second
+)
+
+var (
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrSessionIDRequired = errors.New("Mcp-Session-Id header is required")
+)
+
+// StreamableHTTPServer serves a server over the streamable http transport.
+// A session is created by initialize and terminated by DELETE, the events of the
+// sse streams are kept per session, so a client can resume a broken stream with Last-Event-ID
+type StreamableHTTPServer struct {
+	base *server.MCPServer
+
+	mu       sync.Mutex
+	sessions map[string]*streamableSession
+}
+
+func NewStreamableHTTPServer(base *server.MCPServer) *StreamableHTTPServer {
+	return &StreamableHTTPServer{
+		base:     base,
+		sessions: make(map[string]*streamableSession),
+	}
+}
+
+func (s *StreamableHTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handlePost(w, r)
+	case http.MethodGet:
+		s.handleGet(w, r)
+	case http.MethodDelete:
+		s.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Close terminates all the sessions, e.g. when the server stops
+func (s *StreamableHTTPServer) Close() {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = make(map[string]*streamableSession)
+	s.mu.Unlock()
+	for _, session := range sessions {
+		s.terminate(session)
+	}
+}
+
+// SessionCount returns the number of the live sessions
+func (s *StreamableHTTPServer) SessionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func (s *StreamableHTTPServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSONRPCError(w, http.StatusBadRequest, nil, mcp.PARSE_ERROR, "failed to read the request body")
+		return
+	}
+	var message struct {
+		ID     any    `json:"id"`
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		writeJSONRPCError(w, http.StatusBadRequest, nil, mcp.PARSE_ERROR, "invalid json-rpc message")
+		return
+	}
+
+	var session *streamableSession
+	if message.Method == string(mcp.MethodInitialize) {
+		session, err = s.newSession(r.Context())
+		if err != nil {
+			writeJSONRPCError(w, http.StatusInternalServerError, message.ID, mcp.INTERNAL_ERROR, err.Error())
+			return
+		}
+	} else {
+		session, err = s.session(r)
+		if err != nil {
+			writeSessionError(w, err)
+			return
+		}
+	}
+	session.touch()
+
+	// notifications and responses of the client have nothing to reply
+	if message.ID == nil || message.Method == "" {
+		s.base.HandleMessage(s.base.WithContext(r.Context(), session), body)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// the request keeps running if the client disconnects, so the stream can be resumed,
+	// it's only cancelled with the session
+	stream := session.newStream()
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	go func() {
+		select {
+		case <-session.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	requestSession := newRequestSession(session, stream)
+	go func() {
+		defer cancel()
+		response := s.base.HandleMessage(s.base.WithContext(ctx, requestSession), body)
+		requestSession.close()
+		if response != nil {
+			if data, err := json.Marshal(response); err == nil {
+				session.publish(stream, data)
+			}
+		}
+		session.finish(stream)
+	}()
+
+	if message.Method == string(mcp.MethodInitialize) {
+		w.Header().Set(HeaderSessionID, session.id)
+	}
+
+	// a lone response is written as json, the notifications before it upgrade the reply to sse
+	for {
+		events, finished, changed := session.eventsAfter(stream, 0)
+		if finished && len(events) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if finished && len(events) == 1 {
+			session.discard(stream)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(events[0].data)
+			return
+		}
+		if len(events) > 0 || finished {
+			break
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	serveStream(w, r, session, stream, 0)
+}
+
+// handleGet opens the stream of the notifications, or resumes the stream of the Last-Event-ID
+func (s *StreamableHTTPServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	if accept := r.Header.Get("Accept"); accept != "" && !strings.Contains(accept, "text/event-stream") && !strings.Contains(accept, "*/*") {
+		http.Error(w, "the client must accept text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	session, err := s.session(r)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	session.touch()
+
+	stream, after := uint64(listenStream), session.lastEventSeq()
+	if lastEventID := r.Header.Get(HeaderLastEventID); lastEventID != "" {
+		stream, after, err = parseEventID(lastEventID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if stream == listenStream {
+		if !session.listen() {
+			http.Error(w, "the session already has a stream", http.StatusConflict)
+			return
+		}
+		defer session.unlisten()
+	}
+	serveStream(w, r, session, stream, after)
+}
+
+func (s *StreamableHTTPServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	session, err := s.session(r)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	s.mu.Lock()
+	delete(s.sessions, session.id)
+	s.mu.Unlock()
+	s.terminate(session)
+	w.WriteHeader(http.StatusOK)
+}
+
+// newSession creates and registers a session, the idle sessions are swept meanwhile
+func (s *StreamableHTTPServer) newSession(ctx context.Context) (*streamableSession, error) {
+	session := newStreamableSession(uuid.NewString())
+	if err := s.base.RegisterSession(ctx, session); err != nil {
+		return nil, err
+	}
+	go session.pump()
+
+	var idle []*streamableSession
+	s.mu.Lock()
+	for id, other := range s.sessions {
+		if other.idle(sessionIdleTimeout) {
+			delete(s.sessions, id)
+			idle = append(idle, other)
+		}
+	}
+	s.sessions[session.id] = session
+	s.mu.Unlock()
+
+	for _, other := range idle {
+		s.terminate(other)
+	}
+	return session, nil
+}
+
+func (s *StreamableHTTPServer) session(r *http.Request) (*streamableSession, error) {
+	id := r.Header.Get(HeaderSessionID)
+	if id == "" {
+		return nil, ErrSessionIDRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return session, nil
+}
+
+func (s *StreamableHTTPServer) terminate(session *streamableSession) {
+	s.base.UnregisterSession(context.Background(), session.id)
+	session.close()
+}
+
+// serveStream writes the events of the stream after the sequence number, until the stream
+// is finished, the client disconnects or the session is terminated
+func serveStream(w http.ResponseWriter, r *http.Request, session *streamableSession, stream, after uint64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		events, finished, changed := session.eventsAfter(stream, after)
+		for _, event := range events {
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: message\ndata: %s\n\n", event.id(), event.data); err != nil {
+				return
+			}
+			after = event.seq
+		}
+		flusher.Flush()
+		if finished {
+			return
+		}
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-session.done:
+			return
+		}
+	}
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, ErrSessionNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeJSONRPCError(w http.ResponseWriter, status int, id any, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(mcp.NewJSONRPCError(mcp.NewRequestId(id), code, message, nil))
+}
+
+// streamEvent is an event of a stream, the id is the stream and the sequence number
+// of the event in the session
+type streamEvent struct {
+	stream uint64
+	seq    uint64
+	data   []byte
+}
+
+func (e streamEvent) id() string {
+	return fmt.Sprintf("%d/%d", e.stream, e.seq)
+}
+
+func parseEventID(id string) (stream, seq uint64, err error) {
+	streamPart, seqPart, ok := strings.Cut(id, "/")
+	if ok {
+		stream, err = strconv.ParseUint(streamPart, 10, 64)
+	}
+	if ok && err == nil {
+		seq, err = strconv.ParseUint(seqPart, 10, 64)
+	}
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("invalid event id: %s", id)
+	}
+	return stream, seq, nil
+}
+
+// streamableSession is a client session of the streamable http transport,
+// it keeps the recent events of all its streams
+type streamableSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+	logLevel      atomic.Value
+	clientInfo    atomic.Value
+	// done is closed when the session is terminated
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu         sync.Mutex
+	seq        uint64
+	nextStream uint64
+	events     []streamEvent
+	finished   map[uint64]bool
+	// changed is closed and replaced whenever an event is published or a stream finishes
+	changed   chan struct{}
+	listening bool
+	lastSeen  time.Time
+}
+
+func newStreamableSession(id string) *streamableSession {
+	return &streamableSession{
+		id:            id,
+		notifications: make(chan mcp.JSONRPCNotification, 100),
+		done:          make(chan struct{}),
+		finished:      make(map[uint64]bool),
+		changed:       make(chan struct{}),
+		nextStream:    listenStream + 1,
+		lastSeen:      time.Now(),
+	}
+}
+
+func (s *streamableSession) SessionID() string {
+	return s.id
+}
+
+func (s *streamableSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *streamableSession) Initialize() {
+	s.initialized.Store(true)
+}
+
+func (s *streamableSession) Initialized() bool {
+	return s.initialized.Load()
+}
+
+func (s *streamableSession) SetLogLevel(level mcp.LoggingLevel) {
+	s.logLevel.Store(level)
+}
+
+func (s *streamableSession) GetLogLevel() mcp.LoggingLevel {
+	if level, ok := s.logLevel.Load().(mcp.LoggingLevel); ok {
+		return level
+	}
+	return mcp.LoggingLevelError
+}
+
+// SetClientInfo keeps the client info of the initialize request, the tool call history records it
+func (s *streamableSession) SetClientInfo(clientInfo mcp.Implementation) {
+	s.clientInfo.Store(clientInfo)
+}
+
+func (s *streamableSession) GetClientInfo() mcp.Implementation {
+	clientInfo, _ := s.clientInfo.Load().(mcp.Implementation)
+	return clientInfo
+}
+
+// pump publishes the notifications of the session on the listen stream
+func (s *streamableSession) pump() {
+	for {
+		select {
+		case notification := <-s.notifications:
+			if data, err := json.Marshal(notification); err == nil {
+				s.publish(listenStream, data)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *streamableSession) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+func (s *streamableSession) touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSeen = time.Now()
+}
+
+func (s *streamableSession) idle(timeout time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.listening && time.Since(s.lastSeen) > timeout
+}
+
+// listen marks the listen stream as open, a session has a single listen stream
+func (s *streamableSession) listen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listening {
+		return false
+	}
+	s.listening = true
+	return true
+}
+
+func (s *streamableSession) unlisten() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listening = false
+	s.lastSeen = time.Now()
+}
+
+func (s *streamableSession) newStream() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := s.nextStream
+	s.nextStream++
+	return stream
+}
+
+func (s *streamableSession) lastEventSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq
+}
+
+// publish appends an event to the stream, the oldest events are dropped beyond the bound
+func (s *streamableSession) publish(stream uint64, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	s.events = append(s.events, streamEvent{stream: stream, seq: s.seq, data: data})
+	if len(s.events) > maxSessionEvents {
+		s.events = s.events[len(s.events)-maxSessionEvents:]
+		s.pruneFinished()
+	}
+	s.notifyChanged()
+}
+
+// finish marks the last event of the stream has been published
+func (s *streamableSession) finish(stream uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finished[stream] = true
+	s.notifyChanged()
+}
+
+// discard drops a stream which has been replied as json
+func (s *streamableSession) discard(stream uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.events[:0]
+	for _, event := range s.events {
+		if event.stream != stream {
+			events = append(events, event)
+		}
+	}
+	s.events = events
+	delete(s.finished, stream)
+}
+
+// eventsAfter returns the events of the stream after the sequence number, whether the
+// stream is finished, and a channel closed on the next change
+func (s *streamableSession) eventsAfter(stream, after uint64) ([]streamEvent, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []streamEvent
+	for _, event := range s.events {
+		if event.stream == stream && event.seq > after {
+			events = append(events, event)
+		}
+	}
+	return events, s.finished[stream], s.changed
+}
+
+// pruneFinished forgets the finished streams which have no event left, the caller must hold s.mu
+func (s *streamableSession) pruneFinished() {
+	for stream := range s.finished {
+		kept := false
+		for _, event := range s.events {
+			if event.stream == stream {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			delete(s.finished, stream)
+		}
+	}
+}
+
+// notifyChanged wakes up the stream writers, the caller must hold s.mu
+func (s *streamableSession) notifyChanged() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// requestSession is the session seen by a request, the notifications sent while
+// the request is handled go to the stream of the request instead of the listen stream
+type requestSession struct {
+	*streamableSession
+	stream        uint64
+	notifications chan mcp.JSONRPCNotification
+	stop          chan struct{}
+	stopped       chan struct{}
+}
+
+func newRequestSession(session *streamableSession, stream uint64) *requestSession {
+	s := &requestSession{
+		streamableSession: session,
+		stream:            stream,
+		notifications:     make(chan mcp.JSONRPCNotification, 100),
+		stop:              make(chan struct{}),
+		stopped:           make(chan struct{}),
+	}
+	go s.pump()
+	return s
+}
+
+func (s *requestSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *requestSession) pump() {
+	defer close(s.stopped)
+	publish := func(notification mcp.JSONRPCNotification) {
+		if data, err := json.Marshal(notification); err == nil {
+			s.publish(s.stream, data)
+		}
+	}
+	for {
+		select {
+		case notification := <-s.notifications:
+			publish(notification)
+		case <-s.stop:
+			// the notifications sent before the response go first
+			for {
+				select {
+				case notification := <-s.notifications:
+					publish(notification)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// close stops the pump once the pending notifications are published
+func (s *requestSession) close() {
+	close(s.stop)
+	<-s.stopped
+}
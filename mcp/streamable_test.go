@@ -0,0 +1,221 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const initializeRequest = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0.0"}}}`
+
+// newStreamableTestServer serves a server with the tool slow, which sends a notification and
+// waits for release before it replies
+func newStreamableTestServer(t *testing.T) (*httptest.Server, chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	base := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	base.AddTool(mcp.NewTool("slow"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		server.ServerFromContext(ctx).SendNotificationToClient(ctx, "notifications/message", map[string]any{"level": "info", "data": "started"})
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return mcp.NewToolResultText("done"), nil
+	})
+	streamable := NewStreamableHTTPServer(base)
+	ts := httptest.NewServer(streamable)
+	t.Cleanup(func() {
+		ts.Close()
+		streamable.Close()
+	})
+	return ts, release
+}
+
+func post(t *testing.T, ctx context.Context, url, session, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if session != "" {
+		req.Header.Set(HeaderSessionID, session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func initialize(t *testing.T, url string) string {
+	t.Helper()
+	resp := post(t, context.Background(), url, "", initializeRequest)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		t.Fatalf("initialize status = %d, content type = %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var result struct {
+		Result mcp.InitializeResult `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Result.ServerInfo.Name != "test" {
+		t.Fatalf("initialize result = %+v", result.Result)
+	}
+	session := resp.Header.Get(HeaderSessionID)
+	if session == "" {
+		t.Fatal("initialize returned no session id")
+	}
+	initialized := post(t, context.Background(), url, session, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	initialized.Body.Close()
+	if initialized.StatusCode != http.StatusAccepted {
+		t.Fatalf("initialized notification status = %d, want %d", initialized.StatusCode, http.StatusAccepted)
+	}
+	return session
+}
+
+type sseEvent struct {
+	id   string
+	data string
+}
+
+// readEvent reads the next sse event, the comments are skipped
+func readEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && event.data != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStreamableSessions(t *testing.T) {
+	ts, _ := newStreamableTestServer(t)
+	session := initialize(t, ts.URL)
+	ping := `{"jsonrpc":"2.0","id":2,"method":"ping"}`
+
+	tests := []struct {
+		name       string
+		session    string
+		wantStatus int
+	}{
+		{name: "live session", session: session, wantStatus: http.StatusOK},
+		{name: "missing session", wantStatus: http.StatusBadRequest},
+		{name: "unknown session", session: "unknown", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(t, context.Background(), ts.URL, tt.session, ping)
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(HeaderSessionID, session)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	resp = post(t, context.Background(), ts.URL, session, ping)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status of a deleted session = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestStreamableResume(t *testing.T) {
+	ts, release := newStreamableTestServer(t)
+	session := initialize(t, ts.URL)
+
+	// the notification upgrades the reply to sse, the client goes away after it
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := post(t, ctx, ts.URL, session, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"slow"}}`)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("tools/call status = %d, content type = %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	notification := readEvent(t, bufio.NewReader(resp.Body))
+	if !strings.Contains(notification.data, "notifications/message") || notification.id == "" {
+		t.Fatalf("first event = %+v, want the notification", notification)
+	}
+	cancel()
+	resp.Body.Close()
+
+	// the call keeps running and its response is replayed after the last seen event
+	close(release)
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(HeaderSessionID, session)
+	req.Header.Set(HeaderLastEventID, notification.id)
+	resumed, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Body.Close()
+	if resumed.StatusCode != http.StatusOK {
+		t.Fatalf("resume status = %d, want %d", resumed.StatusCode, http.StatusOK)
+	}
+	reader := bufio.NewReader(resumed.Body)
+	response := readEvent(t, reader)
+	var result struct {
+		ID     int `json:"id"`
+		Result struct {
+			Content []mcp.TextContent `json:"content"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(response.data), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.ID != 2 || len(result.Result.Content) != 1 || result.Result.Content[0].Text != "done" {
+		t.Fatalf("replayed event = %s, want the response of the call", response.data)
+	}
+	// the stream ends once its response is sent
+	if rest, _ := io.ReadAll(reader); strings.Contains(string(rest), "data:") {
+		t.Fatalf("events after the response: %s", rest)
+	}
+
+	req.Header.Set(HeaderLastEventID, "bogus")
+	invalid, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status of an invalid Last-Event-ID = %d, want %d", invalid.StatusCode, http.StatusBadRequest)
+	}
+}
@@ -2,11 +2,19 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
+var (
+	ErrToolNotFound = errors.New("tool not found")
+	ErrToolExists   = errors.New("tool already exists")
+	// ErrMounted is returned when an item mounted from an upstream or a gateway member is changed through the server
+	ErrMounted = errors.New("mounted from an upstream or a gateway member, it can't be changed")
+)
+
 // Tool is mcp tool for the MCP server,
 // it can be loadded as a plugin and add to server dynamically
 type MCPTool struct {
@@ -14,6 +22,16 @@ type MCPTool struct {
 	Desc      string    `json:"desc"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Plugin is the plugin the tool is loaded from, nil for the catalog tools
+	Plugin *Plugin `json:"plugin,omitempty"`
+	// Definition is set for the declarative tools
+	Definition *ToolDefinition `json:"definition,omitempty"`
+	// Mount is the upstream or the gateway member the tool is mounted from, the mounted tools are not restored
+	Mount string `json:"mount,omitempty"`
+	// Secrets are the names of the secrets the handler reads with SecretFromContext
+	Secrets []string `json:"secrets,omitempty"`
+	// RequireApproval holds every call of the tool until an operator approves it
+	RequireApproval bool `json:"require_approval,omitempty"`
 
 	Option  []mcp.ToolOption                                                                    `json:"-"`
 	Handler func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) `json:"-"`
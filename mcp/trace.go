@@ -0,0 +1,49 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/jyz0309/omcp/tracing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InjectTraceContext writes the trace context of the tool call into the header, so the outbound
+// requests of a plugin handler continue the trace of the call
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	tracing.Inject(ctx, header)
+}
+
+// startToolSpan starts the span of a tool call, a client without a trace in the headers, e.g. over stdio,
+// can still pass the traceparent in the _meta of the call
+func (s *MCPServer) startToolSpan(ctx context.Context, tool string, meta *mcp.Meta) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() && meta != nil {
+		ctx = tracing.ExtractMeta(ctx, meta.AdditionalFields)
+	}
+	return tracing.Tracer().Start(ctx, fmt.Sprintf("tool %s", tool), trace.WithAttributes(
+		attribute.String("omcp.server", s.Name),
+		attribute.String("omcp.tool", tool),
+	))
+}
+
+// endToolSpan ends the span of a tool call with the status of the call, an error result is an error
+func endToolSpan(span trace.Span, status string, result *mcp.CallToolResult, err error) {
+	span.SetAttributes(attribute.String("omcp.call.status", status))
+	if err == nil && result != nil && result.IsError {
+		err = fmt.Errorf("tool returned an error result")
+	}
+	tracing.End(span, err)
+}
+
+// endRequestSpan ends the span the transport started for the JSON-RPC request once it's answered
+func endRequestSpan(ctx context.Context, id any, method mcp.MCPMethod, message any, result any) {
+	tracing.EndRequest(ctx, nil)
+}
+
+func failRequestSpan(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
+	tracing.EndRequest(ctx, err)
+}
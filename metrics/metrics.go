@@ -1,3 +1,145 @@
 package metrics
 
-var ()
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "omcp"
+
+var (
+	// Registry has the OMCP metrics along with the go runtime and the process ones
+	Registry = prometheus.NewRegistry()
+
+	ToolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "The tool calls of the managed servers by their status, success, error or denied.",
+	}, []string{"server", "tool", "status"})
+	ToolCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_call_errors_total",
+		Help:      "The tool calls which failed or returned an error result.",
+	}, []string{"server", "tool"})
+	ToolCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_call_duration_seconds",
+		Help:      "The latency of the tool calls, including the time waiting for an approval.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"server", "tool"})
+
+	Sessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sessions",
+		Help:      "The active client sessions of the managed servers by transport, sse or streamable-http.",
+	}, []string{"server", "transport"})
+	MCPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mcp_requests_total",
+		Help:      "The requests of the MCP endpoints, sse, message and mcp, the server is empty if it doesn't exist.",
+	}, []string{"server", "endpoint", "method", "code"})
+
+	PluginLoads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "plugin_loads_total",
+		Help:      "The plugin loads by result, success, rejected by the signature policy or failed.",
+	}, []string{"result"})
+
+	AdminRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admin_requests_total",
+		Help:      "The requests of the admin api by route and status code.",
+	}, []string{"method", "route", "code"})
+	AdminRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "admin_request_duration_seconds",
+		Help:      "The latency of the requests of the admin api.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	serverStateDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "server_state"),
+		"The state of the managed servers, 1 for the current state.", []string{"server", "state"}, nil)
+	serverToolsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "server_tools"),
+		"The tools of the managed servers.", []string{"server"}, nil)
+
+	// servers lists the managed servers at every scrape
+	servers atomic.Pointer[func() []ServerInfo]
+)
+
+const (
+	PluginLoadSuccess  = "success"
+	PluginLoadRejected = "rejected"
+	PluginLoadFailed   = "failed"
+)
+
+func init() {
+	Registry.MustRegister(
+		ToolCalls, ToolCallErrors, ToolCallDuration,
+		Sessions, MCPRequests,
+		PluginLoads,
+		AdminRequests, AdminRequestDuration,
+		serverCollector{},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveToolCall records a finished tool call, an error is a call which failed or returned an error result
+func ObserveToolCall(server, tool, status string, failed bool, duration time.Duration) {
+	ToolCalls.WithLabelValues(server, tool, status).Inc()
+	if failed {
+		ToolCallErrors.WithLabelValues(server, tool).Inc()
+	}
+	ToolCallDuration.WithLabelValues(server, tool).Observe(duration.Seconds())
+}
+
+// ForgetServer drops the series of a deleted server
+func ForgetServer(server string) {
+	labels := prometheus.Labels{"server": server}
+	ToolCalls.DeletePartialMatch(labels)
+	ToolCallErrors.DeletePartialMatch(labels)
+	ToolCallDuration.DeletePartialMatch(labels)
+	Sessions.DeletePartialMatch(labels)
+	MCPRequests.DeletePartialMatch(labels)
+}
+
+// ServerInfo is what the state gauges report about a managed server
+type ServerInfo struct {
+	Name  string
+	State string
+	Tools int
+}
+
+// SetServers reports the servers of the list at every scrape
+func SetServers(list func() []ServerInfo) {
+	servers.Store(&list)
+}
+
+// serverCollector reports the state of the servers when they are scraped, so a deleted server disappears
+type serverCollector struct{}
+
+func (serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serverStateDesc
+	ch <- serverToolsDesc
+}
+
+func (serverCollector) Collect(ch chan<- prometheus.Metric) {
+	list := servers.Load()
+	if list == nil {
+		return
+	}
+	for _, server := range (*list)() {
+		ch <- prometheus.MustNewConstMetric(serverStateDesc, prometheus.GaugeValue, 1, server.Name, server.State)
+		ch <- prometheus.MustNewConstMetric(serverToolsDesc, prometheus.GaugeValue, float64(server.Tools), server.Name)
+	}
+}
@@ -0,0 +1,243 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MasterKeySize is the size of the AES-256 master key
+const MasterKeySize = 32
+
+var (
+	ErrSecretNotFound = errors.New("secret not found")
+	ErrWrongMasterKey = errors.New("secret is encrypted with another master key")
+
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+)
+
+// Secret is a named secret, only the ciphertext of its value is kept
+type Secret struct {
+	Name string `json:"name"`
+	Desc string `json:"desc,omitempty"`
+	// KeyID identifies the master key the value is encrypted with
+	KeyID string `json:"key_id"`
+	// Ciphertext is the nonce and the sealed value, it's never returned by the api
+	Ciphertext []byte    `json:"ciphertext,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// public returns a copy of the secret without the ciphertext
+func (s *Secret) public() Secret {
+	public := *s
+	public.Ciphertext = nil
+	return public
+}
+
+// Cipher encrypts the secret values with AES-256-GCM, the name of the secret is authenticated
+// with its value, so a ciphertext can't be moved to another secret
+type Cipher struct {
+	aead  cipher.AEAD
+	keyID string
+}
+
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != MasterKeySize {
+		return nil, fmt.Errorf("invalid master key, %d bytes are required, got %d", MasterKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &Cipher{aead: aead, keyID: hex.EncodeToString(sum[:8])}, nil
+}
+
+func (c *Cipher) seal(name, value string) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, []byte(value), []byte(name)), nil
+}
+
+func (c *Cipher) open(secret *Secret) (string, error) {
+	if secret.KeyID != c.keyID {
+		return "", fmt.Errorf("%w: %s", ErrWrongMasterKey, secret.Name)
+	}
+	if len(secret.Ciphertext) < c.aead.NonceSize() {
+		return "", fmt.Errorf("invalid ciphertext of secret %s", secret.Name)
+	}
+	nonce, sealed := secret.Ciphertext[:c.aead.NonceSize()], secret.Ciphertext[c.aead.NonceSize():]
+	value, err := c.aead.Open(nil, nonce, sealed, []byte(secret.Name))
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret %s: %w", secret.Name, err)
+	}
+	return string(value), nil
+}
+
+// LoadMasterKey reads the base64 or hex encoded master key from the file, or from the env value if the file is empty
+func LoadMasterKey(file, env string) ([]byte, error) {
+	encoded := env
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	}
+	encoded = strings.TrimSpace(encoded)
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == MasterKeySize {
+		return key, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != MasterKeySize {
+		return nil, fmt.Errorf("invalid master key, %d base64 or hex encoded bytes are required", MasterKeySize)
+	}
+	return key, nil
+}
+
+// GenerateMasterKey writes a random base64 encoded master key into the file, an existing file is never overwritten
+func GenerateMasterKey(path string) error {
+	key := make([]byte, MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(base64.StdEncoding.EncodeToString(key) + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Persister persists the secrets, it's called after every change
+type Persister interface {
+	SaveSecret(secret *Secret) error
+	DeleteSecret(name string) error
+}
+
+// Secrets keeps the encrypted secrets and decrypts them for the tools, it's safe to be used from multiple goroutines
+type Secrets struct {
+	mu        sync.RWMutex
+	secrets   map[string]*Secret
+	cipher    *Cipher
+	persister Persister
+}
+
+// NewSecrets creates an empty set of secrets, the persister can be nil to keep them in memory only
+func NewSecrets(cipher *Cipher, persister Persister) *Secrets {
+	return &Secrets{secrets: make(map[string]*Secret), cipher: cipher, persister: persister}
+}
+
+// Add adds existing secrets without persisting them, e.g. the restored ones, the secrets
+// the master key can't decrypt are returned as errors but kept, so they aren't lost
+func (s *Secrets) Add(secrets ...*Secret) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, secret := range secrets {
+		if _, err := s.cipher.open(secret); err != nil {
+			errs = append(errs, err)
+		}
+		s.secrets[secret.Name] = secret
+	}
+	return errors.Join(errs...)
+}
+
+// Set creates the secret or replaces its value, the description is kept if it's empty
+func (s *Secrets) Set(name, desc, value string) (Secret, error) {
+	if !namePattern.MatchString(name) {
+		return Secret{}, fmt.Errorf("invalid secret name %q, letters, digits, _, . and - are allowed", name)
+	}
+	if value == "" {
+		return Secret{}, errors.New("secret value is required")
+	}
+	ciphertext, err := s.cipher.seal(name, value)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	secret := &Secret{Name: name, Desc: desc, KeyID: s.cipher.keyID, Ciphertext: ciphertext, CreatedAt: now, UpdatedAt: now}
+	if existing, ok := s.secrets[name]; ok {
+		secret.CreatedAt = existing.CreatedAt
+		if desc == "" {
+			secret.Desc = existing.Desc
+		}
+	}
+	if s.persister != nil {
+		if err := s.persister.SaveSecret(secret); err != nil {
+			return Secret{}, err
+		}
+	}
+	s.secrets[name] = secret
+	return secret.public(), nil
+}
+
+// List returns the secrets without their values, sorted by name
+func (s *Secrets) List() []Secret {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	secrets := make([]Secret, 0, len(s.secrets))
+	for _, secret := range s.secrets {
+		secrets = append(secrets, secret.public())
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets
+}
+
+// Has reports whether the secret exists
+func (s *Secrets) Has(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.secrets[name]
+	return ok
+}
+
+func (s *Secrets) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.secrets[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	if s.persister != nil {
+		if err := s.persister.DeleteSecret(name); err != nil {
+			return err
+		}
+	}
+	delete(s.secrets, name)
+	return nil
+}
+
+// Secret decrypts the value of the secret
+func (s *Secrets) Secret(name string) (string, error) {
+	s.mu.RLock()
+	secret, ok := s.secrets[name]
+	s.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return s.cipher.open(secret)
+}
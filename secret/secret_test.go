@@ -0,0 +1,178 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newTestCipher(t *testing.T, fill byte) *Cipher {
+	t.Helper()
+	cipher, err := NewCipher(bytes.Repeat([]byte{fill}, MasterKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func TestSecretsOpen(t *testing.T) {
+	cipher := newTestCipher(t, 1)
+	secrets := NewSecrets(cipher, nil)
+	stored, err := secrets.Set("db", "", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Ciphertext != nil {
+		t.Fatal("Set() returned the ciphertext")
+	}
+	sealed := *secrets.secrets["db"]
+	other := newTestCipher(t, 2)
+	tamperedValue := bytes.Clone(sealed.Ciphertext)
+	tamperedValue[len(tamperedValue)-1] ^= 1
+	tamperedNonce := bytes.Clone(sealed.Ciphertext)
+	tamperedNonce[0] ^= 1
+
+	tests := []struct {
+		name    string
+		cipher  *Cipher
+		secret  *Secret
+		wantErr bool
+		// sentinel is the error wrapped by the failure, if any
+		sentinel error
+	}{
+		{name: "sealed secret", cipher: cipher, secret: &sealed},
+		{
+			// the name is authenticated, so the ciphertext can't be moved to a secret a tool is allowed to read
+			name:    "opened under another name",
+			cipher:  cipher,
+			secret:  &Secret{Name: "public", KeyID: sealed.KeyID, Ciphertext: sealed.Ciphertext},
+			wantErr: true,
+		},
+		{name: "another master key", cipher: other, secret: &sealed, wantErr: true, sentinel: ErrWrongMasterKey},
+		{
+			// a key id claiming the right key doesn't make another key decrypt it
+			name:    "another master key under the key id",
+			cipher:  other,
+			secret:  &Secret{Name: "db", KeyID: other.keyID, Ciphertext: sealed.Ciphertext},
+			wantErr: true,
+		},
+		{
+			name:    "tampered ciphertext",
+			cipher:  cipher,
+			secret:  &Secret{Name: "db", KeyID: sealed.KeyID, Ciphertext: tamperedValue},
+			wantErr: true,
+		},
+		{
+			name:    "tampered nonce",
+			cipher:  cipher,
+			secret:  &Secret{Name: "db", KeyID: sealed.KeyID, Ciphertext: tamperedNonce},
+			wantErr: true,
+		},
+		{
+			name:    "truncated ciphertext",
+			cipher:  cipher,
+			secret:  &Secret{Name: "db", KeyID: sealed.KeyID, Ciphertext: sealed.Ciphertext[:4]},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.cipher.open(tt.secret)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("open() = %q, want an error", value)
+				}
+				if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+					t.Fatalf("open() error = %v, want %v", err, tt.sentinel)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("open() error = %v", err)
+			}
+			if value != "hunter2" {
+				t.Errorf("open() = %q, want hunter2", value)
+			}
+		})
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	secrets := NewSecrets(newTestCipher(t, 1), nil)
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "db", value: "hunter2"},
+		{name: "prod.db-2_x", value: "hunter2"},
+		{name: "", value: "hunter2", wantErr: true},
+		{name: "../db", value: "hunter2", wantErr: true},
+		{name: "db", value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := secrets.Set(tt.name, "", tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q, %q) error = %v, wantErr %v", tt.name, tt.value, err, tt.wantErr)
+		}
+	}
+	if value, err := secrets.Secret("db"); err != nil || value != "hunter2" {
+		t.Fatalf("Secret() = %q, %v, want hunter2", value, err)
+	}
+	if _, err := secrets.Secret("missing"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("Secret() of a missing secret error = %v, want %v", err, ErrSecretNotFound)
+	}
+
+	// the restored secrets the master key can't decrypt are kept but reported
+	restored := NewSecrets(newTestCipher(t, 2), nil)
+	if err := restored.Add(secrets.secrets["db"]); !errors.Is(err, ErrWrongMasterKey) {
+		t.Fatalf("Add() error = %v, want %v", err, ErrWrongMasterKey)
+	}
+	if !restored.Has("db") {
+		t.Fatal("Add() dropped the secret it can't decrypt")
+	}
+	if err := secrets.Delete("db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := secrets.Delete("db"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("Delete() of a deleted secret error = %v, want %v", err, ErrSecretNotFound)
+	}
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, MasterKeySize)
+	generated := filepath.Join(t.TempDir(), "master.key")
+	if err := GenerateMasterKey(generated); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateMasterKey(generated); err == nil {
+		t.Fatal("GenerateMasterKey() overwrote the existing key")
+	}
+	tests := []struct {
+		name    string
+		file    string
+		env     string
+		wantErr bool
+	}{
+		{name: "base64", env: base64.StdEncoding.EncodeToString(key)},
+		{name: "hex", env: hex.EncodeToString(key) + "\n"},
+		{name: "generated file", file: generated},
+		{name: "too short", env: base64.StdEncoding.EncodeToString(key[:16]), wantErr: true},
+		{name: "empty", wantErr: true},
+		{name: "missing file", file: filepath.Join(t.TempDir(), "missing"), env: hex.EncodeToString(key), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := LoadMasterKey(tt.file, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadMasterKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.file == "" && !bytes.Equal(loaded, key) {
+				t.Errorf("LoadMasterKey() = %x, want %x", loaded, key)
+			}
+		})
+	}
+}
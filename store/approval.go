@@ -0,0 +1,51 @@
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/jyz0309/omcp/mcp"
+)
+
+const BucketApprovals = "approvals"
+
+// SaveApproval persists the approval with the arguments of its call and the decision
+func SaveApproval(st Store, approval *mcp.Approval) error {
+	data, err := json.Marshal(approval)
+	if err != nil {
+		return err
+	}
+	return st.Put(BucketApprovals, approval.ID, data)
+}
+
+func DeleteApproval(st Store, id string) error {
+	return st.Delete(BucketApprovals, id)
+}
+
+func LoadApprovals(st Store) ([]*mcp.Approval, error) {
+	values, err := st.List(BucketApprovals)
+	if err != nil {
+		return nil, err
+	}
+	approvals := make([]*mcp.Approval, 0, len(values))
+	for _, data := range values {
+		var approval mcp.Approval
+		if err := json.Unmarshal(data, &approval); err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, &approval)
+	}
+	return approvals, nil
+}
+
+// ApprovalPersister persists the approvals of mcp.Approvals into the store
+type ApprovalPersister struct {
+	Store Store
+}
+
+func (p ApprovalPersister) SaveApproval(approval *mcp.Approval) error {
+	return SaveApproval(p.Store, approval)
+}
+
+func (p ApprovalPersister) DeleteApproval(id string) error {
+	return DeleteApproval(p.Store, id)
+}
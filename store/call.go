@@ -0,0 +1,51 @@
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/jyz0309/omcp/mcp"
+)
+
+const BucketCalls = "calls"
+
+// SaveCall persists a record of the tool call history
+func SaveCall(st Store, record *mcp.CallRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return st.Put(BucketCalls, record.ID, data)
+}
+
+func DeleteCall(st Store, id string) error {
+	return st.Delete(BucketCalls, id)
+}
+
+func LoadCalls(st Store) ([]*mcp.CallRecord, error) {
+	values, err := st.List(BucketCalls)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*mcp.CallRecord, 0, len(values))
+	for _, data := range values {
+		var record mcp.CallRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+// CallPersister persists the records of mcp.History into the store
+type CallPersister struct {
+	Store Store
+}
+
+func (p CallPersister) SaveCall(record *mcp.CallRecord) error {
+	return SaveCall(p.Store, record)
+}
+
+func (p CallPersister) DeleteCall(id string) error {
+	return DeleteCall(p.Store, id)
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/jyz0309/omcp/auth"
+)
+
+const BucketClientKeys = "client_keys"
+
+// SaveClientKey persists the client key with the hash of its secret
+func SaveClientKey(st Store, key *auth.ClientKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return st.Put(BucketClientKeys, key.ID, data)
+}
+
+func DeleteClientKey(st Store, id string) error {
+	return st.Delete(BucketClientKeys, id)
+}
+
+func LoadClientKeys(st Store) ([]*auth.ClientKey, error) {
+	values, err := st.List(BucketClientKeys)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*auth.ClientKey, 0, len(values))
+	for _, data := range values {
+		var key auth.ClientKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	return keys, nil
+}
+
+// ClientKeyPersister persists the client keys of auth.ClientKeys into the store
+type ClientKeyPersister struct {
+	Store Store
+}
+
+func (p ClientKeyPersister) SaveClientKey(key *auth.ClientKey) error {
+	return SaveClientKey(p.Store, key)
+}
+
+func (p ClientKeyPersister) DeleteClientKey(id string) error {
+	return DeleteClientKey(p.Store, id)
+}
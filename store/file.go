@@ -0,0 +1,97 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const fileExt = ".json"
+
+// FileStore keeps every bucket as a directory and every key as a file in it
+type FileStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+func NewFileStore(dataDir string) (*FileStore, error) {
+	dir := filepath.Join(dataDir, "kv")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Get(bucket, key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := os.ReadFile(s.path(bucket, key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *FileStore) Put(bucket, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Join(s.dir, url.PathEscape(bucket)), 0o700); err != nil {
+		return err
+	}
+	// write to a temp file and rename it, so a crash never leaves a half written value
+	dst := s.path(bucket, key)
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, value, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+func (s *FileStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path(bucket, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStore) List(bucket string) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries, err := os.ReadDir(filepath.Join(s.dir, url.PathEscape(bucket)))
+	if os.IsNotExist(err) {
+		return map[string][]byte{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileExt) {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimSuffix(entry.Name(), fileExt))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key file %s: %w", entry.Name(), err)
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, url.PathEscape(bucket), entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		values[key] = data
+	}
+	return values, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// path escapes the bucket and key, so they can never point outside the data dir
+func (s *FileStore) path(bucket, key string) string {
+	return filepath.Join(s.dir, url.PathEscape(bucket), url.PathEscape(key)+fileExt)
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/jyz0309/omcp/secret"
+)
+
+const BucketSecrets = "secrets"
+
+// SaveSecret persists the secret with the ciphertext of its value
+func SaveSecret(st Store, s *secret.Secret) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return st.Put(BucketSecrets, s.Name, data)
+}
+
+func DeleteSecret(st Store, name string) error {
+	return st.Delete(BucketSecrets, name)
+}
+
+func LoadSecrets(st Store) ([]*secret.Secret, error) {
+	values, err := st.List(BucketSecrets)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make([]*secret.Secret, 0, len(values))
+	for _, data := range values {
+		var s secret.Secret
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, &s)
+	}
+	return secrets, nil
+}
+
+// SecretPersister persists the secrets of secret.Secrets into the store
+type SecretPersister struct {
+	Store Store
+}
+
+func (p SecretPersister) SaveSecret(s *secret.Secret) error {
+	return SaveSecret(p.Store, s)
+}
+
+func (p SecretPersister) DeleteSecret(name string) error {
+	return DeleteSecret(p.Store, name)
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/jyz0309/omcp/mcp"
+)
+
+const BucketServers = "servers"
+
+// SaveServer persists the metadata, state, tools and resources of the server
+func SaveServer(st Store, server *mcp.MCPServer) error {
+	data, err := json.Marshal(server)
+	if err != nil {
+		return err
+	}
+	return st.Put(BucketServers, server.Name, data)
+}
+
+func DeleteServer(st Store, name string) error {
+	return st.Delete(BucketServers, name)
+}
+
+// LoadServers returns the persisted servers, they only carry the metadata
+// and must be rehydrated by mcp.RestoreMcpServer before serving
+func LoadServers(st Store) ([]*mcp.MCPServer, error) {
+	values, err := st.List(BucketServers)
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]*mcp.MCPServer, 0, len(values))
+	for _, data := range values {
+		var server mcp.MCPServer
+		if err := json.Unmarshal(data, &server); err != nil {
+			return nil, err
+		}
+		servers = append(servers, &server)
+	}
+	return servers, nil
+}
+
+// ServerPersister persists the servers of a mcp.Registry into the store
+type ServerPersister struct {
+	Store Store
+}
+
+func (p ServerPersister) SaveServer(server *mcp.MCPServer) error {
+	return SaveServer(p.Store, server)
+}
+
+func (p ServerPersister) DeleteServer(name string) error {
+	return DeleteServer(p.Store, name)
+}
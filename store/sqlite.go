@@ -0,0 +1,84 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS kv (
+	bucket TEXT NOT NULL,
+	key    TEXT NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+)`
+
+// SqliteStore keeps all the buckets in a single sqlite table
+type SqliteStore struct {
+	db *sql.DB
+}
+
+func NewSqliteStore(dataDir string) (*SqliteStore, error) {
+	if err := os.MkdirAll(dataDir, 0o700); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", filepath.Join(dataDir, "omcp.db"))
+	if err != nil {
+		return nil, err
+	}
+	// sqlite only allows one writer at a time
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SqliteStore{db: db}, nil
+}
+
+func (s *SqliteStore) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRow("SELECT value FROM kv WHERE bucket = ? AND key = ?", bucket, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *SqliteStore) Put(bucket, key string, value []byte) error {
+	_, err := s.db.Exec(
+		"INSERT INTO kv (bucket, key, value) VALUES (?, ?, ?) ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value",
+		bucket, key, value,
+	)
+	return err
+}
+
+func (s *SqliteStore) Delete(bucket, key string) error {
+	_, err := s.db.Exec("DELETE FROM kv WHERE bucket = ? AND key = ?", bucket, key)
+	return err
+}
+
+func (s *SqliteStore) List(bucket string) (map[string][]byte, error) {
+	rows, err := s.db.Query("SELECT key, value FROM kv WHERE bucket = ?", bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string][]byte)
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+func (s *SqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNotFound = errors.New("not found")
+
+const (
+	DriverFile   = "file"
+	DriverSqlite = "sqlite"
+)
+
+// Store is a bucketed key-value store used to persist omcp state,
+// every value is an opaque blob, callers decide the encoding
+type Store interface {
+	Get(bucket, key string) ([]byte, error)
+	Put(bucket, key string, value []byte) error
+	Delete(bucket, key string) error
+	// List returns all the values of the bucket keyed by their key
+	List(bucket string) (map[string][]byte, error)
+	Close() error
+}
+
+// Open opens the store of the driver under the data dir
+func Open(driver, dataDir string) (Store, error) {
+	switch driver {
+	case DriverFile, "":
+		return NewFileStore(dataDir)
+	case DriverSqlite:
+		return NewSqliteStore(dataDir)
+	default:
+		return nil, fmt.Errorf("unknown store driver: %s", driver)
+	}
+}
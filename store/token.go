@@ -0,0 +1,43 @@
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/jyz0309/omcp/auth"
+)
+
+const BucketTokens = "tokens"
+
+// SaveToken persists the token with the hash of its secret
+func SaveToken(st Store, token *auth.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return st.Put(BucketTokens, token.ID, data)
+}
+
+func LoadTokens(st Store) ([]*auth.Token, error) {
+	values, err := st.List(BucketTokens)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*auth.Token, 0, len(values))
+	for _, data := range values {
+		var token auth.Token
+		if err := json.Unmarshal(data, &token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	return tokens, nil
+}
+
+// TokenPersister persists the tokens of auth.Tokens into the store
+type TokenPersister struct {
+	Store Store
+}
+
+func (p TokenPersister) SaveToken(token *auth.Token) error {
+	return SaveToken(p.Store, token)
+}
@@ -0,0 +1,204 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+
+	ServiceName = "omcp"
+
+	instrumentation = "github.com/jyz0309/omcp"
+)
+
+// propagator reads and writes the W3C trace context and baggage, the trace is propagated
+// even if no exporter is set up
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Config selects the exporter of the spans
+type Config struct {
+	// Exporter is none, otlp, stdout or file
+	Exporter string
+	// Endpoint is the url of the otlp http collector, OTEL_EXPORTER_OTLP_ENDPOINT if empty
+	Endpoint string
+	// File is the file the spans are appended to by the file exporter
+	File string
+	// SampleRatio is the ratio of the new traces which are sampled, the sampled parents are always followed
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider exporting to the exporter of the config,
+// the returned func flushes the pending spans and stops the exporter
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	var exporter sdktrace.SpanExporter
+	// the stdout and file spans are written as they end, so they aren't lost when the process is killed
+	immediate := true
+	switch config.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(config.Endpoint))
+		}
+		otlp, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, err
+		}
+		exporter, immediate = otlp, false
+	case ExporterStdout:
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, err
+		}
+		exporter = stdout
+	case ExporterFile:
+		if config.File == "" {
+			return nil, fmt.Errorf("the file exporter requires a file")
+		}
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		exporter = fileExporter{SpanExporter: stdout, file: file}
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %s, none, otlp, stdout or file", config.Exporter)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the service name
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	if res, err = resource.Merge(res, resource.Environment()); err != nil {
+		return nil, err
+	}
+	ratio := config.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	}
+	if immediate {
+		options = append(options, sdktrace.WithSyncer(exporter))
+	} else {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// fileExporter closes the file of the spans along with the exporter
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (e fileExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Tracer is the tracer of the OMCP spans, it's a noop one until Setup
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Extract continues the trace of the traceparent header
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject writes the trace context of ctx into the header, so an outbound request continues the trace
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// ExtractMeta continues the trace of the traceparent field of the _meta of a MCP message
+func ExtractMeta(ctx context.Context, meta map[string]any) context.Context {
+	if meta == nil {
+		return ctx
+	}
+	return propagator.Extract(ctx, metaCarrier(meta))
+}
+
+// InjectMeta writes the trace context of ctx into the _meta of a MCP message
+func InjectMeta(ctx context.Context, meta map[string]any) {
+	propagator.Inject(ctx, metaCarrier(meta))
+}
+
+// metaCarrier carries the trace context in the _meta fields, the same keys as the headers
+type metaCarrier map[string]any
+
+func (m metaCarrier) Get(key string) string {
+	value, _ := m[key].(string)
+	return value
+}
+
+func (m metaCarrier) Set(key, value string) {
+	m[key] = value
+}
+
+func (m metaCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+type requestSpanKey struct{}
+
+// StartRequest starts the span of a JSON-RPC request, it's ended by EndRequest once the response
+// is sent, which is after the http request for the sse transport
+func StartRequest(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	return context.WithValue(ctx, requestSpanKey{}, span), span
+}
+
+// EndRequest ends the span of the JSON-RPC request of ctx, if any, recording the error
+func EndRequest(ctx context.Context, err error) {
+	span, ok := ctx.Value(requestSpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	End(span, err)
+}
+
+// End ends the span, recording the error
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
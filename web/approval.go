@@ -0,0 +1,131 @@
+package web
+
+import (
+	"errors"
+	"io"
+
+	"github.com/jyz0309/omcp/auth"
+	"github.com/jyz0309/omcp/mcp"
+	"github.com/jyz0309/omcp/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetApprovals holds the calls requiring approval in the approvals until an operator decides them,
+// their arguments are redacted like the audit log
+func (s *OmcpServer) SetApprovals(approvals *mcp.Approvals) {
+	approvals.SetRedactor(s.redactArguments)
+	s.approvals = approvals
+	s.Registry.SetApprovals(approvals)
+}
+
+// restoreApprovals loads the persisted approvals, the pending ones are canceled and the expired ones are dropped
+func (s *OmcpServer) restoreApprovals() error {
+	approvals, err := store.LoadApprovals(s.store)
+	if err != nil {
+		return err
+	}
+	if err := s.approvals.Add(approvals...); err != nil {
+		// the approvals are still listed, only their cancellation isn't persisted
+		s.logger.Warn(err)
+	}
+	return nil
+}
+
+func (s *OmcpServer) ListApproval(c *gin.Context) {
+	var req ListApprovalReq
+	// the filter is optional, so an empty body is fine
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.log(c).Error(err)
+		c.JSON(200, ListApprovalResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	principal := principalOf(c)
+	approvals := []mcp.Approval{}
+	for _, approval := range s.approvals.List(req.Status, req.Server) {
+		// the scoped roles only see the approvals of the servers they select
+		var labels map[string]string
+		if mcpServer, err := s.Registry.Get(approval.Server); err == nil {
+			labels = mcpServer.Labels
+		}
+		if principal.Roles.Allows(auth.PermApprovalList, approval.Server, labels) {
+			approvals = append(approvals, approval)
+		}
+	}
+	c.JSON(200, ListApprovalResp{
+		Success:   true,
+		Message:   "success",
+		Total:     int64(len(approvals)),
+		Approvals: approvals,
+	})
+}
+
+func (s *OmcpServer) GetApproval(c *gin.Context) {
+	approval, err := s.approvals.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(200, ApprovalResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermApprovalList, approval.Server) {
+		return
+	}
+	c.JSON(200, ApprovalResp{
+		Success:  true,
+		Message:  "success",
+		Approval: &approval,
+	})
+}
+
+// DecideApproval approves or rejects a pending approval, the principal is recorded as the approver
+func (s *OmcpServer) DecideApproval(c *gin.Context) {
+	var req DecideApprovalReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ApprovalResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if req.Decision != ApprovalDecisionApprove && req.Decision != ApprovalDecisionReject {
+		c.JSON(200, ApprovalResp{
+			Success: false,
+			Message: "invalid decision, approve or reject",
+		})
+		return
+	}
+	id := c.Param("id")
+	pending, err := s.approvals.Get(id)
+	if err != nil {
+		c.JSON(200, ApprovalResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermApprovalDecide, pending.Server) {
+		return
+	}
+	approver := principalOf(c).Name
+	approval, err := s.approvals.Decide(id, req.Decision == ApprovalDecisionApprove, approver, req.Comment)
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ApprovalResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	s.log(c).Infof("approval %s of tool %s of mcp server %s %s by %s", id, approval.Tool, approval.Server, approval.Status, approver)
+	c.JSON(200, ApprovalResp{
+		Success:  true,
+		Message:  "success",
+		Approval: &approval,
+	})
+}
@@ -0,0 +1,223 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jyz0309/omcp/audit"
+	"github.com/jyz0309/omcp/mcp"
+
+	"github.com/gin-gonic/gin"
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// auditBodyLimit bounds the request and the response bodies kept to audit an admin action
+	auditBodyLimit = 1 << 20
+)
+
+// SetAudit records the admin actions and the tool calls into the audit logger
+func (s *OmcpServer) SetAudit(logger *audit.Logger) {
+	s.audit = logger
+}
+
+// auditWriter keeps the head of the response to tell whether the action succeeded
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if w.body.Len() < auditBodyLimit {
+		w.body.Write(b[:min(len(b), auditBodyLimit-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Audit records the admin api actions, the reads are not recorded, it runs before the authentication
+// so the rejected requests are recorded as well
+func (s *OmcpServer) Audit(c *gin.Context) {
+	if s.audit == nil || c.Request.Method == http.MethodGet {
+		c.Next()
+		return
+	}
+	start := time.Now()
+	var args map[string]any
+	if strings.HasPrefix(c.ContentType(), "application/json") && c.Request.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, auditBodyLimit))
+		if err == nil {
+			_ = json.Unmarshal(body, &args)
+		}
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	}
+	writer := &auditWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+
+	c.Next()
+
+	if args == nil && c.Request.PostForm != nil {
+		// the multipart forms, e.g. the plugin loading, are parsed by the handler
+		args = make(map[string]any, len(c.Request.PostForm))
+		for key, values := range c.Request.PostForm {
+			args[key] = strings.Join(values, ",")
+		}
+	}
+	// the path params, e.g. the id of an approval, are arguments as well
+	for _, param := range c.Params {
+		if args == nil {
+			args = make(map[string]any, len(c.Params))
+		}
+		args[param.Key] = param.Value
+	}
+	entry := audit.Entry{
+		Actor:      principalOf(c).Name,
+		Action:     auditAction(c.FullPath()),
+		Arguments:  args,
+		Status:     audit.StatusSuccess,
+		LatencyMs:  float64(time.Since(start).Microseconds()) / 1000,
+		RemoteAddr: c.ClientIP(),
+	}
+	entry.Server, entry.Tool, entry.Target = auditTargets(entry.Action, args)
+	if _, ok := args["value"]; ok && strings.HasPrefix(entry.Action, "secret.") {
+		// the value of a secret is never recorded, whatever the redacted keys are
+		args["value"] = audit.Redacted
+	}
+
+	var resp ServerResp
+	_ = json.Unmarshal(writer.body.Bytes(), &resp)
+	switch status := writer.Status(); {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		entry.Status = audit.StatusDenied
+		entry.Error = resp.Message
+	case status != http.StatusOK || !resp.Success:
+		entry.Status = audit.StatusFailure
+		entry.Error = resp.Message
+	}
+	s.audit.Record(entry)
+}
+
+// auditAction turns the route into the action, e.g. /api/server/create into server.create
+func auditAction(route string) string {
+	action := strings.ReplaceAll(strings.Trim(strings.TrimPrefix(route, "/api"), "/"), "/", ".")
+	switch action {
+	case "load":
+		return "plugin.load"
+	case "approvals.:id":
+		return "approval.decide"
+	}
+	return action
+}
+
+// auditTargets picks the server, the tool and the other target of the action from its arguments
+func auditTargets(action string, args map[string]any) (server, tool, target string) {
+	str := func(key string) string {
+		value, _ := args[key].(string)
+		return value
+	}
+	server = str("server")
+	kind, _, _ := strings.Cut(action, ".")
+	switch kind {
+	case "server":
+		server = str("name")
+	case "tool":
+		tool = str("name")
+		if tool == "" {
+			tool = str("tool_name")
+		}
+	case "policy":
+		target = str("name")
+		if policy, ok := args["policy"].(map[string]any); ok {
+			target, _ = policy["name"].(string)
+		}
+	case "resource":
+		target = str("uri")
+	case "approval":
+		target = str("id")
+	default:
+		target = str("name")
+	}
+	return server, tool, target
+}
+
+// auditCall records a tool call of a managed server
+func (s *OmcpServer) auditCall(ctx context.Context, call mcp.ToolCall) {
+	if s.audit == nil {
+		return
+	}
+	entry := audit.Entry{
+		Time:      call.Start,
+		Action:    "tool.call",
+		Server:    call.Server,
+		Tool:      call.Tool,
+		Arguments: call.Arguments,
+		Status:    audit.StatusSuccess,
+		LatencyMs: float64(call.Duration.Microseconds()) / 1000,
+	}
+	if call.Identity != nil {
+		entry.Actor = call.Identity.Subject
+	}
+	switch call.Status {
+	case mcp.CallStatusDenied:
+		entry.Status = audit.StatusDenied
+	case mcp.CallStatusError:
+		entry.Status = audit.StatusFailure
+	}
+	if call.Err != nil {
+		entry.Error = call.Err.Error()
+	} else if call.Result != nil && call.Result.IsError {
+		entry.Error = toolResultText(call.Result)
+	}
+	s.audit.Record(entry)
+}
+
+// toolResultText is the text of a result flagged as an error
+func toolResultText(result *mcpgo.CallToolResult) string {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcpgo.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func (s *OmcpServer) ListAudit(c *gin.Context) {
+	var req ListAuditReq
+	// the filter is optional, so an empty body is fine
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.log(c).Error(err)
+		c.JSON(200, ListAuditResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if s.audit == nil {
+		c.JSON(200, ListAuditResp{
+			Success: false,
+			Message: "audit log is disabled",
+		})
+		return
+	}
+	entries, err := s.audit.Query(audit.Filter(req))
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ListAuditResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	c.JSON(200, ListAuditResp{
+		Success: true,
+		Message: "success",
+		Total:   int64(len(entries)),
+		Entries: entries,
+	})
+}
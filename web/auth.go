@@ -0,0 +1,438 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jyz0309/omcp/auth"
+	"github.com/jyz0309/omcp/mcp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// tokenKey is the key of the verified token in the gin context
+	tokenKey = "omcp.token"
+	// clientKeyKey is the key of the verified client key in the gin context
+	clientKeyKey = "omcp.client_key"
+	// principalKey is the key of the caller of the admin api in the gin context
+	principalKey = "omcp.principal"
+
+	// resourceMetadataPath is the well-known path of the protected resource metadata
+	resourceMetadataPath = "/.well-known/oauth-protected-resource"
+)
+
+// errKeyedMember refuses a gateway without client keys over a member with client keys,
+// since the gateway would expose the tools of the member to the callers without a key
+var errKeyedMember = errors.New("gateway without client keys aggregates a member with client keys")
+
+// RequireToken rejects the admin api requests without a valid bearer token, an admin api token
+// or an oauth bearer token if oauth is configured, or a verified client certificate,
+// the principal of the token is set in the context
+func (s *OmcpServer) RequireToken(c *gin.Context) {
+	raw, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		// a verified client certificate authenticates the request without a token
+		if identity := auth.CertIdentity(c.Request.TLS); identity != nil {
+			c.Set(principalKey, auth.CertPrincipal(identity, s.certRoles))
+			c.Request = c.Request.WithContext(mcp.WithIdentity(c.Request.Context(), identity))
+			c.Next()
+			return
+		}
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ServerResp{
+			Success: false,
+			Message: "missing bearer token",
+		})
+		return
+	}
+	if s.oauth != nil && !strings.HasPrefix(raw, auth.TokenPrefix) {
+		identity, err := s.oauth.Validate(c.Request.Context(), raw)
+		if err != nil {
+			s.unauthorized(c, `Bearer error="invalid_token"`, err)
+			return
+		}
+		c.Set(principalKey, s.oauth.Principal(identity))
+		c.Request = c.Request.WithContext(mcp.WithIdentity(c.Request.Context(), identity))
+		c.Next()
+		return
+	}
+	token, err := s.tokens.Verify(raw)
+	if err != nil {
+		s.unauthorized(c, `Bearer error="invalid_token"`, err)
+		return
+	}
+	c.Set(tokenKey, token)
+	c.Set(principalKey, token.Principal())
+	c.Next()
+}
+
+// Require rejects the requests of the principals without the permission on any server,
+// the handlers of the requests to a server check it on the server with authorize
+func (s *OmcpServer) Require(perm auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := principalOf(c)
+		if !principal.Roles.Grants(perm) {
+			s.forbidden(c, principal.Denied(perm, ""))
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorize checks the permission of the principal on the server, a denied request is answered
+// with 403, the permissions which are not about a server are checked with an empty server
+func (s *OmcpServer) authorize(c *gin.Context, perm auth.Permission, server string) bool {
+	var labels map[string]string
+	if mcpServer, err := s.Registry.Get(server); err == nil {
+		labels = mcpServer.Labels
+	}
+	return s.authorizeLabels(c, perm, server, labels)
+}
+
+// authorizeLabels is authorize with the labels of a server which isn't registered yet
+func (s *OmcpServer) authorizeLabels(c *gin.Context, perm auth.Permission, server string, labels map[string]string) bool {
+	principal := principalOf(c)
+	if principal.Roles.Allows(perm, server, labels) {
+		return true
+	}
+	s.forbidden(c, principal.Denied(perm, server))
+	return false
+}
+
+// authorizeUnscoped checks an unscoped binding grants the permission, for the operations on a server
+// which reach beyond it, e.g. launching a command on the host
+func (s *OmcpServer) authorizeUnscoped(c *gin.Context, perm auth.Permission, reason string) bool {
+	principal := principalOf(c)
+	if principal.Roles.Allows(perm, "", nil) {
+		return true
+	}
+	s.forbidden(c, fmt.Errorf("%w, %s requires an unscoped role", principal.Denied(perm, ""), reason))
+	return false
+}
+
+func (s *OmcpServer) forbidden(c *gin.Context, err error) {
+	s.log(c).Warnf("deny %s %s from %s: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+	c.AbortWithStatusJSON(http.StatusForbidden, ServerResp{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+func principalOf(c *gin.Context) auth.Principal {
+	principal, _ := c.Get(principalKey)
+	p, _ := principal.(auth.Principal)
+	return p
+}
+
+// AuthenticateClient authenticates the MCP requests, a server which has client keys requires one of them
+// and the scope of the key restricts the tools and resources of the request, otherwise the bearer token is
+// validated against the oauth issuers if they are configured, a request without a bearer token is identified
+// by its verified client certificate, the caller is attached to the request context
+func (s *OmcpServer) AuthenticateClient(c *gin.Context) {
+	name := c.Param("name")
+	raw, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	// the gateway calls its members in process, so their keys are only enforced by the keys of the gateway
+	if member := s.keyedMember(name, nil); member != "" && !s.clientKeys.Required(name) {
+		err := fmt.Errorf("%w: %s", errKeyedMember, member)
+		s.log(c).Warnf("reject %s %s from %s: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+		c.AbortWithStatusJSON(http.StatusForbidden, ServerResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if s.clientKeys.Required(name) {
+		if raw == "" {
+			s.unauthorized(c, "Bearer", auth.ErrClientKeyRequired)
+			return
+		}
+		key, err := s.clientKeys.Verify(name, raw)
+		if err != nil {
+			s.unauthorized(c, `Bearer error="invalid_token"`, err)
+			return
+		}
+		c.Set(clientKeyKey, key)
+		ctx := mcp.WithClientScope(c.Request.Context(), &key.Scope)
+		ctx = mcp.WithIdentity(ctx, &mcp.Identity{Subject: "key:" + key.Name})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		return
+	}
+	if raw == "" {
+		// a verified client certificate identifies the caller without a bearer token
+		if identity := auth.CertIdentity(c.Request.TLS); identity != nil {
+			c.Request = c.Request.WithContext(mcp.WithIdentity(c.Request.Context(), identity))
+			c.Next()
+			return
+		}
+	}
+	if s.oauth == nil {
+		c.Next()
+		return
+	}
+
+	challenge := fmt.Sprintf(`Bearer resource_metadata="%s"`, s.resourceMetadataURL(c))
+	if raw == "" {
+		if s.oauth.Required() {
+			s.unauthorized(c, challenge, errors.New("missing bearer token"))
+			return
+		}
+		c.Next()
+		return
+	}
+	identity, err := s.oauth.Validate(c.Request.Context(), raw)
+	if err != nil {
+		s.unauthorized(c, challenge+`, error="invalid_token"`, err)
+		return
+	}
+	c.Request = c.Request.WithContext(mcp.WithIdentity(c.Request.Context(), identity))
+	c.Next()
+}
+
+// keyedMember is a member of the gateway which has client keys, the members of the member gateways included,
+// it's empty if the server isn't a gateway or none of its members has client keys
+func (s *OmcpServer) keyedMember(name string, seen []string) string {
+	mcpServer, err := s.Registry.Get(name)
+	if err != nil || mcpServer.Gateway == nil || slices.Contains(seen, name) {
+		return ""
+	}
+	seen = append(seen, name)
+	for _, member := range mcpServer.Gateway.Members {
+		if s.clientKeys.Required(member) {
+			return member
+		}
+		if keyed := s.keyedMember(member, seen); keyed != "" {
+			return keyed
+		}
+	}
+	return ""
+}
+
+func (s *OmcpServer) unauthorized(c *gin.Context, challenge string, err error) {
+	s.log(c).Warnf("reject %s %s from %s: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+	c.Header("WWW-Authenticate", challenge)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, ServerResp{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+// SetOAuth enables the validation of the oauth bearer tokens on the MCP endpoints
+func (s *OmcpServer) SetOAuth(config *auth.OAuthConfig) error {
+	validator, err := auth.NewValidator(config)
+	if err != nil {
+		return err
+	}
+	s.oauth = validator
+	return nil
+}
+
+// resourceMetadataURL is the url of the protected resource metadata document of the request host
+func (s *OmcpServer) resourceMetadataURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + resourceMetadataPath
+}
+
+// HandleResourceMetadata serves the oauth protected resource metadata document of RFC 9728
+func (s *OmcpServer) HandleResourceMetadata(c *gin.Context) {
+	if s.oauth == nil {
+		c.JSON(http.StatusNotFound, ServerResp{
+			Success: false,
+			Message: "oauth is not configured",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, s.oauth.Metadata())
+}
+
+// Bootstrap creates the bootstrap token if there is no active token, the secret is returned
+// only when a token is created
+func (s *OmcpServer) Bootstrap() (string, error) {
+	if s.tokens.HasActive() {
+		return "", nil
+	}
+	secret, _, err := s.tokens.Create(auth.BootstrapTokenName, auth.RoleBindings{{Role: auth.RoleAdmin}}, 0)
+	return secret, err
+}
+
+func (s *OmcpServer) ListToken(c *gin.Context) {
+	tokens := s.tokens.List()
+	c.JSON(200, ListTokenResp{
+		Total:  int64(len(tokens)),
+		Tokens: tokens,
+	})
+}
+
+func (s *OmcpServer) CreateToken(c *gin.Context) {
+	var req CreateTokenReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, TokenResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			c.JSON(200, TokenResp{
+				Success: false,
+				Message: "invalid ttl: " + err.Error(),
+			})
+			return
+		}
+	}
+	secret, token, err := s.tokens.Create(req.Name, req.Roles, ttl)
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, TokenResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	c.JSON(200, TokenResp{
+		Success: true,
+		Message: "success",
+		Token:   &token,
+		Secret:  secret,
+	})
+}
+
+func (s *OmcpServer) RevokeToken(c *gin.Context) {
+	var req RevokeTokenReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, TokenResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	token, err := s.tokens.Revoke(req.Name)
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, TokenResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	c.JSON(200, TokenResp{
+		Success: true,
+		Message: "success",
+		Token:   &token,
+	})
+}
+
+func (s *OmcpServer) ListClientKey(c *gin.Context) {
+	var req ListClientKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ListClientKeyResp{})
+		return
+	}
+	principal := principalOf(c)
+	var keys []auth.ClientKey
+	for _, key := range s.clientKeys.List(req.Server) {
+		var labels map[string]string
+		if mcpServer, err := s.Registry.Get(key.Server); err == nil {
+			labels = mcpServer.Labels
+		}
+		// the scoped roles only see the keys of the servers they select
+		if principal.Roles.Allows(auth.PermKeyManage, key.Server, labels) {
+			keys = append(keys, key)
+		}
+	}
+	c.JSON(200, ListClientKeyResp{
+		Total: int64(len(keys)),
+		Keys:  keys,
+	})
+}
+
+func (s *OmcpServer) CreateClientKey(c *gin.Context) {
+	var req CreateClientKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ClientKeyResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermKeyManage, req.Server) {
+		return
+	}
+	if _, err := s.Registry.Get(req.Server); err != nil {
+		c.JSON(200, ClientKeyResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			c.JSON(200, ClientKeyResp{
+				Success: false,
+				Message: "invalid ttl: " + err.Error(),
+			})
+			return
+		}
+	}
+	secret, key, err := s.clientKeys.Create(req.Server, req.Name, req.Scope, ttl)
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ClientKeyResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	c.JSON(200, ClientKeyResp{
+		Success: true,
+		Message: "success",
+		Key:     &key,
+		Secret:  secret,
+	})
+}
+
+func (s *OmcpServer) RevokeClientKey(c *gin.Context) {
+	var req RevokeClientKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ClientKeyResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermKeyManage, req.Server) {
+		return
+	}
+	key, err := s.clientKeys.Revoke(req.Server, req.Name)
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ClientKeyResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	c.JSON(200, ClientKeyResp{
+		Success: true,
+		Message: "success",
+		Key:     &key,
+	})
+}
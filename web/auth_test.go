@@ -0,0 +1,61 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jyz0309/omcp/mcp"
+)
+
+// TestGatewayOverKeyedMember checks a gateway can't expose the tools of a member with client keys
+// to the callers without a key, the members are called in process so their keys aren't checked
+func TestGatewayOverKeyedMember(t *testing.T) {
+	s, admin := newTestServer(t)
+	createServer(t, s, admin, CreateMcpServerReq{Name: "member"})
+	createServer(t, s, admin, CreateMcpServerReq{Name: "gateway", Gateway: &mcp.Gateway{Members: []string{"member"}}})
+	initialize := func(token string) int {
+		return do(t, s, http.MethodPost, "/mcp/gateway/mcp", token, initializeRequest, nil)
+	}
+	if status := initialize(""); status != http.StatusOK {
+		t.Fatalf("gateway over a member without keys replied %d, want %d", status, http.StatusOK)
+	}
+
+	mustSucceed(t, s, "/api/key/create", admin, CreateClientKeyReq{Server: "member", Name: "agent"})
+	if status := initialize(""); status != http.StatusForbidden {
+		t.Fatalf("gateway without keys over a keyed member replied %d, want %d", status, http.StatusForbidden)
+	}
+	var created CreateMcpServerResp
+	do(t, s, http.MethodPost, "/api/server/create", admin, CreateMcpServerReq{Name: "other", Gateway: &mcp.Gateway{Members: []string{"member"}}}, &created)
+	if created.Success || !strings.Contains(created.Message, errKeyedMember.Error()) {
+		t.Fatalf("create a gateway without keys over a keyed member = %v %s, want %v", created.Success, created.Message, errKeyedMember)
+	}
+
+	// the keys of the gateway guard the members
+	var key ClientKeyResp
+	if status := do(t, s, http.MethodPost, "/api/key/create", admin, CreateClientKeyReq{Server: "gateway", Name: "agent"}, &key); status != http.StatusOK || !key.Success {
+		t.Fatalf("create a key of the gateway replied %d: %s", status, key.Message)
+	}
+	if status := initialize(""); status != http.StatusUnauthorized {
+		t.Fatalf("keyed gateway without a key replied %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := initialize(key.Secret); status != http.StatusOK {
+		t.Fatalf("keyed gateway with its key replied %d, want %d", status, http.StatusOK)
+	}
+}
+
+// TestRevokedClientKey checks a server doesn't open to the clients without a key once its last key is revoked
+func TestRevokedClientKey(t *testing.T) {
+	s, admin := newTestServer(t)
+	createServer(t, s, admin, CreateMcpServerReq{Name: "s"})
+	var key ClientKeyResp
+	if status := do(t, s, http.MethodPost, "/api/key/create", admin, CreateClientKeyReq{Server: "s", Name: "agent"}, &key); status != http.StatusOK || !key.Success {
+		t.Fatalf("create a key replied %d: %s", status, key.Message)
+	}
+	mustSucceed(t, s, "/api/key/revoke", admin, RevokeClientKeyReq{Server: "s", Name: "agent"})
+	for name, token := range map[string]string{"without a key": "", "with the revoked key": key.Secret} {
+		if status := do(t, s, http.MethodPost, "/mcp/s/mcp", token, initializeRequest, nil); status != http.StatusUnauthorized {
+			t.Errorf("server with a revoked key replied %d %s, want %d", status, name, http.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/jyz0309/omcp/audit"
+	"github.com/jyz0309/omcp/auth"
+	"github.com/jyz0309/omcp/mcp"
+	"github.com/jyz0309/omcp/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetHistory records the tool calls into the history
+func (s *OmcpServer) SetHistory(history *mcp.History) {
+	s.history = history
+}
+
+// restoreHistory loads the persisted records, the ones beyond the size and the retention are dropped
+func (s *OmcpServer) restoreHistory() error {
+	records, err := store.LoadCalls(s.store)
+	if err != nil {
+		return err
+	}
+	if err := s.history.Add(records...); err != nil {
+		// the dropped records are still deleted by the next pruning
+		s.logger.Warn(err)
+	}
+	return nil
+}
+
+// defaultRedactor redacts the default keys from the history and the approvals when no audit logger is configured
+var defaultRedactor = audit.NewLogger(nil)
+
+// redactArguments redacts the arguments of a call like the audit log
+func (s *OmcpServer) redactArguments(args map[string]any) map[string]any {
+	redactor := s.audit
+	if redactor == nil {
+		redactor = defaultRedactor
+	}
+	return redactor.Redact(args)
+}
+
+// recordCall records the call into the history, the arguments are redacted like the audit log
+func (s *OmcpServer) recordCall(ctx context.Context, call mcp.ToolCall) {
+	if s.history == nil {
+		return
+	}
+	call.Arguments = s.redactArguments(call.Arguments)
+	s.history.Record(call)
+}
+
+func (s *OmcpServer) ListCall(c *gin.Context) {
+	var req ListCallReq
+	// the filter is optional, so an empty body is fine
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.log(c).Error(err)
+		c.JSON(200, ListCallResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	principal := principalOf(c)
+	// the limit keeps the latest records the principal can see
+	limit := req.Limit
+	req.Limit = 0
+	calls := []mcp.CallRecord{}
+	for _, call := range s.history.List(mcp.CallFilter(req)) {
+		// the scoped roles only see the calls of the servers they select
+		var labels map[string]string
+		if mcpServer, err := s.Registry.Get(call.Server); err == nil {
+			labels = mcpServer.Labels
+		}
+		if principal.Roles.Allows(auth.PermCallList, call.Server, labels) {
+			calls = append(calls, call)
+		}
+	}
+	if limit > 0 && len(calls) > limit {
+		calls = calls[len(calls)-limit:]
+	}
+	c.JSON(200, ListCallResp{
+		Success: true,
+		Message: "success",
+		Total:   int64(len(calls)),
+		Calls:   calls,
+	})
+}
+
+func (s *OmcpServer) GetCall(c *gin.Context) {
+	call, err := s.history.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(200, CallResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermCallList, call.Server) {
+		return
+	}
+	c.JSON(200, CallResp{
+		Success: true,
+		Message: "success",
+		Call:    &call,
+	})
+}
@@ -1,61 +1,228 @@
 package web
 
 import (
-	"os"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 
+	"github.com/jyz0309/omcp/artifact"
+	"github.com/jyz0309/omcp/audit"
+	"github.com/jyz0309/omcp/auth"
 	"github.com/jyz0309/omcp/mcp"
+	"github.com/jyz0309/omcp/metrics"
+	"github.com/jyz0309/omcp/secret"
+	"github.com/jyz0309/omcp/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/sirupsen/logrus"
 )
 
+const pluginDir = "./plugins/"
+
 type OmcpServer struct {
 	*gin.Engine
 
-	logger       *logrus.Logger
-	MCPServerMap map[string]*mcp.MCPServer
+	logger     *logrus.Logger
+	store      store.Store
+	tokens     *auth.Tokens
+	clientKeys *auth.ClientKeys
+	oauth      *auth.Validator
+	audit      *audit.Logger
+	secrets    *secret.Secrets
+	approvals  *mcp.Approvals
+	history    *mcp.History
+	Registry   *mcp.Registry
+
+	plugins      *artifact.Store
+	pluginPolicy artifact.Policy
+
+	tls *tls.Config
+	// certRoles bind the admin roles to the client certificate identities
+	certRoles []auth.IdentityRole
 }
 
-func NewHttpServer() *OmcpServer {
-	r := gin.Default()
-	// TODO: test, remove it
-	logger := logrus.New()
-	logger.Out = os.Stdout
-	gin.DefaultWriter = logger.Out
+func NewHttpServer(st store.Store) *OmcpServer {
+	// the logger is set up by logging.Setup, the debug output of gin is only shown at the debug level
+	logger := logrus.StandardLogger()
+	if !logger.IsLevelEnabled(logrus.DebugLevel) {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	gin.DefaultWriter = logger.WriterLevel(logrus.DebugLevel)
+	gin.DefaultErrorWriter = logger.WriterLevel(logrus.ErrorLevel)
+	r := gin.New()
 
 	omcpServer := OmcpServer{
-		Engine:       r,
-		logger:       logger,
-		MCPServerMap: make(map[string]*mcp.MCPServer),
+		Engine:     r,
+		logger:     logger,
+		store:      st,
+		tokens:     auth.NewTokens(store.TokenPersister{Store: st}),
+		clientKeys: auth.NewClientKeys(store.ClientKeyPersister{Store: st}),
+		Registry:   mcp.NewRegistry(store.ServerPersister{Store: st}),
+		plugins:    artifact.NewStore(pluginDir),
 	}
+	omcpServer.Registry.AddCallObserver(mcp.CallObserverFunc(omcpServer.auditCall))
+	omcpServer.Registry.AddCallObserver(mcp.CallObserverFunc(omcpServer.recordCall))
+	omcpServer.SetApprovals(mcp.NewApprovals(mcp.DefaultApprovalTimeout, mcp.DefaultApprovalRetention, store.ApprovalPersister{Store: st}))
+	omcpServer.SetHistory(mcp.NewHistory(mcp.DefaultHistorySize, mcp.DefaultHistoryRetention, store.CallPersister{Store: st}))
+	metrics.SetServers(omcpServer.serverInfos)
+	logger.AddHook(omcpServer.Registry.LogHook())
 	// test
 	mcpServer := mcp.NewMcpSSEServer("hello", "hello", "1.0.0")
-	omcpServer.MCPServerMap["hello"] = mcpServer
+	omcpServer.Registry.Add(mcpServer)
 
+	// the panics are recovered inside the access log so they are logged as server errors
+	r.Use(omcpServer.RequestID, omcpServer.AccessLog, gin.Recovery())
 	r.GET("/ready", omcpServer.HandleReady)
+	r.GET(resourceMetadataPath, omcpServer.HandleResourceMetadata)
+	r.GET(resourceMetadataPath+"/*resource", omcpServer.HandleResourceMetadata)
+	// the admin api requires a token, the roles of the token grant the permissions of the routes,
+	// the actions are audited including the rejected ones
+	api := r.Group("/api", omcpServer.InstrumentAdmin, omcpServer.TraceAdmin, omcpServer.Audit, omcpServer.RequireToken)
 	// server api
-	r.GET("/api/server/list", omcpServer.ListMcpServer)
-	r.POST("/api/server/create", omcpServer.CreateMcpServer)
-	r.POST("/api/server/delete", omcpServer.DeleteMcpServer)
-	r.POST("/api/server/start", omcpServer.StartMcpServer)
-	r.POST("/api/server/stop", omcpServer.StopMcpServer)
+	api.GET("/server/list", omcpServer.Require(auth.PermServerList), omcpServer.ListMcpServer)
+	api.POST("/server/create", omcpServer.Require(auth.PermServerCreate), omcpServer.CreateMcpServer)
+	api.POST("/server/delete", omcpServer.Require(auth.PermServerDelete), omcpServer.DeleteMcpServer)
+	api.POST("/server/start", omcpServer.Require(auth.PermServerStart), omcpServer.StartMcpServer)
+	api.POST("/server/stop", omcpServer.Require(auth.PermServerStop), omcpServer.StopMcpServer)
+	api.GET("/server/logs", omcpServer.Require(auth.PermServerLogs), omcpServer.ServerLogs)
 
 	// tool api
-	r.GET("/api/tool/list", omcpServer.ListTool)
+	api.GET("/tool/list", omcpServer.Require(auth.PermToolList), omcpServer.ListTool)
+	api.POST("/tool/add", omcpServer.Require(auth.PermToolWrite), omcpServer.AddTool)
+	api.POST("/tool/update", omcpServer.Require(auth.PermToolWrite), omcpServer.UpdateTool)
+	api.POST("/tool/delete", omcpServer.Require(auth.PermToolWrite), omcpServer.DeleteTool)
+
+	// resource api
+	api.GET("/resource/list", omcpServer.Require(auth.PermResourceList), omcpServer.ListResource)
+	api.POST("/resource/add", omcpServer.Require(auth.PermResourceWrite), omcpServer.AddResource)
+	api.POST("/resource/delete", omcpServer.Require(auth.PermResourceWrite), omcpServer.DeleteResource)
+
+	// prompt api
+	api.GET("/prompt/list", omcpServer.Require(auth.PermPromptList), omcpServer.ListPrompt)
+	api.POST("/prompt/create", omcpServer.Require(auth.PermPromptWrite), omcpServer.CreatePrompt)
+	api.POST("/prompt/render", omcpServer.Require(auth.PermPromptList), omcpServer.RenderPrompt)
+	api.POST("/prompt/delete", omcpServer.Require(auth.PermPromptWrite), omcpServer.DeletePrompt)
+
+	// policy api
+	api.GET("/policy/list", omcpServer.Require(auth.PermPolicyList), omcpServer.ListPolicy)
+	api.POST("/policy/add", omcpServer.Require(auth.PermPolicyWrite), omcpServer.AddPolicy)
+	api.POST("/policy/delete", omcpServer.Require(auth.PermPolicyWrite), omcpServer.DeletePolicy)
+	api.POST("/policy/eval", omcpServer.Require(auth.PermPolicyList), omcpServer.EvalPolicy)
+
+	// token api
+	api.GET("/token/list", omcpServer.Require(auth.PermTokenManage), omcpServer.ListToken)
+	api.POST("/token/create", omcpServer.Require(auth.PermTokenManage), omcpServer.CreateToken)
+	api.POST("/token/revoke", omcpServer.Require(auth.PermTokenManage), omcpServer.RevokeToken)
+
+	// client key api
+	api.GET("/key/list", omcpServer.Require(auth.PermKeyManage), omcpServer.ListClientKey)
+	api.POST("/key/create", omcpServer.Require(auth.PermKeyManage), omcpServer.CreateClientKey)
+	api.POST("/key/revoke", omcpServer.Require(auth.PermKeyManage), omcpServer.RevokeClientKey)
+
+	// secret api
+	api.GET("/secret/list", omcpServer.Require(auth.PermSecretManage), omcpServer.ListSecret)
+	api.POST("/secret/set", omcpServer.Require(auth.PermSecretManage), omcpServer.SetSecret)
+	api.POST("/secret/delete", omcpServer.Require(auth.PermSecretManage), omcpServer.DeleteSecret)
+
+	// approval api
+	api.GET("/approvals", omcpServer.Require(auth.PermApprovalList), omcpServer.ListApproval)
+	api.GET("/approvals/:id", omcpServer.Require(auth.PermApprovalList), omcpServer.GetApproval)
+	api.POST("/approvals/:id", omcpServer.Require(auth.PermApprovalDecide), omcpServer.DecideApproval)
+
+	// call api
+	api.GET("/calls", omcpServer.Require(auth.PermCallList), omcpServer.ListCall)
+	api.GET("/calls/:id", omcpServer.Require(auth.PermCallList), omcpServer.GetCall)
 
 	// load plugin api
-	r.POST("/api/load", omcpServer.Load)
+	api.POST("/load", omcpServer.Require(auth.PermPluginLoad), omcpServer.Load)
+
+	// audit api
+	api.GET("/audit", omcpServer.Require(auth.PermAuditRead), omcpServer.ListAudit)
 	// sse api
 	r.GET("/mcp/ping", omcpServer.HandlePing)
-	r.GET("/mcp/:name/sse", omcpServer.HandleSSE)
-	r.POST("/mcp/:name/message", omcpServer.HandleMessage)
+	// the servers with client keys require one, the others accept the oauth bearer tokens
+	mcpGroup := r.Group("/mcp/:name", omcpServer.InstrumentMCP, omcpServer.TraceMCP, omcpServer.AuthenticateClient)
+	mcpGroup.GET("/sse", omcpServer.HandleSSE)
+	mcpGroup.POST("/message", omcpServer.HandleMessage)
+	// streamable http api
+	mcpGroup.POST("/mcp", omcpServer.HandleStreamableHTTP)
+	mcpGroup.GET("/mcp", omcpServer.HandleStreamableHTTP)
+	mcpGroup.DELETE("/mcp", omcpServer.HandleStreamableHTTP)
 
 	return &omcpServer
 }
 
+// Restore rehydrates the persisted tokens, secrets, approvals, tool call history and MCP servers
+func (s *OmcpServer) Restore() error {
+	tokens, err := store.LoadTokens(s.store)
+	if err != nil {
+		return err
+	}
+	s.tokens.Add(tokens...)
+	keys, err := store.LoadClientKeys(s.store)
+	if err != nil {
+		return err
+	}
+	s.clientKeys.Add(keys...)
+	// the upstreams of the servers may reference the secrets
+	if err := s.restoreSecrets(); err != nil {
+		return err
+	}
+	if err := s.restoreApprovals(); err != nil {
+		return err
+	}
+	if err := s.restoreHistory(); err != nil {
+		return err
+	}
+
+	servers, err := store.LoadServers(s.store)
+	if err != nil {
+		return err
+	}
+	for _, saved := range servers {
+		s.dropUntrustedPlugins(saved)
+		mcpServer, err := mcp.RestoreMcpServer(saved, mcp.ResolveTool)
+		if err != nil {
+			// the server is still usable without the unresolved tools
+			s.logger.Warn(err)
+		}
+		if err := s.Registry.Add(mcpServer); err != nil {
+			return err
+		}
+		s.logger.Infof("restored mcp server %s", mcpServer.Name)
+	}
+	return nil
+}
+
+// Run serves over tls if SetTLS configured it, otherwise plaintext
 func (s *OmcpServer) Run(addr string) error {
-	return s.Engine.Run(addr)
+	if s.tls == nil {
+		return s.Engine.Run(addr)
+	}
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   s.Engine.Handler(),
+		TLSConfig: s.tls,
+	}
+	s.logger.Infof("listening and serving HTTPS on %s", addr)
+	// the certificate comes from the tls config so it can be reloaded
+	return server.ListenAndServeTLS("", "")
+}
+
+// SetTLS serves over tls, the client certificates are verified if the config has client CAs
+// and the certificate identities get the roles of the config on the admin api
+func (s *OmcpServer) SetTLS(config *auth.TLSConfig) error {
+	tlsConfig, err := config.ServerTLS()
+	if err != nil {
+		return err
+	}
+	s.tls = tlsConfig
+	s.certRoles = config.Roles
+	return nil
 }
 
 // HandleReady checks if OMCP server is ready
@@ -67,7 +234,10 @@ func (s *OmcpServer) HandleReady(c *gin.Context) {
 
 // HandlePing checks if all the SSE server is ready
 func (s *OmcpServer) HandlePing(c *gin.Context) {
-	for _, sseServer := range s.MCPServerMap {
+	for _, sseServer := range s.Registry.List() {
+		if !sseServer.HasTransport(mcp.TransportSSE) {
+			continue
+		}
 		cli, err := client.NewSSEMCPClient(sseServer.CompleteSsePath())
 		if err != nil {
 			c.JSON(500, gin.H{
@@ -93,17 +263,18 @@ func (s *OmcpServer) HandlePing(c *gin.Context) {
 // HandleSSE handles the MCP server SSE request
 func (s *OmcpServer) HandleSSE(c *gin.Context) {
 	name := c.Param("name")
-	sseServer, exist := s.MCPServerMap[name]
-
-	if !exist {
-		// TODO: 转发到别的port
+	sseServer, err := s.Registry.Get(name)
+	if err == nil && !sseServer.HasTransport(mcp.TransportSSE) {
+		err = mcp.ErrServerNotFound
+	}
+	if err != nil {
 		c.JSON(200, ServerResp{
 			Success: false,
 			Message: "server not found",
 		})
 		return
 	}
-	if sseServer.State == mcp.McpServerStateRunning {
+	if sseServer.IsRunning() {
 		sseServer.ServeHTTP(c.Writer, c.Request)
 	} else {
 		c.JSON(200, ServerResp{
@@ -116,16 +287,18 @@ func (s *OmcpServer) HandleSSE(c *gin.Context) {
 
 // HandleMessage handles the MCP server message request
 func (s *OmcpServer) HandleMessage(c *gin.Context) {
-	s.logger.Info(c.Request.URL.Path)
 	name := c.Param("name")
-	sseServer, exist := s.MCPServerMap[name]
-	if !exist {
+	sseServer, err := s.Registry.Get(name)
+	if err == nil && !sseServer.HasTransport(mcp.TransportSSE) {
+		err = mcp.ErrServerNotFound
+	}
+	if err != nil {
 		c.JSON(404, gin.H{
 			"message": "not found",
 		})
 		return
 	}
-	if sseServer.State == mcp.McpServerStateRunning {
+	if sseServer.IsRunning() {
 		sseServer.ServeHTTP(c.Writer, c.Request)
 	} else {
 		c.JSON(404, gin.H{
@@ -135,11 +308,33 @@ func (s *OmcpServer) HandleMessage(c *gin.Context) {
 	}
 }
 
+// HandleStreamableHTTP handles the MCP server streamable http request,
+// POST sends the messages, GET listens or resumes a stream and DELETE terminates the session
+func (s *OmcpServer) HandleStreamableHTTP(c *gin.Context) {
+	name := c.Param("name")
+	mcpServer, err := s.Registry.Get(name)
+	if err == nil && !mcpServer.HasTransport(mcp.TransportStreamableHTTP) {
+		err = mcp.ErrServerNotFound
+	}
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "not found",
+		})
+		return
+	}
+	if !mcpServer.IsRunning() {
+		c.JSON(404, gin.H{
+			"message": "server is not running",
+		})
+		return
+	}
+	mcpServer.ServeStreamableHTTP(c.Writer, c.Request)
+}
+
 func (s *OmcpServer) CreateMcpServer(c *gin.Context) {
 	var req CreateMcpServerReq
-	s.logger.Error(c.Request.URL.Path)
 	if err := c.ShouldBindJSON(&req); err != nil {
-		s.logger.Error(err)
+		s.log(c).Error(err)
 		c.JSON(200, CreateMcpServerResp{
 			Success: false,
 			Message: "invalid request",
@@ -147,17 +342,53 @@ func (s *OmcpServer) CreateMcpServer(c *gin.Context) {
 		return
 	}
 
-	if _, exist := s.MCPServerMap[req.Name]; exist {
-		s.logger.Error("mcp server already exists")
+	if !s.authorizeLabels(c, auth.PermServerCreate, req.Name, req.Labels) {
+		return
+	}
+	// a stdio upstream runs its command as the OMCP process, which can read the store and the master key
+	if req.Upstream != nil && req.Upstream.Type == mcp.UpstreamStdio &&
+		!s.authorizeUnscoped(c, auth.PermServerCreate, "a stdio upstream") {
+		return
+	}
+	// the upstream gets the values of the secrets it references, so it could hand them to its url
+	if req.Upstream != nil && len(req.Upstream.SecretRefs()) > 0 &&
+		!s.authorizeUnscoped(c, auth.PermSecretManage, "referencing secrets") {
+		return
+	}
+	// a gateway exposes the items of its members, so they must be in the scope as well,
+	// and the new gateway has no client keys to enforce the ones of its members
+	if req.Gateway != nil {
+		for _, member := range req.Gateway.Members {
+			if !s.authorize(c, auth.PermServerCreate, member) {
+				return
+			}
+			keyed := member
+			if !s.clientKeys.Required(member) {
+				keyed = s.keyedMember(member, nil)
+			}
+			if keyed != "" {
+				c.JSON(200, CreateMcpServerResp{
+					Success: false,
+					Message: fmt.Sprintf("%v: %s", errKeyedMember, keyed),
+				})
+				return
+			}
+		}
+	}
+	mcpServer, err := s.Registry.Create(req.Name, req.Desc, req.Version,
+		mcp.WithTransports(req.Transports),
+		mcp.WithUpstream(req.Upstream),
+		mcp.WithGateway(req.Gateway),
+		mcp.WithLabels(req.Labels),
+	)
+	if err != nil {
+		s.log(c).Error(err)
 		c.JSON(200, CreateMcpServerResp{
 			Success: false,
-			Message: "mcp server already exists",
+			Message: err.Error(),
 		})
 		return
 	}
-
-	mcpServer := mcp.NewMcpSSEServer(req.Name, req.Desc, req.Version)
-	s.MCPServerMap[req.Name] = mcpServer
 	c.JSON(200, CreateMcpServerResp{
 		Success: true,
 		Message: "success",
@@ -168,7 +399,7 @@ func (s *OmcpServer) CreateMcpServer(c *gin.Context) {
 func (s *OmcpServer) DeleteMcpServer(c *gin.Context) {
 	var req DeleteMcpServerReq
 	if err := c.ShouldBindJSON(&req); err != nil {
-		s.logger.Error(err)
+		s.log(c).Error(err)
 		c.JSON(200, ServerResp{
 			Success: false,
 			Message: "invalid request",
@@ -188,7 +419,21 @@ func (s *OmcpServer) DeleteMcpServer(c *gin.Context) {
 		sseServer.Shutdown()
 	*/
 
-	delete(s.MCPServerMap, req.Name)
+	if !s.authorize(c, auth.PermServerDelete, req.Name) {
+		return
+	}
+	if err := s.Registry.Delete(req.Name); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	// the keys of the server must not let the clients into a new server of the name
+	if err := s.clientKeys.DeleteServer(req.Name); err != nil {
+		s.log(c).Error(err)
+	}
 	c.JSON(200, ServerResp{
 		Success: true,
 		Message: "success",
@@ -197,8 +442,9 @@ func (s *OmcpServer) DeleteMcpServer(c *gin.Context) {
 
 func (s *OmcpServer) ListMcpServer(c *gin.Context) {
 	var req ListMcpServerReq
-	if err := c.ShouldBindJSON(&req); err != nil {
-		s.logger.Error(err)
+	// the filter is optional, so an empty body is fine
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.log(c).Error(err)
 		c.JSON(200, ServerResp{
 			Success: false,
 			Message: "invalid request",
@@ -206,9 +452,14 @@ func (s *OmcpServer) ListMcpServer(c *gin.Context) {
 		return
 	}
 	resp := &ListMcpServerResp{}
-	for _, sseServer := range s.MCPServerMap {
+	principal := principalOf(c)
+	for _, sseServer := range s.Registry.List() {
+		// the scoped roles only see the servers they select
+		if !principal.Roles.Allows(auth.PermServerList, sseServer.Name, sseServer.Labels) {
+			continue
+		}
 		if req.IsAlive {
-			if sseServer.State == mcp.McpServerStateRunning {
+			if sseServer.IsRunning() {
 				resp.Servers = append(resp.Servers, sseServer)
 			}
 		} else {
@@ -221,22 +472,24 @@ func (s *OmcpServer) ListMcpServer(c *gin.Context) {
 func (s *OmcpServer) StartMcpServer(c *gin.Context) {
 	var req StartMcpServerReq
 	if err := c.ShouldBindJSON(&req); err != nil {
-		s.logger.Error(err)
+		s.log(c).Error(err)
 		c.JSON(200, ServerResp{
 			Success: false,
 			Message: "invalid request",
 		})
 		return
 	}
-	sseServer, exist := s.MCPServerMap[req.Name]
-	if !exist {
+	if !s.authorize(c, auth.PermServerStart, req.Name) {
+		return
+	}
+	if _, err := s.Registry.Start(req.Name); err != nil {
+		s.log(c).Error(err)
 		c.JSON(200, ServerResp{
 			Success: false,
-			Message: "not found",
+			Message: err.Error(),
 		})
 		return
 	}
-	sseServer.Start()
 	c.JSON(200, ServerResp{
 		Success: true,
 		Message: "success",
@@ -246,41 +499,55 @@ func (s *OmcpServer) StartMcpServer(c *gin.Context) {
 func (s *OmcpServer) StopMcpServer(c *gin.Context) {
 	var req StopMcpServerReq
 	if err := c.ShouldBindJSON(&req); err != nil {
-		s.logger.Error(err)
+		s.log(c).Error(err)
 		c.JSON(200, ServerResp{
 			Success: false,
 			Message: "invalid request",
 		})
 		return
 	}
-	sseServer, exist := s.MCPServerMap[req.Name]
-	if !exist {
+	if !s.authorize(c, auth.PermServerStop, req.Name) {
+		return
+	}
+	if _, err := s.Registry.Stop(req.Name); err != nil {
+		s.log(c).Error(err)
 		c.JSON(200, ServerResp{
 			Success: false,
-			Message: "not found",
+			Message: err.Error(),
 		})
 		return
 	}
-	sseServer.Stop()
-	s.logger.Info("stop mcp server", req.Name)
+	s.log(c).Info("stop mcp server", req.Name)
 	c.JSON(200, ServerResp{
 		Success: true,
 		Message: "success",
 	})
 }
 
+// ListTool lists the tools of the server, or the tools of the catalog if IsRepo is set
 func (s *OmcpServer) ListTool(c *gin.Context) {
 	var req ListToolReq
 	if err := c.ShouldBindJSON(&req); err != nil {
-		s.logger.Error(err)
+		s.log(c).Error(err)
 		c.JSON(200, ServerResp{
 			Success: false,
 			Message: "invalid request",
 		})
 		return
 	}
-	mcpServer, exist := s.MCPServerMap[req.Server]
-	if !exist {
+	if req.IsRepo {
+		tools := mcp.CatalogTools()
+		c.JSON(200, ListToolResp{
+			Total: int64(len(tools)),
+			Tools: tools,
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermToolList, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err != nil {
 		c.JSON(200, ServerResp{
 			Success: false,
 			Message: "not found",
@@ -301,25 +568,563 @@ func (s *OmcpServer) ListTool(c *gin.Context) {
 	})
 }
 
-func (s *OmcpServer) Load(c *gin.Context) {
-	pluginFile, err := c.FormFile("plugin_file")
+func (s *OmcpServer) AddTool(c *gin.Context) {
+	var req AddToolReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ToolResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	s.putTool(c, req, func(mcpServer *mcp.MCPServer, tool mcp.MCPTool) error {
+		return mcpServer.AddTool(tool)
+	})
+}
+
+func (s *OmcpServer) UpdateTool(c *gin.Context) {
+	var req UpdateToolReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ToolResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	s.putTool(c, AddToolReq(req), func(mcpServer *mcp.MCPServer, tool mcp.MCPTool) error {
+		return mcpServer.UpdateTool(tool)
+	})
+}
+
+// putTool builds the tool of the request and puts it into the server
+func (s *OmcpServer) putTool(c *gin.Context, req AddToolReq, put func(*mcp.MCPServer, mcp.MCPTool) error) {
+	if !s.authorize(c, auth.PermToolWrite, req.Server) {
+		return
+	}
+	// the tool gets the values of the secrets it references
+	if len(req.Secrets) > 0 && !s.authorizeUnscoped(c, auth.PermSecretManage, "referencing secrets") {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
 	if err != nil {
-		c.JSON(200, LoadResp{
+		c.JSON(200, ToolResp{
 			Success: false,
-			Message: "error",
+			Message: err.Error(),
 		})
 		return
 	}
-	dst := "./plugins/" + pluginFile.Filename
-	if err := c.SaveUploadedFile(pluginFile, dst); err != nil {
-		c.JSON(200, LoadResp{
+	tool, err := s.buildTool(req)
+	if err == nil {
+		err = put(mcpServer, tool)
+	}
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ToolResp{
 			Success: false,
-			Message: "error",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := s.Registry.Save(mcpServer); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ToolResp{
+			Success: false,
+			Message: "failed to persist mcp server",
+		})
+		return
+	}
+	tool, _ = mcpServer.GetTool(tool.Name)
+	c.JSON(200, ToolResp{
+		Success: true,
+		Message: "success",
+		Tool:    &tool,
+	})
+}
+
+func (s *OmcpServer) DeleteTool(c *gin.Context) {
+	var req DeleteToolReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermToolWrite, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err == nil {
+		err = mcpServer.DeleteTool(req.ToolName)
+	}
+	if err != nil {
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := s.Registry.Save(mcpServer); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "failed to persist mcp server",
 		})
 		return
 	}
-	c.JSON(200, LoadResp{
+	c.JSON(200, ServerResp{
 		Success: true,
 		Message: "success",
 	})
 }
+
+// buildTool builds the tool of the request from its source
+func (s *OmcpServer) buildTool(req AddToolReq) (mcp.MCPTool, error) {
+	if req.Name == "" {
+		return mcp.MCPTool{}, errors.New("tool name is required")
+	}
+	var tool mcp.MCPTool
+	switch req.Source {
+	case ToolSourceCatalog:
+		catalogTool, ok := mcp.CatalogTool(req.Name)
+		if !ok {
+			return mcp.MCPTool{}, fmt.Errorf("tool %s not found in catalog", req.Name)
+		}
+		tool = catalogTool
+	case ToolSourcePlugin:
+		if req.Plugin == nil {
+			return mcp.MCPTool{}, errors.New("plugin is required")
+		}
+		plugin := *req.Plugin
+		plugin.MCPType = mcp.PluginTypeTool
+		// the plugins are loaded from the artifact store by their digest, the plugin file is the digest
+		// for the clients which only send it
+		if plugin.Digest == "" {
+			plugin.Digest = plugin.PluginFile
+		}
+		if err := s.checkPlugin(&plugin); err != nil {
+			return mcp.MCPTool{}, err
+		}
+		resolved, err := mcp.PluginResolver(mcp.MCPTool{Name: req.Name, Plugin: &plugin})
+		if err != nil {
+			return mcp.MCPTool{}, err
+		}
+		tool = resolved
+	case ToolSourceDefinition:
+		if req.Definition == nil {
+			return mcp.MCPTool{}, errors.New("definition is required")
+		}
+		built, err := req.Definition.Build(req.Name, req.Desc)
+		if err != nil {
+			return mcp.MCPTool{}, err
+		}
+		tool = built
+	default:
+		return mcp.MCPTool{}, fmt.Errorf("unknown tool source: %s", req.Source)
+	}
+	if req.Desc != "" {
+		tool.Desc = req.Desc
+	}
+	tool.Secrets = mcp.MergeSecrets(tool.Secrets, req.Secrets)
+	tool.RequireApproval = tool.RequireApproval || req.RequireApproval
+	if err := s.checkSecrets(tool); err != nil {
+		return mcp.MCPTool{}, err
+	}
+	return tool, nil
+}
+
+func (s *OmcpServer) ListResource(c *gin.Context) {
+	var req ListResourceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermResourceList, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err != nil {
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "not found",
+		})
+		return
+	}
+	resources := mcpServer.ListResources()
+	c.JSON(200, ListResourceResp{
+		Total:     int64(len(resources)),
+		Resources: resources,
+	})
+}
+
+func (s *OmcpServer) AddResource(c *gin.Context) {
+	var req AddResourceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ResourceResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermResourceWrite, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err != nil {
+		c.JSON(200, ResourceResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if req.Source == nil {
+		c.JSON(200, ResourceResp{
+			Success: false,
+			Message: "source is required",
+		})
+		return
+	}
+	// a file or dir source can serve any file OMCP can read, including the store and the master key
+	if req.Source.ReadsHost() && !s.authorizeUnscoped(c, auth.PermResourceWrite, "a file or dir source") {
+		return
+	}
+	resource, err := mcp.MCPResource{
+		Name:     req.Name,
+		Desc:     req.Desc,
+		URI:      req.URI,
+		MimeType: req.MimeType,
+		Source:   req.Source,
+	}.Build()
+	if err == nil {
+		err = mcpServer.AddResource(resource)
+	}
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ResourceResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := s.Registry.Save(mcpServer); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ResourceResp{
+			Success: false,
+			Message: "failed to persist mcp server",
+		})
+		return
+	}
+	c.JSON(200, ResourceResp{
+		Success:  true,
+		Message:  "success",
+		Resource: &resource,
+	})
+}
+
+func (s *OmcpServer) DeleteResource(c *gin.Context) {
+	var req DeleteResourceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermResourceWrite, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err == nil {
+		err = mcpServer.DeleteResource(req.URI)
+	}
+	if err != nil {
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := s.Registry.Save(mcpServer); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "failed to persist mcp server",
+		})
+		return
+	}
+	c.JSON(200, ServerResp{
+		Success: true,
+		Message: "success",
+	})
+}
+
+func (s *OmcpServer) ListPrompt(c *gin.Context) {
+	var req ListPromptReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermPromptList, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err != nil {
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "not found",
+		})
+		return
+	}
+	prompts := mcpServer.ListPrompts()
+	c.JSON(200, ListPromptResp{
+		Total:   int64(len(prompts)),
+		Prompts: prompts,
+	})
+}
+
+func (s *OmcpServer) CreatePrompt(c *gin.Context) {
+	var req CreatePromptReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, PromptResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermPromptWrite, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err != nil {
+		c.JSON(200, PromptResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	prompt, err := req.Prompt.Build()
+	if err == nil {
+		err = mcpServer.AddPrompt(prompt)
+	}
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, PromptResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := s.Registry.Save(mcpServer); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, PromptResp{
+			Success: false,
+			Message: "failed to persist mcp server",
+		})
+		return
+	}
+	prompt, _ = mcpServer.GetPrompt(prompt.Name)
+	c.JSON(200, PromptResp{
+		Success: true,
+		Message: "success",
+		Prompt:  &prompt,
+	})
+}
+
+// RenderPrompt previews the messages of the prompt rendered with the arguments
+func (s *OmcpServer) RenderPrompt(c *gin.Context) {
+	var req RenderPromptReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, RenderPromptResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermPromptList, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err != nil {
+		c.JSON(200, RenderPromptResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	prompt, ok := mcpServer.GetPrompt(req.Name)
+	if !ok {
+		c.JSON(200, RenderPromptResp{
+			Success: false,
+			Message: fmt.Sprintf("%s: %s", mcp.ErrPromptNotFound, req.Name),
+		})
+		return
+	}
+	messages, err := prompt.RenderMessages(req.Arguments)
+	if err != nil {
+		c.JSON(200, RenderPromptResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	c.JSON(200, RenderPromptResp{
+		Success:  true,
+		Message:  "success",
+		Messages: messages,
+	})
+}
+
+func (s *OmcpServer) DeletePrompt(c *gin.Context) {
+	var req DeletePromptReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermPromptWrite, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err == nil {
+		err = mcpServer.DeletePrompt(req.Name)
+	}
+	if err != nil {
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := s.Registry.Save(mcpServer); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "failed to persist mcp server",
+		})
+		return
+	}
+	c.JSON(200, ServerResp{
+		Success: true,
+		Message: "success",
+	})
+}
+
+// Load saves the uploaded plugin file, loads the plugins from it
+// and attaches the tools and resources to the target server
+func (s *OmcpServer) Load(c *gin.Context) {
+	var req LoadReq
+	req.Server = c.PostForm("server")
+	if err := json.Unmarshal([]byte(c.PostForm("plugins")), &req.Plugins); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, LoadResp{
+			Success: false,
+			Message: "invalid plugins",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermPluginLoad, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err != nil {
+		c.JSON(200, LoadResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	digest, signer, err := s.storePlugin(c)
+	if err != nil {
+		s.log(c).Error(err)
+		for range req.Plugins {
+			observePluginLoad(err)
+		}
+		c.JSON(200, LoadResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	resp := LoadResp{Success: true, Message: "success", Digest: digest, Signer: signer}
+	for _, plugin := range req.Plugins {
+		plugin.PluginFile = s.plugins.Path(digest)
+		plugin.Digest = digest
+		plugin.Signer = signer
+		result := s.loadPlugin(mcpServer, plugin)
+		observePluginResult(result)
+		if !result.Success {
+			resp.Success = false
+			resp.Message = "some plugins failed to load"
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	if err := s.Registry.Save(mcpServer); err != nil {
+		s.log(c).Error(err)
+		resp.Success = false
+		resp.Message = "failed to persist mcp server"
+	}
+	c.JSON(200, resp)
+}
+
+func (s *OmcpServer) loadPlugin(mcpServer *mcp.MCPServer, plugin mcp.Plugin) LoadResult {
+	result := LoadResult{Name: plugin.Name}
+	switch plugin.MCPType {
+	case mcp.PluginTypeTool:
+		tools, err := plugin.LoadTools()
+		if err == nil {
+			// the secrets the plugin tools declare must exist like the ones of the added tools
+			for _, tool := range tools {
+				if err = s.checkSecrets(tool); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			mcpServer.Logger().Error(err)
+			result.Message = err.Error()
+			return result
+		}
+		mcpServer.AddTools(tools)
+		for _, tool := range tools {
+			result.Tools = append(result.Tools, tool.Name)
+		}
+	case mcp.PluginTypeResource:
+		resources, err := plugin.LoadResources()
+		if err != nil {
+			mcpServer.Logger().Error(err)
+			result.Message = err.Error()
+			return result
+		}
+		mcpServer.AddResources(resources)
+		for _, resource := range resources {
+			result.Resources = append(result.Resources, resource.Name)
+		}
+	default:
+		result.Message = fmt.Sprintf("unknown plugin type: %s", plugin.MCPType)
+		return result
+	}
+	mcpServer.Logger().Infof("loaded plugin %s", plugin.Name)
+	result.Success = true
+	result.Message = "success"
+	return result
+}
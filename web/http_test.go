@@ -0,0 +1,80 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jyz0309/omcp/auth"
+	"github.com/jyz0309/omcp/store"
+)
+
+const initializeRequest = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0.0"}}}`
+
+// newTestServer serves a file store in a temp dir, the admin token is returned
+func newTestServer(t *testing.T) (*OmcpServer, string) {
+	t.Helper()
+	st, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewHttpServer(st)
+	admin := createToken(t, s, "admin", auth.RoleBindings{{Role: auth.RoleAdmin}})
+	return s, admin
+}
+
+func createToken(t *testing.T, s *OmcpServer, name string, roles auth.RoleBindings) string {
+	t.Helper()
+	raw, _, err := s.tokens.Create(name, roles, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// do sends the request with the token as the bearer token and decodes the json reply into resp
+func do(t *testing.T, s *OmcpServer, method, path, token string, body, resp any) int {
+	t.Helper()
+	var data []byte
+	switch body := body.(type) {
+	case nil:
+	case string:
+		data = []byte(body)
+	default:
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	if resp != nil && recorder.Code != http.StatusAccepted {
+		if err := json.Unmarshal(recorder.Body.Bytes(), resp); err != nil {
+			t.Fatalf("%s %s replied %d %s: %v", method, path, recorder.Code, recorder.Body, err)
+		}
+	}
+	return recorder.Code
+}
+
+// mustSucceed fails the test unless the admin api request succeeds
+func mustSucceed(t *testing.T, s *OmcpServer, path, token string, body any) {
+	t.Helper()
+	var resp ServerResp
+	if status := do(t, s, http.MethodPost, path, token, body, &resp); status != http.StatusOK || !resp.Success {
+		t.Fatalf("POST %s replied %d: %s", path, status, resp.Message)
+	}
+}
+
+func createServer(t *testing.T, s *OmcpServer, token string, req CreateMcpServerReq) {
+	t.Helper()
+	mustSucceed(t, s, "/api/server/create", token, req)
+	mustSucceed(t, s, "/api/server/start", token, StartMcpServerReq{Name: req.Name})
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/jyz0309/omcp/logging"
+	"github.com/jyz0309/omcp/mcp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const requestIDKey = "request_id"
+
+// validRequestID is the id of a client request which is kept, others are replaced so they can't forge log lines
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID gives every request an id, the one of the client if it's valid, which is sent back
+// and attached to the log lines of the request
+func (s *OmcpServer) RequestID(c *gin.Context) {
+	id := c.GetHeader(logging.RequestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = uuid.NewString()
+	}
+	c.Set(requestIDKey, id)
+	c.Header(logging.RequestIDHeader, id)
+	c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+	c.Next()
+}
+
+// AccessLog logs every request once it's served, with the server and the session of the MCP requests
+func (s *OmcpServer) AccessLog(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	status := c.Writer.Status()
+	fields := logrus.Fields{
+		"method":  c.Request.Method,
+		"path":    c.Request.URL.Path,
+		"status":  status,
+		"latency": time.Since(start).String(),
+		"client":  c.ClientIP(),
+	}
+	if name := c.Param("name"); name != "" {
+		fields[logging.FieldServer] = name
+	}
+	if session := mcpSession(c); session != "" {
+		fields[logging.FieldSession] = session
+	}
+	logger := s.log(c).WithFields(fields)
+	switch {
+	case status >= 500:
+		logger.Error("request failed")
+	case c.FullPath() == "/ready":
+		// the probes would drown the other requests
+		logger.Debug("request served")
+	default:
+		logger.Info("request served")
+	}
+}
+
+// mcpSession is the client session of a MCP request, the sse messages have it in the query
+// and the streamable http initialize request gets it in the response
+func mcpSession(c *gin.Context) string {
+	if session := c.GetHeader(mcp.HeaderSessionID); session != "" {
+		return session
+	}
+	if session := c.Writer.Header().Get(mcp.HeaderSessionID); session != "" {
+		return session
+	}
+	return c.Query("sessionId")
+}
+
+// log is the logger of the request, with its id
+func (s *OmcpServer) log(c *gin.Context) *logrus.Entry {
+	return s.logger.WithField(logging.FieldRequestID, c.GetString(requestIDKey))
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"github.com/jyz0309/omcp/auth"
+	"github.com/jyz0309/omcp/mcp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logEvent is the sse event carrying a log line
+const logEvent = "log"
+
+// ServerLogs streams the log lines of the server over sse, the kept ones since the time of the request,
+// and if it follows them the new ones until the client goes away or the server is deleted
+func (s *OmcpServer) ServerLogs(c *gin.Context) {
+	var req ServerLogsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermServerLogs, req.Name) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Name)
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var lines []mcp.LogLine
+	var follow <-chan mcp.LogLine
+	if req.Follow {
+		var stop func()
+		lines, follow, stop = mcpServer.Logs().Follow(req.Since)
+		defer stop()
+	} else {
+		lines = mcpServer.Logs().Lines(req.Since)
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Content-Type", "text/event-stream")
+	c.Status(200)
+	for _, line := range lines {
+		c.SSEvent(logEvent, line)
+	}
+	c.Writer.Flush()
+	if !req.Follow {
+		return
+	}
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case line, ok := <-follow:
+			if !ok {
+				// the server was deleted or the client fell too far behind
+				return
+			}
+			c.SSEvent(logEvent, line)
+			c.Writer.Flush()
+		}
+	}
+}
@@ -5,10 +5,26 @@ import (
 	"errors"
 	"fmt"
 
+	omcp "github.com/jyz0309/omcp/mcp"
+
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
+func init() {
+	omcp.RegisterCatalogTool(omcp.MCPTool{
+		Name: "hello_world",
+		Desc: "Say hello to someone",
+		Option: []mcp.ToolOption{
+			mcp.WithString("name",
+				mcp.Required(),
+				mcp.Description("Name of the person to greet"),
+			),
+		},
+		Handler: helloHandler,
+	})
+}
+
 func NewTestMcpServer() *server.MCPServer {
 	s := server.NewMCPServer(
 		"Demo 🚀",
@@ -32,7 +48,7 @@ func NewTestMcpServer() *server.MCPServer {
 }
 
 func helloHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	name, ok := request.Params.Arguments["name"].(string)
+	name, ok := request.GetArguments()["name"].(string)
 	if !ok {
 		return nil, errors.New("name must be a string")
 	}
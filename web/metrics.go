@@ -0,0 +1,89 @@
+package web
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/jyz0309/omcp/artifact"
+	"github.com/jyz0309/omcp/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+const metricsPath = "/metrics"
+
+// ExposeMetrics serves the prometheus metrics on the address, or on the admin listener if it's empty
+func (s *OmcpServer) ExposeMetrics(addr string) error {
+	if addr == "" {
+		s.GET(metricsPath, gin.WrapH(metrics.Handler()))
+		return nil
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, metrics.Handler())
+	s.logger.Infof("serving metrics on %s", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			s.logger.Errorf("metrics listener stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// serverInfos reports the states of the servers to the metrics
+func (s *OmcpServer) serverInfos() []metrics.ServerInfo {
+	servers := s.Registry.List()
+	infos := make([]metrics.ServerInfo, 0, len(servers))
+	for _, server := range servers {
+		tools, _ := server.ListTools()
+		infos = append(infos, metrics.ServerInfo{Name: server.Name, State: string(server.GetState()), Tools: len(tools)})
+	}
+	return infos
+}
+
+// InstrumentAdmin measures the requests of the admin api by their route
+func (s *OmcpServer) InstrumentAdmin(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	route := c.FullPath()
+	metrics.AdminRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	metrics.AdminRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+}
+
+// InstrumentMCP counts the requests of the MCP endpoints, the names of the missing servers aren't
+// used as labels so the clients can't grow the series
+func (s *OmcpServer) InstrumentMCP(c *gin.Context) {
+	c.Next()
+	server := c.Param("name")
+	if _, err := s.Registry.Get(server); err != nil {
+		server = ""
+	}
+	metrics.MCPRequests.WithLabelValues(server, path.Base(c.FullPath()), c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+}
+
+// observePluginLoad counts a plugin load by its result, the plugins the signature policy refuses are rejected
+func observePluginLoad(err error) {
+	switch {
+	case err == nil:
+		metrics.PluginLoads.WithLabelValues(metrics.PluginLoadSuccess).Inc()
+	case errors.Is(err, artifact.ErrUnsigned), errors.Is(err, artifact.ErrUntrustedKey), errors.Is(err, artifact.ErrInvalidSignature):
+		metrics.PluginLoads.WithLabelValues(metrics.PluginLoadRejected).Inc()
+	default:
+		metrics.PluginLoads.WithLabelValues(metrics.PluginLoadFailed).Inc()
+	}
+}
+
+func observePluginResult(result LoadResult) {
+	if result.Success {
+		metrics.PluginLoads.WithLabelValues(metrics.PluginLoadSuccess).Inc()
+		return
+	}
+	metrics.PluginLoads.WithLabelValues(metrics.PluginLoadFailed).Inc()
+}
@@ -0,0 +1,88 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/jyz0309/omcp/artifact"
+	"github.com/jyz0309/omcp/mcp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signatureLimit bounds the uploaded signature, a signature is a small json document
+const signatureLimit = 64 << 10
+
+// SetPlugins stores the plugin artifacts in the store and loads the ones the policy accepts
+func (s *OmcpServer) SetPlugins(store *artifact.Store, policy artifact.Policy) {
+	s.plugins = store
+	s.pluginPolicy = policy
+}
+
+// storePlugin stores the uploaded plugin file under its digest if the policy accepts its signature,
+// the name of the uploaded file is ignored
+func (s *OmcpServer) storePlugin(c *gin.Context) (string, string, error) {
+	pluginFile, err := c.FormFile("plugin_file")
+	if err != nil {
+		return "", "", fmt.Errorf("plugin file is required: %w", err)
+	}
+	var sig *artifact.Signature
+	if sigFile, err := c.FormFile("signature"); err == nil {
+		if sig, err = readSignature(sigFile); err != nil {
+			return "", "", err
+		}
+	} else if !errors.Is(err, http.ErrMissingFile) {
+		return "", "", err
+	}
+
+	file, err := pluginFile.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	var signer string
+	digest, err := s.plugins.Put(file, func(digest string) error {
+		signer, err = s.pluginPolicy.Check(digest, sig)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if sig != nil {
+		if err := s.plugins.PutSignature(sig); err != nil {
+			return "", "", err
+		}
+	}
+	s.log(c).Infof("stored plugin %s, signed by %q", digest, signer)
+	return digest, signer, nil
+}
+
+func readSignature(header *multipart.FileHeader) (*artifact.Signature, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, signatureLimit))
+	if err != nil {
+		return nil, err
+	}
+	return artifact.ParseSignature(data)
+}
+
+// checkPlugin checks the stored artifact of the plugin against the policy and points the plugin at it
+func (s *OmcpServer) checkPlugin(plugin *mcp.Plugin) error {
+	return mcp.CheckPlugin(plugin, s.plugins, s.pluginPolicy)
+}
+
+// dropUntrustedPlugins drops the persisted tools and resources whose plugins the policy rejects,
+// e.g. a plugin signed by a key which is no longer trusted isn't loaded again
+func (s *OmcpServer) dropUntrustedPlugins(saved *mcp.MCPServer) {
+	saved.DropPlugins(s.checkPlugin, func(item string, err error) {
+		s.logger.Warnf("drop %s of server %s: %v", item, saved.Name, err)
+		observePluginLoad(err)
+	})
+}
@@ -0,0 +1,157 @@
+package web
+
+import (
+	"time"
+
+	"github.com/jyz0309/omcp/auth"
+	"github.com/jyz0309/omcp/mcp"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *OmcpServer) ListPolicy(c *gin.Context) {
+	var req ListPolicyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermPolicyList, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err != nil {
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	policies := mcpServer.ListPolicies()
+	c.JSON(200, ListPolicyResp{
+		Total:    int64(len(policies)),
+		Policies: policies,
+	})
+}
+
+func (s *OmcpServer) AddPolicy(c *gin.Context) {
+	var req AddPolicyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, PolicyResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermPolicyWrite, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err == nil {
+		err = mcpServer.AddPolicy(req.Policy, req.Before)
+	}
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, PolicyResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := s.Registry.Save(mcpServer); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, PolicyResp{
+			Success: false,
+			Message: "failed to persist mcp server",
+		})
+		return
+	}
+	s.log(c).Infof("added policy %s to mcp server %s", req.Policy.Name, req.Server)
+	c.JSON(200, PolicyResp{
+		Success: true,
+		Message: "success",
+		Policy:  &req.Policy,
+	})
+}
+
+func (s *OmcpServer) DeletePolicy(c *gin.Context) {
+	var req DeletePolicyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermPolicyWrite, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err == nil {
+		err = mcpServer.DeletePolicy(req.Name)
+	}
+	if err != nil {
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := s.Registry.Save(mcpServer); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, ServerResp{
+			Success: false,
+			Message: "failed to persist mcp server",
+		})
+		return
+	}
+	s.log(c).Infof("deleted policy %s from mcp server %s", req.Name, req.Server)
+	c.JSON(200, ServerResp{
+		Success: true,
+		Message: "success",
+	})
+}
+
+// EvalPolicy dry-runs the policies of the server against a call without running the tool
+func (s *OmcpServer) EvalPolicy(c *gin.Context) {
+	var req EvalPolicyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, EvalPolicyResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if !s.authorize(c, auth.PermPolicyList, req.Server) {
+		return
+	}
+	mcpServer, err := s.Registry.Get(req.Server)
+	if err != nil {
+		c.JSON(200, EvalPolicyResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if req.Time.IsZero() {
+		req.Time = time.Now()
+	}
+	result := mcpServer.EvaluatePolicies(mcp.CallInput{
+		Identity:  req.Identity,
+		Server:    req.Server,
+		Tool:      req.Tool,
+		Arguments: req.Arguments,
+		Time:      req.Time,
+	})
+	c.JSON(200, EvalPolicyResp{
+		Success: true,
+		Message: "success",
+		Result:  &result,
+	})
+}
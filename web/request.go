@@ -1,7 +1,12 @@
 package web
 
 import (
+	"time"
+
+	"github.com/jyz0309/omcp/audit"
+	"github.com/jyz0309/omcp/auth"
 	"github.com/jyz0309/omcp/mcp"
+	"github.com/jyz0309/omcp/secret"
 )
 
 type ServerResp struct {
@@ -9,11 +14,34 @@ type ServerResp struct {
 	Message string `json:"message"`
 }
 
+const (
+	ToolSourceCatalog    = "catalog"
+	ToolSourcePlugin     = "plugin"
+	ToolSourceDefinition = "definition"
+)
+
+// AddToolReq adds the tool named Name from the source to the server,
+// Plugin is required for the plugin source and Definition for the definition source
 type AddToolReq struct {
-	Name     string `json:"name"`
-	Desc     string `json:"desc"`
-	FilePath string `json:"filePath"`
-	Func     string `json:"func"`
+	Server     string              `json:"server"`
+	Name       string              `json:"name"`
+	Desc       string              `json:"desc"`
+	Source     string              `json:"source"`
+	Plugin     *mcp.Plugin         `json:"plugin,omitempty"`
+	Definition *mcp.ToolDefinition `json:"definition,omitempty"`
+	// Secrets are the names of the secrets the handler of the tool receives in its context
+	Secrets []string `json:"secrets,omitempty"`
+	// RequireApproval holds every call of the tool until an operator approves it
+	RequireApproval bool `json:"require_approval,omitempty"`
+}
+
+// UpdateToolReq replaces the tool named Name in place
+type UpdateToolReq AddToolReq
+
+type ToolResp struct {
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Tool    *mcp.MCPTool `json:"tool,omitempty"`
 }
 
 type DeleteToolReq struct {
@@ -25,6 +53,14 @@ type CreateMcpServerReq struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
 	Desc    string `json:"desc"`
+	// Transports are sse and streamable-http, all of them if empty
+	Transports []string `json:"transports"`
+	// Upstream makes the server a proxy of an external MCP server
+	Upstream *mcp.Upstream `json:"upstream,omitempty"`
+	// Gateway makes the server a gateway of other managed servers
+	Gateway *mcp.Gateway `json:"gateway,omitempty"`
+	// Labels are selected by the scoped role bindings
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 type CreateMcpServerResp struct {
@@ -64,6 +100,14 @@ type StopMcpServerReq struct {
 	Name string `json:"name"`
 }
 
+// ServerLogsReq streams the kept log lines of the server since the time, all of them if it's empty,
+// and then the new ones if Follow is set
+type ServerLogsReq struct {
+	Name   string    `json:"name"`
+	Since  time.Time `json:"since,omitempty"`
+	Follow bool      `json:"follow"`
+}
+
 // Tool
 type ListToolReq struct {
 	Server string `json:"server"`
@@ -75,12 +119,283 @@ type ListToolResp struct {
 	Tools []mcp.MCPTool `json:"tools"`
 }
 
-// Load
+// Resource
+type ListResourceReq struct {
+	Server string `json:"server"`
+}
+
+type ListResourceResp struct {
+	Total     int64             `json:"total"`
+	Resources []mcp.MCPResource `json:"resources"`
+}
+
+type AddResourceReq struct {
+	Server   string              `json:"server"`
+	Name     string              `json:"name"`
+	Desc     string              `json:"desc"`
+	URI      string              `json:"uri"`
+	MimeType string              `json:"mime_type"`
+	Source   *mcp.ResourceSource `json:"source"`
+}
+
+type ResourceResp struct {
+	Success  bool             `json:"success"`
+	Message  string           `json:"message"`
+	Resource *mcp.MCPResource `json:"resource,omitempty"`
+}
+
+type DeleteResourceReq struct {
+	Server string `json:"server"`
+	URI    string `json:"uri"`
+}
+
+// Prompt
+type ListPromptReq struct {
+	Server string `json:"server"`
+}
+
+type ListPromptResp struct {
+	Total   int64           `json:"total"`
+	Prompts []mcp.MCPPrompt `json:"prompts"`
+}
+
+type CreatePromptReq struct {
+	Server string        `json:"server"`
+	Prompt mcp.MCPPrompt `json:"prompt"`
+}
+
+type PromptResp struct {
+	Success bool           `json:"success"`
+	Message string         `json:"message"`
+	Prompt  *mcp.MCPPrompt `json:"prompt,omitempty"`
+}
+
+type RenderPromptReq struct {
+	Server    string            `json:"server"`
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments"`
+}
+
+type RenderPromptResp struct {
+	Success  bool                `json:"success"`
+	Message  string              `json:"message"`
+	Messages []mcp.PromptMessage `json:"messages"`
+}
+
+type DeletePromptReq struct {
+	Server string `json:"server"`
+	Name   string `json:"name"`
+}
+
+// Load, the request is sent as a multipart form with the plugin file and its detached signature,
+// the fields are sent as form values and plugins is encoded as json
 type LoadReq struct {
+	Server  string       `json:"server"`
 	Plugins []mcp.Plugin `json:"plugins"`
 }
 
+type LoadResult struct {
+	Name      string   `json:"name"`
+	Success   bool     `json:"success"`
+	Message   string   `json:"message"`
+	Tools     []string `json:"tools,omitempty"`
+	Resources []string `json:"resources,omitempty"`
+}
+
+// LoadResp carries the digest the plugin file is stored under and the key which signed it
 type LoadResp struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Digest  string       `json:"digest,omitempty"`
+	Signer  string       `json:"signer,omitempty"`
+	Results []LoadResult `json:"results,omitempty"`
+}
+
+// Token
+type ListTokenResp struct {
+	Total  int64        `json:"total"`
+	Tokens []auth.Token `json:"tokens"`
+}
+
+type CreateTokenReq struct {
+	Name string `json:"name"`
+	// Roles are the roles of the token, at least one is required
+	Roles auth.RoleBindings `json:"roles"`
+	// TTL is a duration like 720h, the token never expires if empty
+	TTL string `json:"ttl"`
+}
+
+// TokenResp carries the secret of a created token, it's never returned again
+type TokenResp struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Token   *auth.Token `json:"token,omitempty"`
+	Secret  string      `json:"secret,omitempty"`
+}
+
+// RevokeTokenReq revokes the active token of the name or the token of the id
+type RevokeTokenReq struct {
+	Name string `json:"name"`
+}
+
+// Client key
+type ListClientKeyReq struct {
+	// Server lists the keys of the server, all the keys if empty
+	Server string `json:"server"`
+}
+
+type ListClientKeyResp struct {
+	Total int64            `json:"total"`
+	Keys  []auth.ClientKey `json:"keys"`
+}
+
+type CreateClientKeyReq struct {
+	Server string `json:"server"`
+	Name   string `json:"name"`
+	// Scope restricts the tools and resources of the key, everything is allowed if empty
+	Scope mcp.ClientScope `json:"scope"`
+	// TTL is a duration like 720h, the key never expires if empty
+	TTL string `json:"ttl"`
+}
+
+// ClientKeyResp carries the secret of a created key, it's never returned again
+type ClientKeyResp struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Key     *auth.ClientKey `json:"key,omitempty"`
+	Secret  string          `json:"secret,omitempty"`
+}
+
+// RevokeClientKeyReq revokes the active key of the name or the key of the id
+type RevokeClientKeyReq struct {
+	Server string `json:"server"`
+	Name   string `json:"name"`
+}
+
+// Policy
+type ListPolicyReq struct {
+	Server string `json:"server"`
+}
+
+type ListPolicyResp struct {
+	Total    int64        `json:"total"`
+	Policies []mcp.Policy `json:"policies"`
+}
+
+// AddPolicyReq inserts the policy before the policy named Before, or appends it if Before is empty
+type AddPolicyReq struct {
+	Server string     `json:"server"`
+	Policy mcp.Policy `json:"policy"`
+	Before string     `json:"before,omitempty"`
+}
+
+type DeletePolicyReq struct {
+	Server string `json:"server"`
+	Name   string `json:"name"`
+}
+
+type PolicyResp struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Policy  *mcp.Policy `json:"policy,omitempty"`
+}
+
+// EvalPolicyReq dry-runs the policies of the server against a call, the time is now if empty
+type EvalPolicyReq struct {
+	Server    string         `json:"server"`
+	Tool      string         `json:"tool"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+	Identity  *mcp.Identity  `json:"identity,omitempty"`
+	Time      time.Time      `json:"time,omitempty"`
+}
+
+type EvalPolicyResp struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Result  *mcp.PolicyResult `json:"result,omitempty"`
+}
+
+// Audit
+// ListAuditReq filters the audit entries, the empty fields match every entry
+type ListAuditReq audit.Filter
+
+type ListAuditResp struct {
+	Success bool          `json:"success"`
+	Message string        `json:"message"`
+	Total   int64         `json:"total"`
+	Entries []audit.Entry `json:"entries"`
+}
+
+// Secret
+type ListSecretResp struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Total   int64           `json:"total"`
+	Secrets []secret.Secret `json:"secrets"`
+}
+
+// SetSecretReq creates the secret or replaces its value, the description is kept if it's empty
+type SetSecretReq struct {
+	Name  string `json:"name"`
+	Desc  string `json:"desc"`
+	Value string `json:"value"`
+}
+
+type DeleteSecretReq struct {
+	Name string `json:"name"`
+}
+
+// SecretResp never carries the value of the secret
+type SecretResp struct {
+	Success bool           `json:"success"`
+	Message string         `json:"message"`
+	Secret  *secret.Secret `json:"secret,omitempty"`
+}
+
+// Approval
+// ListApprovalReq filters the approvals, the empty fields match every approval
+type ListApprovalReq struct {
+	Status mcp.ApprovalStatus `json:"status"`
+	Server string             `json:"server"`
+}
+
+type ListApprovalResp struct {
+	Success   bool           `json:"success"`
+	Message   string         `json:"message"`
+	Total     int64          `json:"total"`
+	Approvals []mcp.Approval `json:"approvals"`
+}
+
+const (
+	ApprovalDecisionApprove = "approve"
+	ApprovalDecisionReject  = "reject"
+)
+
+// DecideApprovalReq approves or rejects the pending approval of the path
+type DecideApprovalReq struct {
+	Decision string `json:"decision"`
+	Comment  string `json:"comment"`
+}
+
+type ApprovalResp struct {
+	Success  bool          `json:"success"`
+	Message  string        `json:"message"`
+	Approval *mcp.Approval `json:"approval,omitempty"`
+}
+
+// Call
+// ListCallReq filters the tool call history, the empty fields match every call
+type ListCallReq mcp.CallFilter
+
+type ListCallResp struct {
+	Success bool             `json:"success"`
+	Message string           `json:"message"`
+	Total   int64            `json:"total"`
+	Calls   []mcp.CallRecord `json:"calls"`
+}
+
+type CallResp struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Call    *mcp.CallRecord `json:"call,omitempty"`
 }
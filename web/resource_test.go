@@ -0,0 +1,51 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jyz0309/omcp/auth"
+	"github.com/jyz0309/omcp/mcp"
+)
+
+// TestAddResourceSource checks only the unscoped roles can serve the files of the host
+func TestAddResourceSource(t *testing.T) {
+	s, admin := newTestServer(t)
+	createServer(t, s, admin, CreateMcpServerReq{Name: "s"})
+	scoped := createToken(t, s, "scoped", auth.RoleBindings{{Role: auth.RoleAdmin, Servers: []string{"s"}}})
+	publisher := createToken(t, s, "publisher", auth.RoleBindings{{Role: auth.RolePluginPublisher, Servers: []string{"s"}}})
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("notes"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		source     mcp.ResourceSource
+		wantStatus int
+	}{
+		{name: "unscoped file", token: admin, source: mcp.ResourceSource{Type: mcp.ResourceSourceFile, Path: file}, wantStatus: http.StatusOK},
+		{name: "scoped text", token: scoped, source: mcp.ResourceSource{Type: mcp.ResourceSourceText, Text: "notes"}, wantStatus: http.StatusOK},
+		{name: "scoped file", token: scoped, source: mcp.ResourceSource{Type: mcp.ResourceSourceFile, Path: file}, wantStatus: http.StatusForbidden},
+		{name: "scoped dir", token: scoped, source: mcp.ResourceSource{Type: mcp.ResourceSourceDir, Path: dir}, wantStatus: http.StatusForbidden},
+		// a scoped plugin publisher can't escape its scope through the files of the host
+		{name: "scoped publisher text", token: publisher, source: mcp.ResourceSource{Type: mcp.ResourceSourceText, Text: "notes"}, wantStatus: http.StatusOK},
+		{name: "scoped publisher file", token: publisher, source: mcp.ResourceSource{Type: mcp.ResourceSourceFile, Path: file}, wantStatus: http.StatusForbidden},
+		{name: "scoped publisher dir", token: publisher, source: mcp.ResourceSource{Type: mcp.ResourceSourceDir, Path: dir}, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := AddResourceReq{Server: "s", Name: tt.name, URI: "notes://" + strings.ReplaceAll(tt.name, " ", "-"), Source: &tt.source}
+			var resp ResourceResp
+			status := do(t, s, http.MethodPost, "/api/resource/add", tt.token, req, &resp)
+			if status != tt.wantStatus || resp.Success != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("add resource replied %d %v: %s, want %d", status, resp.Success, resp.Message, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"fmt"
+
+	"github.com/jyz0309/omcp/mcp"
+	"github.com/jyz0309/omcp/secret"
+	"github.com/jyz0309/omcp/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetSecrets keeps the secrets referenced by the tools and the upstreams, the secrets api
+// and the tools which reference secrets are disabled without them
+func (s *OmcpServer) SetSecrets(secrets *secret.Secrets) {
+	s.secrets = secrets
+	s.Registry.SetSecrets(secrets)
+}
+
+// restoreSecrets loads the persisted secrets, they must be encrypted with the master key
+func (s *OmcpServer) restoreSecrets() error {
+	secrets, err := store.LoadSecrets(s.store)
+	if err != nil {
+		return err
+	}
+	if s.secrets == nil {
+		if len(secrets) > 0 {
+			s.logger.Warnf("%d secrets are kept but disabled, no master key is configured", len(secrets))
+		}
+		return nil
+	}
+	if err := s.secrets.Add(secrets...); err != nil {
+		return fmt.Errorf("failed to decrypt the secrets, check the master key: %w", err)
+	}
+	return nil
+}
+
+// checkSecrets checks the secrets the tool references exist
+func (s *OmcpServer) checkSecrets(tool mcp.MCPTool) error {
+	if len(tool.Secrets) == 0 {
+		return nil
+	}
+	if s.secrets == nil {
+		return fmt.Errorf("tool %s references secrets: %w", tool.Name, mcp.ErrSecretsDisabled)
+	}
+	for _, name := range tool.Secrets {
+		if !s.secrets.Has(name) {
+			return fmt.Errorf("tool %s: %w: %s", tool.Name, secret.ErrSecretNotFound, name)
+		}
+	}
+	return nil
+}
+
+func (s *OmcpServer) ListSecret(c *gin.Context) {
+	if s.secrets == nil {
+		c.JSON(200, ListSecretResp{
+			Success: false,
+			Message: mcp.ErrSecretsDisabled.Error(),
+		})
+		return
+	}
+	secrets := s.secrets.List()
+	c.JSON(200, ListSecretResp{
+		Success: true,
+		Message: "success",
+		Total:   int64(len(secrets)),
+		Secrets: secrets,
+	})
+}
+
+func (s *OmcpServer) SetSecret(c *gin.Context) {
+	var req SetSecretReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, SecretResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if s.secrets == nil {
+		c.JSON(200, SecretResp{
+			Success: false,
+			Message: mcp.ErrSecretsDisabled.Error(),
+		})
+		return
+	}
+	saved, err := s.secrets.Set(req.Name, req.Desc, req.Value)
+	if err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, SecretResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	s.log(c).Infof("set secret %s", saved.Name)
+	c.JSON(200, SecretResp{
+		Success: true,
+		Message: "success",
+		Secret:  &saved,
+	})
+}
+
+func (s *OmcpServer) DeleteSecret(c *gin.Context) {
+	var req DeleteSecretReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, SecretResp{
+			Success: false,
+			Message: "invalid request",
+		})
+		return
+	}
+	if s.secrets == nil {
+		c.JSON(200, SecretResp{
+			Success: false,
+			Message: mcp.ErrSecretsDisabled.Error(),
+		})
+		return
+	}
+	if err := s.secrets.Delete(req.Name); err != nil {
+		s.log(c).Error(err)
+		c.JSON(200, SecretResp{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	s.log(c).Infof("deleted secret %s", req.Name)
+	c.JSON(200, SecretResp{
+		Success: true,
+		Message: "success",
+	})
+}
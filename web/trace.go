@@ -0,0 +1,132 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/jyz0309/omcp/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxTracedMessage is the largest message body read to name the span of the request
+const maxTracedMessage = 1 << 20
+
+// answeredMethods are the methods the MCP server answers with a response, the span of a request
+// over sse is ended by the response since the message endpoint returns before it's handled
+var answeredMethods = map[mcp.MCPMethod]bool{
+	mcp.MethodInitialize:             true,
+	mcp.MethodPing:                   true,
+	mcp.MethodResourcesList:          true,
+	mcp.MethodResourcesTemplatesList: true,
+	mcp.MethodResourcesRead:          true,
+	mcp.MethodPromptsList:            true,
+	mcp.MethodPromptsGet:             true,
+	mcp.MethodToolsList:              true,
+	mcp.MethodToolsCall:              true,
+}
+
+// jsonrpcMessage is the part of a JSON-RPC message the span of the request is made of
+type jsonrpcMessage struct {
+	ID     any           `json:"id"`
+	Method mcp.MCPMethod `json:"method"`
+	Params struct {
+		Name string         `json:"name"`
+		Meta map[string]any `json:"_meta"`
+	} `json:"params"`
+}
+
+// TraceAdmin starts a span for every request of the admin api, continuing the trace of the traceparent header
+func (s *OmcpServer) TraceAdmin(c *gin.Context) {
+	ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+	route := c.FullPath()
+	ctx, span := tracing.Tracer().Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, route),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+		))
+	defer span.End()
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+	endHTTPSpan(span, c)
+	if principal := principalOf(c); principal.Name != "" {
+		span.SetAttributes(attribute.String("omcp.principal", principal.Name))
+	}
+}
+
+// TraceMCP starts a span for every JSON-RPC request posted to the MCP endpoints, the trace is continued
+// from the _meta of the message or else from the traceparent header, the tool calls are its children
+func (s *OmcpServer) TraceMCP(c *gin.Context) {
+	ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+	message, ok := peekMessage(c.Request)
+	if !ok || message.Method == "" {
+		// the streams and the responses of the client aren't traced, only propagated
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		return
+	}
+	ctx = tracing.ExtractMeta(ctx, message.Params.Meta)
+	name := string(message.Method)
+	attrs := []attribute.KeyValue{
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", name),
+		attribute.String("omcp.server", c.Param("name")),
+		attribute.String("omcp.transport", path.Base(c.FullPath())),
+	}
+	if message.Params.Name != "" {
+		name = fmt.Sprintf("%s %s", name, message.Params.Name)
+		attrs = append(attrs, attribute.String("omcp.tool", message.Params.Name))
+	}
+	if message.ID != nil {
+		attrs = append(attrs, attribute.String("rpc.jsonrpc.request_id", fmt.Sprint(message.ID)))
+	}
+	ctx, span := tracing.StartRequest(ctx, name, attrs...)
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+	if c.Writer.Status() == http.StatusAccepted && message.ID != nil && answeredMethods[message.Method] {
+		// the request is handled after the message endpoint returns, the span ends with the response
+		return
+	}
+	endHTTPSpan(span, c)
+	span.End()
+}
+
+// peekMessage reads the JSON-RPC message of a POST body and puts the body back for the handler
+func peekMessage(r *http.Request) (jsonrpcMessage, bool) {
+	var message jsonrpcMessage
+	if r.Method != http.MethodPost || r.Body == nil {
+		return message, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxTracedMessage))
+	// the rest of a too large body is still read by the handler
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return message, false
+	}
+	// a batch isn't a single request, it's only propagated
+	if err := json.Unmarshal(body, &message); err != nil {
+		return message, false
+	}
+	return message, true
+}
+
+// endHTTPSpan records the status code of the response, the server errors fail the span
+func endHTTPSpan(span trace.Span, c *gin.Context) {
+	status := c.Writer.Status()
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}